@@ -1,20 +1,76 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// AdminAuth only lets admins through. API keys are refused, their scopes
+// are checked by RequirePermission.
 func AdminAuth(c *fiber.Ctx) error {
 	user, ok := c.Context().UserValue("user").(*types.User)
 	if !ok {
+		if _, isKey := principal(c); isKey {
+			return ErrUnAuthorized()
+		}
 		return ErrUnAuthenticated()
 	}
-	if !user.IsAdmin {
+	if user.EffectiveRole() != types.ADMIN {
 		return ErrUnAuthorized()
 	}
+	if secondFactorMissing(c, user) {
+		return errSecondFactorRequired()
+	}
 	if err := c.Next(); err != nil {
 		return err
 	}
 	return nil
 }
+
+// RequirePermission only lets users and API keys with permission through.
+// When hotelParam names a route param the permission is checked for that
+// hotel, so staff and keys limited to other hotels are refused; otherwise it
+// is needed for all hotels.
+func RequirePermission(permission types.Permission, hotelParam string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, ok := principal(c)
+		if !ok {
+			return ErrUnAuthenticated()
+		}
+		var hotelID primitive.ObjectID
+		if len(hotelParam) > 0 {
+			oid, err := primitive.ObjectIDFromHex(c.Params(hotelParam))
+			if err != nil {
+				return ErrInvalidId()
+			}
+			hotelID = oid
+		}
+		if !p.Can(permission, hotelID) {
+			return ErrUnAuthorized()
+		}
+		if user, ok := p.(*types.User); ok && secondFactorMissing(c, user) {
+			return errSecondFactorRequired()
+		}
+		return c.Next()
+	}
+}
+
+// canOverride reports whether user may act on records of other users with
+// permission for hotelID. Admins who enrolled a second factor need it here
+// as they do behind AdminAuth and RequirePermission.
+func canOverride(c *fiber.Ctx, user *types.User, permission types.Permission, hotelID primitive.ObjectID) bool {
+	return user.Can(permission, hotelID) && !secondFactorMissing(c, user)
+}
+
+// secondFactorMissing reports whether an admin who enrolled a second factor
+// uses a token issued without it. Admin rights then need the second factor.
+func secondFactorMissing(c *fiber.Ctx, user *types.User) bool {
+	return user.EffectiveRole() == types.ADMIN && user.TOTPEnabled() && !sessionHasMFA(c)
+}
+
+func errSecondFactorRequired() Error {
+	return NewError(http.StatusForbidden, "two-factor authentication required")
+}
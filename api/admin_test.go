@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/db/fixtures"
 	"github.com/swarajroy/hotel-reservation/types"
 	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestShouldFailWhenUserIsNotAnAdminSetInContext(t *testing.T) {
@@ -46,3 +53,46 @@ func TestShouldPass(t *testing.T) {
 
 	assert.Panics(t, func() { AdminAuth(c) })
 }
+
+func TestHotelStaffOnlySeeTheirHotelsBookings(t *testing.T) {
+	var (
+		ctx            = context.Background()
+		tdb            = Setup(t, ctx)
+		store          = tdb.store
+		guest          = fixtures.AddUser(store, "james", "foo", false)
+		staff          = fixtures.AddUser(store, "front", "desk", false)
+		hotel          = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		other          = fixtures.AddHotel(store, "foo hotel", "paris", nil)
+		room           = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, hotel.ID)
+		from           = time.Now().AddDate(0, 0, 5)
+		booking        = fixtures.AddBooking(store, guest.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+		app            = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		bookingHandler = NewBookingHandler(store, types.DefaultCancellationPolicy())
+	)
+	defer tdb.TearDown(t, ctx)
+	if err := store.User.SetUserRole(ctx, staff.ID.Hex(), types.STAFF, []primitive.ObjectID{hotel.ID}); err != nil {
+		t.Fatal(err)
+	}
+	staff, _ = store.User.GetUserById(ctx, staff.ID.Hex())
+	app.Get("/hotels/:id/bookings", withUser(staff), RequirePermission(types.READ_BOOKINGS, "id"), bookingHandler.HandleGetHotelBookings)
+	app.Get("/bookings/:id", withUser(staff), bookingHandler.HandleGetBooking)
+	app.Delete("/bookings/:id", withUser(staff), bookingHandler.HandleDeleteBooking)
+
+	get := func(url string) int {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, get(fmt.Sprintf("/hotels/%s/bookings", hotel.ID.Hex())))
+	assert.Equal(t, http.StatusForbidden, get(fmt.Sprintf("/hotels/%s/bookings", other.ID.Hex())))
+	assert.Equal(t, http.StatusOK, get(fmt.Sprintf("/bookings/%s", booking.ID.Hex())))
+
+	// front-desk staff may look but not cancel
+	resp, err := app.Test(httptest.NewRequest("DELETE", fmt.Sprintf("/bookings/%s", booking.ID.Hex()), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// API_KEY_PREFIX starts every API key so leaked keys are easy to spot
+	API_KEY_PREFIX = "hrk_"
+	// apiKeyShownPrefix is how much of a key is kept to tell keys apart
+	apiKeyShownPrefix = len(API_KEY_PREFIX) + 8
+)
+
+type APIKeyHandler struct {
+	store *db.HotelReservationStore
+}
+
+func NewAPIKeyHandler(store *db.HotelReservationStore) *APIKeyHandler {
+	return &APIKeyHandler{
+		store: store,
+	}
+}
+
+// CreatedAPIKeyResponse holds the key, which is only shown once.
+type CreatedAPIKeyResponse struct {
+	Key    string        `json:"key"`
+	APIKey *types.APIKey `json:"apiKey"`
+}
+
+// HandlePostAPIKey creates a key for an integration. The key is sent in the
+// X-Api-Key header of its requests.
+func (h *APIKeyHandler) HandlePostAPIKey(c *fiber.Ctx) error {
+	admin, ok := c.Context().UserValue("user").(*types.User)
+	if !ok {
+		return ErrUnAuthenticated()
+	}
+	var params types.CreateAPIKeyParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	now := time.Now()
+	if errors := params.Validate(now); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
+
+	secret, _ := newOpaqueToken()
+	key := API_KEY_PREFIX + secret
+	apiKey := params.NewAPIKey(admin.ID, now)
+	apiKey.Prefix = key[:apiKeyShownPrefix]
+	apiKey.Hash = hashToken(key)
+	inserted, err := h.store.APIKey.InsertAPIKey(c.Context(), apiKey)
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusCreated).JSON(CreatedAPIKeyResponse{
+		Key:    key,
+		APIKey: inserted,
+	})
+}
+
+func (h *APIKeyHandler) HandleGetAPIKeys(c *fiber.Ctx) error {
+	keys, err := h.store.APIKey.GetAPIKeys(c.Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(keys)
+}
+
+// HandleDeleteAPIKey revokes a key. The record is kept so its usage can
+// still be looked up.
+func (h *APIKeyHandler) HandleDeleteAPIKey(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := h.store.APIKey.RevokeAPIKey(c.Context(), id, time.Now()); err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(map[string]string{"Revoked": id})
+}
+
+// authenticateAPIKey records a use of the API key of the request and puts it
+// in the context in place of a user.
+func authenticateAPIKey(c *fiber.Ctx, store *db.HotelReservationStore, key string) error {
+	apiKey, err := store.APIKey.UseAPIKey(c.Context(), hashToken(key), time.Now())
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return NewError(http.StatusUnauthorized, "invalid api key")
+	}
+	if err != nil {
+		return err
+	}
+	c.Context().SetUserValue("apiKey", apiKey)
+	return c.Next()
+}
+
+// principal returns the user or API key the request acts for.
+func principal(c *fiber.Ctx) (types.Principal, bool) {
+	if user, ok := c.Context().UserValue("user").(*types.User); ok {
+		return user, true
+	}
+	if apiKey, ok := c.Context().UserValue("apiKey").(*types.APIKey); ok {
+		return apiKey, true
+	}
+	return nil, false
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/db/fixtures"
+	"github.com/swarajroy/hotel-reservation/types"
+)
+
+func TestAPIKeys(t *testing.T) {
+	var (
+		ctx            = context.Background()
+		tdb            = Setup(t, ctx)
+		store          = tdb.store
+		signer         = newTestTokenSigner(t)
+		admin          = fixtures.AddUser(store, "admin", "admin", true)
+		adminToken     = testToken(t, signer, admin)
+		hotel          = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		other          = fixtures.AddHotel(store, "foo hotel", "paris", nil)
+		room           = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, hotel.ID)
+		app            = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		apiv1          = app.Group("/", JWTAuthentication(store, signer))
+		apiKeyHandler  = NewAPIKeyHandler(store)
+		bookingHandler = NewBookingHandler(store, types.DefaultCancellationPolicy())
+		roomHandler    = NewRoomHandler(store)
+	)
+	defer tdb.TearDown(t, ctx)
+	apiv1.Get("/hotels/:id/bookings", RequirePermission(types.READ_BOOKINGS, "id"), bookingHandler.HandleGetHotelBookings)
+	apiv1.Get("/bookings", bookingHandler.HandleGetUserBookings)
+	apiv1.Post("/room/:id/book", roomHandler.HandleBookRoom)
+	apiv1.Post("/admin/apikeys", AdminAuth, apiKeyHandler.HandlePostAPIKey)
+	apiv1.Get("/admin/apikeys", AdminAuth, apiKeyHandler.HandleGetAPIKeys)
+	apiv1.Delete("/admin/apikeys/:id", AdminAuth, apiKeyHandler.HandleDeleteAPIKey)
+
+	do := func(method, url, header, value string, body any) (int, []byte) {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add(header, value)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, data
+	}
+
+	params := types.CreateAPIKeyParams{Name: "channel manager", Scopes: []types.Permission{types.READ_BOOKINGS}, HotelIDs: []string{hotel.ID.Hex()}}
+	status, _ := do("POST", "/admin/apikeys", "X-Api-Token", adminToken, types.CreateAPIKeyParams{Name: "no scopes"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, data := do("POST", "/admin/apikeys", "X-Api-Token", adminToken, params)
+	assert.Equal(t, http.StatusCreated, status)
+	var created CreatedAPIKeyResponse
+	if err := json.Unmarshal(data, &created); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(created.Key, API_KEY_PREFIX))
+	assert.True(t, strings.HasPrefix(created.Key, created.APIKey.Prefix))
+	assert.Equal(t, admin.ID, created.APIKey.CreatedBy)
+
+	status, _ = do("GET", fmt.Sprintf("/hotels/%s/bookings", hotel.ID.Hex()), "X-Api-Key", created.Key, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = do("GET", fmt.Sprintf("/hotels/%s/bookings", other.ID.Hex()), "X-Api-Key", created.Key, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	// keys act for no user and can't reach admin routes
+	status, _ = do("GET", "/bookings", "X-Api-Key", created.Key, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do("GET", "/admin/apikeys", "X-Api-Key", created.Key, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	from := time.Now().AddDate(0, 0, 5)
+	status, _ = do("POST", "/room/"+room.ID.Hex()+"/book", "X-Api-Key", created.Key, types.BookRoomParams{NumPersons: 1, FromDate: from, TillDate: from.AddDate(0, 0, 2)})
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("GET", "/bookings", "X-Api-Key", API_KEY_PREFIX+"unknown", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, data = do("GET", "/admin/apikeys", "X-Api-Token", adminToken, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotContains(t, string(data), hashToken(created.Key))
+	var keys []*types.APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, keys, 1)
+	assert.Equal(t, int64(5), keys[0].UseCount)
+	assert.WithinDuration(t, time.Now(), keys[0].LastUsedAt, time.Minute)
+
+	status, _ = do("DELETE", "/admin/apikeys/"+created.APIKey.ID.Hex(), "X-Api-Token", adminToken, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = do("GET", fmt.Sprintf("/hotels/%s/bookings", hotel.ID.Hex()), "X-Api-Key", created.Key, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do("DELETE", "/admin/apikeys/"+created.APIKey.ID.Hex(), "X-Api-Token", adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/swarajroy/hotel-reservation/config"
+)
+
+// REAL_IP_HEADER carries the client IP set by the reverse proxy, see
+// nginx/dev.conf.d/nginx.conf.
+const REAL_IP_HEADER = "X-Real-IP"
+
+// AppConfig returns the fiber config of the API. The client IP is taken
+// from the X-Real-IP header only for requests of the trusted proxies of cfg,
+// since anyone else could send it to dodge the IP lockout.
+func AppConfig(cfg config.Server) fiber.Config {
+	return fiber.Config{
+		ErrorHandler:            ErrorHandler,
+		ProxyHeader:             REAL_IP_HEADER,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxyList(),
+		EnableIPValidation:      true,
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/config"
+)
+
+func TestAppConfigClientIP(t *testing.T) {
+	clientIP := func(cfg config.Server, realIP string) string {
+		app := fiber.New(AppConfig(cfg))
+		app.Get("/ip", func(c *fiber.Ctx) error {
+			return c.SendString(c.IP())
+		})
+		req := httptest.NewRequest("GET", "/ip", nil)
+		req.Header.Set(REAL_IP_HEADER, realIP)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	// test requests come from 0.0.0.0
+	assert.Equal(t, "0.0.0.0", clientIP(config.Server{}, "203.0.113.7"))
+	assert.Equal(t, "0.0.0.0", clientIP(config.Server{TrustedProxies: "10.0.0.0/8"}, "203.0.113.7"))
+	assert.Equal(t, "203.0.113.7", clientIP(config.Server{TrustedProxies: "0.0.0.0"}, "203.0.113.7"))
+	assert.Equal(t, "0.0.0.0", clientIP(config.Server{TrustedProxies: "0.0.0.0"}, "not an ip"))
+}
@@ -1,27 +1,65 @@
 package api
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
-	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/mail"
+	"github.com/swarajroy/hotel-reservation/metrics"
 	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthHandler struct {
-	store *db.HotelReservationStore
+	store           *db.HotelReservationStore
+	signer          *TokenSigner
+	mailer          mail.Mailer
+	emailLockout    types.LockoutPolicy
+	ipLockout       types.LockoutPolicy
+	resetEmailLimit types.LockoutPolicy
+	resetIPLimit    types.LockoutPolicy
+	// background are the password reset mails still being sent
+	background sync.WaitGroup
 }
 
-func NewAuthHandler(store *db.HotelReservationStore) *AuthHandler {
+func NewAuthHandler(store *db.HotelReservationStore, signer *TokenSigner, mailer mail.Mailer) *AuthHandler {
 	return &AuthHandler{
-		store: store,
+		store:           store,
+		signer:          signer,
+		mailer:          mailer,
+		emailLockout:    types.DefaultEmailLockoutPolicy(),
+		ipLockout:       types.DefaultIPLockoutPolicy(),
+		resetEmailLimit: types.DefaultResetMailPolicy(),
+		resetIPLimit:    types.DefaultResetMailIPPolicy(),
+	}
+}
+
+// Drain waits until the password reset mails still being sent are done, or
+// until ctx is. It is run on shutdown, before the database is closed.
+func (auth *AuthHandler) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		auth.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for password reset mails: %w", ctx.Err())
 	}
 }
 
@@ -30,9 +68,31 @@ type AuthParams struct {
 	Password string `json:"password"`
 }
 
+const (
+	// mailTimeout bounds sending a mail outside of a request
+	mailTimeout      = 30 * time.Second
+	accessTokenTTL   = 15 * time.Minute
+	refreshTokenTTL  = 7 * 24 * time.Hour
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
 type AuthResponse struct {
-	User  *types.User `json:"user"`
-	Token string      `json:"token"`
+	User         *types.User `json:"user"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refreshToken"`
+}
+
+type RefreshParams struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type VerifyEmailParams struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordParams struct {
+	Email string `json:"email"`
 }
 
 type AuthErrorResponse struct {
@@ -47,50 +107,485 @@ func invalidCreds(c *fiber.Ctx) error {
 	})
 }
 
+// HandleAuth signs a user in. Failed logins are counted per email and per
+// client IP, and once either is locked out further logins are refused
+// before the password is even checked.
 func (auth *AuthHandler) HandleAuth(c *fiber.Ctx) error {
 	var params *AuthParams
 
 	if err := c.BodyParser(&params); err != nil {
-		log.Errorf("error occurred err = ", err)
 		return invalidCreds(c)
 	}
 
+	var (
+		now      = time.Now()
+		emailKey = types.EmailLockoutKey(params.Email)
+		ipKey    = types.IPLockoutKey(c.IP())
+	)
+	lockedUntil, err := auth.store.Lockout.LockedUntil(c.Context(), now, emailKey, ipKey)
+	if err != nil {
+		return err
+	}
+	if lockedUntil.After(now) {
+		metrics.FailedLogins.WithLabelValues(metrics.LOGIN_LOCKED_OUT).Inc()
+		return tooManyAttempts(c, lockedUntil.Sub(now))
+	}
+
 	user, err := auth.store.User.GetUserByEmail(c.Context(), params.Email)
 
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return invalidCreds(c)
+			return auth.failedLogin(c, emailKey, ipKey, now)
 		}
 		return err
 	}
 
 	if !types.IsValisPassword(user.EncryptedPassword, params.Password) {
-		return invalidCreds(c)
+		return auth.failedLogin(c, emailKey, ipKey, now)
+	}
+
+	if err := auth.store.Lockout.Reset(c.Context(), emailKey); err != nil {
+		return err
 	}
 
-	log.Info("authenticated user = ", user)
+	requestLogger(c).Info("user authenticated", "user", user)
+
+	if user.TOTPEnabled() {
+		return auth.totpChallenge(c, user)
+	}
 
-	authResp := AuthResponse{
-		User:  user,
-		Token: CreateTokenFromUser(user),
+	authResp, err := auth.newSession(c.Context(), user, false)
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(authResp)
 }
 
-func CreateTokenFromUser(u *types.User) string {
+func (auth *AuthHandler) failedLogin(c *fiber.Ctx, emailKey, ipKey string, now time.Time) error {
+	metrics.FailedLogins.WithLabelValues(metrics.LOGIN_INVALID_CREDENTIALS).Inc()
+	if _, err := auth.store.Lockout.RecordFailure(c.Context(), emailKey, auth.emailLockout, now); err != nil {
+		return err
+	}
+	if _, err := auth.store.Lockout.RecordFailure(c.Context(), ipKey, auth.ipLockout, now); err != nil {
+		return err
+	}
+	return invalidCreds(c)
+}
+
+func tooManyAttempts(c *fiber.Ctx, retryAfter time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return NewError(http.StatusTooManyRequests, "too many failed login attempts, try again later")
+}
+
+// HandleRegister lets a guest sign up and signs them in right away.
+func (auth *AuthHandler) HandleRegister(c *fiber.Ctx) error {
+	var params types.CreateUserParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
+
+	user, err := types.NewUserFromParams(params)
+	if err != nil {
+		return err
+	}
+	user, err = auth.store.User.InsertUser(c.Context(), user)
+	if err != nil {
+		return userConflict(err)
+	}
+	requestLogger(c).Info("user registered", "user", user)
+
+	if err := sendVerification(c.Context(), auth.store, auth.mailer, user); err != nil {
+		requestLogger(c).Error("sending the verification mail failed", "user", user, "error", err)
+	}
+
+	authResp, err := auth.newSession(c.Context(), user, false)
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusCreated).JSON(authResp)
+}
+
+// HandleVerifyEmail marks the email of the user a verification token was
+// mailed to as verified.
+func (auth *AuthHandler) HandleVerifyEmail(c *fiber.Ctx) error {
+	var params VerifyEmailParams
+	if err := c.BodyParser(&params); err != nil || len(params.Token) == 0 {
+		return ErrBadRequest()
+	}
+	token, err := auth.useOneTimeToken(c.Context(), params.Token, types.VERIFY_EMAIL)
+	if err != nil {
+		return err
+	}
+	// the email may have changed since the token was mailed
+	err = auth.store.User.VerifyEmail(c.Context(), token.UserID.Hex(), token.Email)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return NewError(http.StatusBadRequest, "invalid or expired token")
+	}
+	if err != nil {
+		return inventoryError(err)
+	}
+	user, err := auth.store.User.GetUserById(c.Context(), token.UserID.Hex())
+	if err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(user)
+}
+
+// HandleForgotPassword mails a password reset token to the user with the
+// email. It answers the same, and as fast, whether or not the email is
+// registered, so it can't be used to find out who has an account: the user
+// is looked up and mailed after the response. Requests are limited per email
+// and per client IP.
+func (auth *AuthHandler) HandleForgotPassword(c *fiber.Ctx) error {
+	var params ForgotPasswordParams
+	if err := c.BodyParser(&params); err != nil || len(params.Email) == 0 {
+		return ErrBadRequest()
+	}
+
+	var (
+		now             = time.Now()
+		emailKey, ipKey = types.ResetMailKeys(params.Email, c.IP())
+	)
+	lockedUntil, err := auth.store.Lockout.LockedUntil(c.Context(), now, emailKey, ipKey)
+	if err != nil {
+		return err
+	}
+	if lockedUntil.After(now) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockedUntil.Sub(now).Seconds()))))
+		return NewError(http.StatusTooManyRequests, "too many password reset requests, try again later")
+	}
+	if _, err := auth.store.Lockout.RecordFailure(c.Context(), emailKey, auth.resetEmailLimit, now); err != nil {
+		return err
+	}
+	if _, err := auth.store.Lockout.RecordFailure(c.Context(), ipKey, auth.resetIPLimit, now); err != nil {
+		return err
+	}
+
+	// the request context is reused once the handler returns
+	var (
+		email  = params.Email
+		logger = requestLogger(c)
+	)
+	auth.background.Add(1)
+	go func() {
+		defer auth.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := auth.sendPasswordReset(ctx, email); err != nil {
+			logger.Error("sending the password reset mail failed", "error", err)
+		}
+	}()
+	return c.Status(http.StatusAccepted).JSON(map[string]string{"status": "a password reset mail was sent if the email is registered"})
+}
+
+func (auth *AuthHandler) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := auth.store.User.GetUserByEmail(ctx, email)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return sendOneTimeToken(ctx, auth.store, auth.mailer, user, types.RESET_PASSWORD, resetPasswordTTL,
+		"Reset your password",
+		"Use this token to choose a new password within the next hour:\n\n%s\n\nIf you did not ask for a password reset you can ignore this mail.")
+}
+
+// HandleResetPassword sets a new password with a password reset token and
+// ends all sessions of the user.
+func (auth *AuthHandler) HandleResetPassword(c *fiber.Ctx) error {
+	var params types.ResetPasswordParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
+	token, err := auth.useOneTimeToken(c.Context(), params.Token, types.RESET_PASSWORD)
+	if err != nil {
+		return err
+	}
+	encpw, err := types.EncryptPassword(params.Password)
+	if err != nil {
+		return err
+	}
+	if err := auth.store.User.SetPassword(c.Context(), token.UserID.Hex(), encpw); err != nil {
+		return inventoryError(err)
+	}
+	if err := auth.store.Token.RevokeUserSessions(c.Context(), token.UserID, time.Now().Add(refreshTokenTTL)); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"Updated": token.UserID.Hex()})
+}
+
+// HandleChangePassword replaces the password of the authenticated user, who
+// has to give the current one. All sessions of the user end and a new one is
+// returned.
+func (auth *AuthHandler) HandleChangePassword(c *fiber.Ctx) error {
+	current, ok := c.Context().UserValue("user").(*types.User)
+	if !ok {
+		return ErrUnAuthenticated()
+	}
+	var params types.ChangePasswordParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
+
+	user, err := auth.store.User.GetUserById(c.Context(), current.ID.Hex())
+	if err != nil {
+		return ErrUnAuthenticated()
+	}
+	if err := checkPassword(c, auth.store, auth.emailLockout, user, params.CurrentPassword); err != nil {
+		return err
+	}
 	now := time.Now()
-	expires := now.Add(time.Hour * 3).Unix()
-	claims := jwt.MapClaims{
-		"id":      u.ID,
-		"email":   u.Email,
-		"expires": expires,
+
+	encpw, err := types.EncryptPassword(params.NewPassword)
+	if err != nil {
+		return err
+	}
+	if err := auth.store.User.SetPassword(c.Context(), user.ID.Hex(), encpw); err != nil {
+		return inventoryError(err)
+	}
+	if err := auth.store.Token.RevokeUserSessions(c.Context(), user.ID, now.Add(refreshTokenTTL)); err != nil {
+		return err
+	}
+
+	authResp, err := auth.newSession(c.Context(), user, sessionHasMFA(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(authResp)
+}
+
+// checkPassword compares password with the one of user, who is already
+// signed in. Wrong passwords count as failed logins of the user, since a
+// stolen access token must not allow guessing the password either.
+func checkPassword(c *fiber.Ctx, store *db.HotelReservationStore, policy types.LockoutPolicy, user *types.User, password string) error {
+	var (
+		now      = time.Now()
+		emailKey = types.EmailLockoutKey(user.Email)
+	)
+	lockedUntil, err := store.Lockout.LockedUntil(c.Context(), now, emailKey)
+	if err != nil {
+		return err
+	}
+	if lockedUntil.After(now) {
+		return tooManyAttempts(c, lockedUntil.Sub(now))
+	}
+	if !types.IsValisPassword(user.EncryptedPassword, password) {
+		if _, err := store.Lockout.RecordFailure(c.Context(), emailKey, policy, now); err != nil {
+			return err
+		}
+		return NewError(http.StatusForbidden, "the current password is wrong")
+	}
+	return nil
+}
+
+// HandleRefresh exchanges a refresh token for a new access token and a new
+// refresh token. Exchanging a refresh token twice means it was stolen, so the
+// whole session is revoked.
+func (auth *AuthHandler) HandleRefresh(c *fiber.Ctx) error {
+	var params RefreshParams
+	if err := c.BodyParser(&params); err != nil || len(params.RefreshToken) == 0 {
+		return ErrBadRequest()
+	}
+
+	var (
+		now           = time.Now()
+		refresh, hash = newOpaqueToken()
+		hashed        = hashToken(params.RefreshToken)
+		next          = &types.RefreshToken{
+			Hash:      hash,
+			CreatedAt: now,
+			ExpiresAt: now.Add(refreshTokenTTL),
+		}
+	)
+	token, err := auth.store.Token.RotateRefreshToken(c.Context(), hashed, next)
+	if err != nil {
+		var conflict db.ConflictError
+		if errors.As(err, &conflict) {
+			if used, err := auth.store.Token.GetRefreshToken(c.Context(), hashed); err == nil {
+				requestLogger(c).Warn("refresh token reused, revoking its session", "user_id", used.UserID.Hex(), "session_id", used.SessionID, "error", conflict)
+				if err := auth.store.Token.RevokeSession(c.Context(), used.SessionID, now.Add(refreshTokenTTL)); err != nil {
+					return err
+				}
+			}
+			return NewError(http.StatusUnauthorized, "refresh token revoked")
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return NewError(http.StatusUnauthorized, "invalid refresh token")
+		}
+		return err
+	}
+
+	user, err := auth.store.User.GetUserById(c.Context(), token.UserID.Hex())
+	if err != nil {
+		return ErrUnAuthenticated()
+	}
+	access, err := createAccessToken(auth.signer, user, token.SessionID, token.MFA)
+	if err != nil {
+		return err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secret := os.Getenv("JWT_SECRET")
-	tokenStr, err := token.SignedString([]byte(secret))
+	return c.JSON(AuthResponse{
+		User:         user,
+		Token:        access,
+		RefreshToken: refresh,
+	})
+}
+
+// HandleLogout ends the session of the access token in X-Api-Token. Its
+// access and refresh tokens stop working immediately.
+func (auth *AuthHandler) HandleLogout(c *fiber.Ctx) error {
+	claims, err := auth.signer.Verify(c.Get("X-Api-Token"))
 	if err != nil {
-		fmt.Println("failed to sign token with secret = ", err)
+		return ErrUnAuthenticated()
+	}
+
+	if jti, ok := claims["jti"].(string); ok {
+		if err := auth.store.Token.Revoke(c.Context(), jti, time.Now().Add(accessTokenTTL)); err != nil {
+			return err
+		}
+	}
+	if sid, ok := claims["sid"].(string); ok && len(sid) > 0 {
+		if err := auth.store.Token.RevokeSession(c.Context(), sid, time.Now().Add(refreshTokenTTL)); err != nil {
+			return err
+		}
+	}
+	return c.JSON(map[string]string{"msg": "logged out"})
+}
+
+// newSession starts a session for user with a fresh access and refresh token.
+// mfa tells whether the user gave a second factor.
+func (auth *AuthHandler) newSession(ctx context.Context, user *types.User, mfa bool) (*AuthResponse, error) {
+	var (
+		now           = time.Now()
+		refresh, hash = newOpaqueToken()
+		token         = &types.RefreshToken{
+			Hash:      hash,
+			UserID:    user.ID,
+			SessionID: newTokenID(),
+			CreatedAt: now,
+			ExpiresAt: now.Add(refreshTokenTTL),
+			MFA:       mfa,
+		}
+	)
+	if _, err := auth.store.Token.InsertRefreshToken(ctx, token); err != nil {
+		return nil, err
+	}
+	access, err := createAccessToken(auth.signer, user, token.SessionID, mfa)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResponse{
+		User:         user,
+		Token:        access,
+		RefreshToken: refresh,
+	}, nil
+}
+
+func sendVerification(ctx context.Context, store *db.HotelReservationStore, mailer mail.Mailer, user *types.User) error {
+	return sendOneTimeToken(ctx, store, mailer, user, types.VERIFY_EMAIL, verifyEmailTTL,
+		"Verify your email",
+		"Use this token to verify your email within the next 48 hours:\n\n%s")
+}
+
+// sendOneTimeToken mails a new one-time token for purpose to the user. The
+// body is a format with a %s for the token.
+func sendOneTimeToken(ctx context.Context, store *db.HotelReservationStore, mailer mail.Mailer, user *types.User, purpose types.TokenPurpose, ttl time.Duration, subject, body string) error {
+	secret, _, err := newOneTimeToken(ctx, store, user, purpose, ttl)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf(body, secret),
+	})
+}
+
+// newOneTimeToken stores a new one-time token for purpose and returns it
+// along with its record.
+func newOneTimeToken(ctx context.Context, store *db.HotelReservationStore, user *types.User, purpose types.TokenPurpose, ttl time.Duration) (string, *types.OneTimeToken, error) {
+	var (
+		now          = time.Now()
+		secret, hash = newOpaqueToken()
+		token        = &types.OneTimeToken{
+			Hash:      hash,
+			UserID:    user.ID,
+			Email:     user.Email,
+			Purpose:   purpose,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ttl),
+		}
+	)
+	if _, err := store.Token.InsertOneTimeToken(ctx, token); err != nil {
+		return "", nil, err
+	}
+	return secret, token, nil
+}
+
+func (auth *AuthHandler) useOneTimeToken(ctx context.Context, secret string, purpose types.TokenPurpose) (*types.OneTimeToken, error) {
+	token, err := auth.store.Token.UseOneTimeToken(ctx, hashToken(secret), purpose)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, NewError(http.StatusBadRequest, "invalid or expired token")
+	}
+	return token, err
+}
+
+// newOpaqueToken returns a random refresh or one-time token and the hash it
+// is stored under.
+func newOpaqueToken() (string, string) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// CreateTokenFromUser returns an access token for u that is not tied to a
+// session, so it can only be revoked by its jti.
+func CreateTokenFromUser(signer *TokenSigner, u *types.User) (string, error) {
+	return createAccessToken(signer, u, "", false)
+}
+
+// createAccessToken returns an access token for u. Its amr claim lists how
+// the user authenticated: with a password, and with a TOTP code when mfa is
+// set.
+func createAccessToken(signer *TokenSigner, u *types.User, sessionID string, mfa bool) (string, error) {
+	amr := []string{"pwd"}
+	if mfa {
+		amr = append(amr, "otp")
+	}
+	claims := jwt.MapClaims{
+		"sub":   u.ID.Hex(),
+		"email": u.Email,
+		"jti":   newTokenID(),
+		"amr":   amr,
+	}
+	if len(sessionID) > 0 {
+		claims["sid"] = sessionID
 	}
-	return tokenStr
+	return signer.Sign(claims, accessTokenTTL)
 }
@@ -4,16 +4,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-faker/faker/v4"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/suite"
 	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/db/fixtures"
 	"github.com/swarajroy/hotel-reservation/db/mongo"
+	"github.com/swarajroy/hotel-reservation/mail"
+	"github.com/swarajroy/hotel-reservation/types"
 	userfixtures "github.com/swarajroy/hotel-reservation/types/user_fixtures"
 )
 
@@ -34,13 +41,16 @@ func (suite *AuthHandlerSuite) SetupSuite() {
 	}
 
 	suite.testMongoClient = client
-	userStore := db.NewMongoDbUserStore(suite.testMongoClient.Client, DB_NAME)
-	hotelStore := db.NewMongoDbHotelStore(suite.testMongoClient.Client, DB_NAME)
-	roomStore := db.NewMongoDbRoomStore(suite.testMongoClient.Client, DB_NAME, hotelStore)
-	bookingStore := db.NewMongoDbBookingStore(suite.testMongoClient.Client, DB_NAME)
-	store := db.NewHotelReservationStore(userStore, hotelStore, roomStore, bookingStore)
+	userStore := db.NewMongoDbUserStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	hotelStore := db.NewMongoDbHotelStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	roomStore := db.NewMongoDbRoomStore(suite.testMongoClient.Client, suite.testMongoClient.Config(), hotelStore)
+	bookingStore := db.NewMongoDbBookingStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	tokenStore := db.NewMongoDbTokenStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	lockoutStore := db.NewMongoDbLockoutStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	apiKeyStore := db.NewMongoDbAPIKeyStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	store := db.NewHotelReservationStore(userStore, hotelStore, roomStore, bookingStore, tokenStore, lockoutStore, apiKeyStore)
 	suite.store = store
-	suite.authHandler = NewAuthHandler(suite.store)
+	suite.authHandler = NewAuthHandler(suite.store, newTestTokenSigner(suite.T()), mail.NewLogMailer(io.Discard))
 }
 
 func (suite *AuthHandlerSuite) TearDownSuite() {
@@ -156,3 +166,524 @@ func (suite *AuthHandlerSuite) TestHandleAuthenticateFailure() {
 func TestAuthHandlerSuite(t *testing.T) {
 	suite.Run(t, new(AuthHandlerSuite))
 }
+
+// testMailer keeps the mails it is asked to send.
+type testMailer struct {
+	sent []mail.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// lastToken returns the token mailed last, which is on its own line.
+func (m *testMailer) lastToken() string {
+	if len(m.sent) == 0 {
+		return ""
+	}
+	lines := strings.Split(m.sent[len(m.sent)-1].Body, "\n")
+	return lines[2]
+}
+
+type SessionSuite struct {
+	suite.Suite
+	tdb    *testdb
+	app    *fiber.App
+	auth   *AuthHandler
+	mailer *testMailer
+}
+
+func (suite *SessionSuite) SetupTest() {
+	suite.tdb = Setup(suite.T(), context.Background())
+	suite.mailer = &testMailer{}
+
+	var (
+		signer      = newTestTokenSigner(suite.T())
+		authHandler = NewAuthHandler(suite.tdb.store, signer, suite.mailer)
+	)
+	suite.auth = authHandler
+	suite.app = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	suite.app.Post("/auth", authHandler.HandleAuth)
+	suite.app.Post("/auth/register", authHandler.HandleRegister)
+	suite.app.Post("/auth/verify", authHandler.HandleVerifyEmail)
+	suite.app.Post("/auth/forgot-password", authHandler.HandleForgotPassword)
+	suite.app.Post("/auth/reset-password", authHandler.HandleResetPassword)
+	suite.app.Post("/users/:id/unlock", NewUserHandler(suite.tdb.store, suite.mailer).HandleUnlockUser)
+	suite.app.Post("/auth/refresh", authHandler.HandleRefresh)
+	suite.app.Post("/auth/logout", authHandler.HandleLogout)
+	suite.app.Post("/users/me/password", JWTAuthentication(suite.tdb.store, signer), authHandler.HandleChangePassword)
+	suite.app.Post("/users/me/totp", JWTAuthentication(suite.tdb.store, signer), authHandler.HandleEnrollTOTP)
+	suite.app.Post("/users/me/totp/confirm", JWTAuthentication(suite.tdb.store, signer), authHandler.HandleConfirmTOTP)
+	suite.app.Post("/auth/totp", authHandler.HandleTOTPLogin)
+	suite.app.Get("/admin", JWTAuthentication(suite.tdb.store, signer), AdminAuth, func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+	suite.app.Patch("/users/:id", JWTAuthentication(suite.tdb.store, signer), NewUserHandler(suite.tdb.store, suite.mailer).HandlePatchUser)
+	bookingHandler := NewBookingHandler(suite.tdb.store, types.DefaultCancellationPolicy())
+	suite.app.Get("/bookings/:id", JWTAuthentication(suite.tdb.store, signer), bookingHandler.HandleGetBooking)
+	suite.app.Patch("/bookings/:id", JWTAuthentication(suite.tdb.store, signer), bookingHandler.HandlePatchBooking)
+	suite.app.Delete("/bookings/:id", JWTAuthentication(suite.tdb.store, signer), bookingHandler.HandleDeleteBooking)
+	suite.app.Get("/me", JWTAuthentication(suite.tdb.store, signer), func(c *fiber.Ctx) error {
+		return c.JSON(c.Context().UserValue("user"))
+	})
+}
+
+func (suite *SessionSuite) TearDownTest() {
+	suite.tdb.TearDown(suite.T(), context.Background())
+}
+
+func (suite *SessionSuite) post(url, token string, body any, out any) int {
+	return suite.send("POST", url, token, body, out)
+}
+
+func (suite *SessionSuite) send(method, url, token string, body any, out any) int {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Api-Token", token)
+	resp, err := suite.app.Test(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	if out != nil && resp.StatusCode/100 == 2 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			suite.T().Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func (suite *SessionSuite) me(token string) int {
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Add("X-Api-Token", token)
+	resp, err := suite.app.Test(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func (suite *SessionSuite) login() AuthResponse {
+	fixtures.AddUser(suite.tdb.store, "james", "foo", false)
+
+	var session AuthResponse
+	status := suite.post("/auth", "", AuthParams{Email: "james_foo@foo.com", Password: "james_foo"}, &session)
+	suite.Equal(http.StatusOK, status)
+	suite.NotEmpty(session.Token)
+	suite.NotEmpty(session.RefreshToken)
+	return session
+}
+
+func (suite *SessionSuite) TestRefreshRotatesTokens() {
+	session := suite.login()
+
+	var refreshed AuthResponse
+	status := suite.post("/auth/refresh", "", RefreshParams{RefreshToken: session.RefreshToken}, &refreshed)
+	suite.Equal(http.StatusOK, status)
+	suite.NotEqual(session.RefreshToken, refreshed.RefreshToken)
+	suite.Equal(http.StatusOK, suite.me(refreshed.Token))
+
+	// the replaced refresh token was stolen: using it ends the session
+	status = suite.post("/auth/refresh", "", RefreshParams{RefreshToken: session.RefreshToken}, nil)
+	suite.Equal(http.StatusUnauthorized, status)
+	suite.Equal(http.StatusUnauthorized, suite.me(refreshed.Token))
+
+	status = suite.post("/auth/refresh", "", RefreshParams{RefreshToken: refreshed.RefreshToken}, nil)
+	suite.Equal(http.StatusUnauthorized, status)
+}
+
+func (suite *SessionSuite) TestLogoutRevokesSession() {
+	session := suite.login()
+	suite.Equal(http.StatusOK, suite.me(session.Token))
+
+	status := suite.post("/auth/logout", session.Token, nil, nil)
+	suite.Equal(http.StatusOK, status)
+
+	suite.Equal(http.StatusUnauthorized, suite.me(session.Token))
+	status = suite.post("/auth/refresh", "", RefreshParams{RefreshToken: session.RefreshToken}, nil)
+	suite.Equal(http.StatusUnauthorized, status)
+}
+
+func (suite *SessionSuite) TestRefreshWithUnknownToken() {
+	status := suite.post("/auth/refresh", "", RefreshParams{RefreshToken: "unknown"}, nil)
+
+	suite.Equal(http.StatusUnauthorized, status)
+}
+
+func (suite *SessionSuite) TestRegister() {
+	params := types.CreateUserParams{
+		FirstName: "james",
+		LastName:  "foo",
+		Email:     "james@foo.com",
+		Password:  "supersecret",
+	}
+
+	var session AuthResponse
+	status := suite.post("/auth/register", "", params, &session)
+	suite.Equal(http.StatusCreated, status)
+	suite.Equal(params.Email, session.User.Email)
+	suite.Equal(types.GUEST, session.User.EffectiveRole())
+	suite.Equal(http.StatusOK, suite.me(session.Token))
+
+	status = suite.post("/auth/register", "", params, nil)
+	suite.Equal(http.StatusConflict, status)
+
+	params.Email = "james"
+	status = suite.post("/auth/register", "", params, nil)
+	suite.Equal(http.StatusBadRequest, status)
+}
+
+func (suite *SessionSuite) TestVerifyEmail() {
+	var session AuthResponse
+	status := suite.post("/auth/register", "", types.CreateUserParams{
+		FirstName: "james",
+		LastName:  "foo",
+		Email:     "james@foo.com",
+		Password:  "supersecret",
+	}, &session)
+	suite.Equal(http.StatusCreated, status)
+	suite.False(session.User.EmailVerified)
+	suite.Len(suite.mailer.sent, 1)
+	suite.Equal("james@foo.com", suite.mailer.sent[0].To)
+
+	token := suite.mailer.lastToken()
+	status = suite.post("/auth/reset-password", "", types.ResetPasswordParams{Token: token, Password: "newsecret"}, nil)
+	suite.Equal(http.StatusBadRequest, status)
+
+	var user types.User
+	status = suite.post("/auth/verify", "", VerifyEmailParams{Token: token}, &user)
+	suite.Equal(http.StatusOK, status)
+	suite.True(user.EmailVerified)
+
+	status = suite.post("/auth/verify", "", VerifyEmailParams{Token: token}, nil)
+	suite.Equal(http.StatusBadRequest, status)
+}
+
+func (suite *SessionSuite) TestVerifyEmailAfterEmailChange() {
+	var session AuthResponse
+	status := suite.post("/auth/register", "", types.CreateUserParams{
+		FirstName: "james",
+		LastName:  "foo",
+		Email:     "james@foo.com",
+		Password:  "supersecret",
+	}, &session)
+	suite.Equal(http.StatusCreated, status)
+	firstToken := suite.mailer.lastToken()
+
+	// the token mailed to the first address must not verify the new one
+	victim := "alice@bar.com"
+	status = suite.send("PATCH", "/users/"+session.User.ID.Hex(), session.Token, types.UpdateUserParams{Email: &victim, CurrentPassword: "supersecret"}, nil)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(victim, suite.mailer.sent[len(suite.mailer.sent)-1].To)
+
+	status = suite.post("/auth/verify", "", VerifyEmailParams{Token: firstToken}, nil)
+	suite.Equal(http.StatusBadRequest, status)
+	user, err := suite.tdb.store.User.GetUserById(context.Background(), session.User.ID.Hex())
+	suite.Nil(err)
+	suite.False(user.EmailVerified)
+
+	var verified types.User
+	status = suite.post("/auth/verify", "", VerifyEmailParams{Token: suite.mailer.lastToken()}, &verified)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(victim, verified.Email)
+	suite.True(verified.EmailVerified)
+}
+
+func (suite *SessionSuite) TestResetPassword() {
+	session := suite.login()
+
+	status := suite.post("/auth/forgot-password", "", ForgotPasswordParams{Email: "nobody@foo.com"}, nil)
+	suite.Equal(http.StatusAccepted, status)
+	suite.Nil(suite.auth.Drain(context.Background()))
+	suite.Empty(suite.mailer.sent)
+
+	status = suite.post("/auth/forgot-password", "", ForgotPasswordParams{Email: "james_foo@foo.com"}, nil)
+	suite.Equal(http.StatusAccepted, status)
+	suite.Nil(suite.auth.Drain(context.Background()))
+	suite.Len(suite.mailer.sent, 1)
+	token := suite.mailer.lastToken()
+
+	status = suite.post("/auth/reset-password", "", types.ResetPasswordParams{Token: token, Password: "short"}, nil)
+	suite.Equal(http.StatusBadRequest, status)
+	status = suite.post("/auth/reset-password", "", types.ResetPasswordParams{Token: token, Password: "newsecret"}, nil)
+	suite.Equal(http.StatusOK, status)
+	status = suite.post("/auth/reset-password", "", types.ResetPasswordParams{Token: token, Password: "newsecret"}, nil)
+	suite.Equal(http.StatusBadRequest, status)
+
+	// the reset ends the sessions that were open with the old password
+	suite.Equal(http.StatusUnauthorized, suite.me(session.Token))
+	status = suite.post("/auth/refresh", "", RefreshParams{RefreshToken: session.RefreshToken}, nil)
+	suite.Equal(http.StatusUnauthorized, status)
+
+	status = suite.post("/auth", "", AuthParams{Email: "james_foo@foo.com", Password: "james_foo"}, nil)
+	suite.Equal(http.StatusBadRequest, status)
+	status = suite.post("/auth", "", AuthParams{Email: "james_foo@foo.com", Password: "newsecret"}, nil)
+	suite.Equal(http.StatusOK, status)
+}
+
+func (suite *SessionSuite) TestForgotPasswordLimit() {
+	fixtures.AddUser(suite.tdb.store, "james", "foo", false)
+
+	// unknown emails are limited the same, so the limit tells nothing
+	for _, email := range []string{"james_foo@foo.com", "nobody@foo.com"} {
+		for i := 0; i <= types.DefaultResetMailPolicy().FreeAttempts; i++ {
+			suite.Equal(http.StatusAccepted, suite.post("/auth/forgot-password", "", ForgotPasswordParams{Email: email}, nil))
+		}
+		suite.Equal(http.StatusTooManyRequests, suite.post("/auth/forgot-password", "", ForgotPasswordParams{Email: email}, nil))
+	}
+	suite.Nil(suite.auth.Drain(context.Background()))
+	suite.Len(suite.mailer.sent, types.DefaultResetMailPolicy().FreeAttempts+1)
+}
+
+func (suite *SessionSuite) TestForgotPasswordLimitPerIP() {
+	for i := 0; i <= types.DefaultResetMailIPPolicy().FreeAttempts; i++ {
+		params := ForgotPasswordParams{Email: fmt.Sprintf("user%d@foo.com", i)}
+		suite.Equal(http.StatusAccepted, suite.post("/auth/forgot-password", "", params, nil))
+	}
+	status := suite.post("/auth/forgot-password", "", ForgotPasswordParams{Email: "james_foo@foo.com"}, nil)
+	suite.Equal(http.StatusTooManyRequests, status)
+	suite.Nil(suite.auth.Drain(context.Background()))
+}
+
+func (suite *SessionSuite) TestLoginLockout() {
+	var (
+		user   = fixtures.AddUser(suite.tdb.store, "james", "foo", false)
+		wrong  = AuthParams{Email: "james_foo@foo.com", Password: "wrong"}
+		right  = AuthParams{Email: "james_foo@foo.com", Password: "james_foo"}
+		policy = types.DefaultEmailLockoutPolicy()
+	)
+	for i := 0; i <= policy.FreeAttempts; i++ {
+		suite.Equal(http.StatusBadRequest, suite.post("/auth", "", wrong, nil))
+	}
+
+	b, _ := json.Marshal(right)
+	req := httptest.NewRequest("POST", "/auth", bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := suite.app.Test(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	suite.Equal("30", resp.Header.Get("Retry-After"))
+
+	suite.Equal(http.StatusOK, suite.post("/users/"+user.ID.Hex()+"/unlock", "", nil, nil))
+	suite.Equal(http.StatusOK, suite.post("/auth", "", right, nil))
+}
+
+func (suite *SessionSuite) TestLoginLockoutPerIP() {
+	fixtures.AddUser(suite.tdb.store, "james", "foo", false)
+
+	// guessing a different email every time still locks the client out
+	for i := 0; i <= types.DefaultIPLockoutPolicy().FreeAttempts; i++ {
+		params := AuthParams{Email: fmt.Sprintf("user%d@foo.com", i), Password: "wrong"}
+		suite.Equal(http.StatusBadRequest, suite.post("/auth", "", params, nil))
+	}
+
+	status := suite.post("/auth", "", AuthParams{Email: "james_foo@foo.com", Password: "james_foo"}, nil)
+	suite.Equal(http.StatusTooManyRequests, status)
+}
+
+func (suite *SessionSuite) TestChangePassword() {
+	session := suite.login()
+
+	status := suite.post("/users/me/password", session.Token, types.ChangePasswordParams{CurrentPassword: "wrong", NewPassword: "newsecret"}, nil)
+	suite.Equal(http.StatusForbidden, status)
+	status = suite.post("/users/me/password", session.Token, types.ChangePasswordParams{CurrentPassword: "james_foo", NewPassword: "short"}, nil)
+	suite.Equal(http.StatusBadRequest, status)
+
+	var changed AuthResponse
+	status = suite.post("/users/me/password", session.Token, types.ChangePasswordParams{CurrentPassword: "james_foo", NewPassword: "newsecret"}, &changed)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(http.StatusOK, suite.me(changed.Token))
+
+	// the sessions opened with the old password have ended
+	suite.Equal(http.StatusUnauthorized, suite.me(session.Token))
+	status = suite.post("/auth/refresh", "", RefreshParams{RefreshToken: session.RefreshToken}, nil)
+	suite.Equal(http.StatusUnauthorized, status)
+
+	status = suite.post("/auth", "", AuthParams{Email: "james_foo@foo.com", Password: "newsecret"}, nil)
+	suite.Equal(http.StatusOK, status)
+}
+
+// get requests url with the token and returns the status.
+func (suite *SessionSuite) get(url, token string) int {
+	req := httptest.NewRequest("GET", url, nil)
+	req.Header.Add("X-Api-Token", token)
+	resp, err := suite.app.Test(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+// enableTOTP enrols and confirms a second factor for the user of session.
+func (suite *SessionSuite) enableTOTP(session AuthResponse) (*types.TOTP, TOTPEnrollmentResponse, AuthResponse) {
+	var enrollment TOTPEnrollmentResponse
+	suite.Equal(http.StatusOK, suite.post("/users/me/totp", session.Token, nil, &enrollment))
+	suite.Len(enrollment.RecoveryCodes, types.RECOVERY_CODES)
+
+	totp := &types.TOTP{Secret: enrollment.Secret}
+	code, err := totp.Code(time.Now())
+	suite.Nil(err)
+	var confirmed AuthResponse
+	suite.Equal(http.StatusOK, suite.post("/users/me/totp/confirm", session.Token, types.TOTPCodeParams{Code: code}, &confirmed))
+	return totp, enrollment, confirmed
+}
+
+func (suite *SessionSuite) challenge(params AuthParams) string {
+	var challenge AuthChallengeResponse
+	suite.Equal(http.StatusAccepted, suite.post("/auth", "", params, &challenge))
+	suite.NotEmpty(challenge.Challenge)
+	return challenge.Challenge
+}
+
+func (suite *SessionSuite) TestTOTPLogin() {
+	var (
+		session             = suite.login()
+		creds               = AuthParams{Email: "james_foo@foo.com", Password: "james_foo"}
+		totp, enrollment, _ = suite.enableTOTP(session)
+	)
+	usedCode, err := totp.Code(time.Now())
+	suite.Nil(err)
+
+	// a wrong code uses up the challenge
+	challenge := suite.challenge(creds)
+	suite.Equal(http.StatusUnauthorized, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: "000000"}, nil))
+	suite.Equal(http.StatusBadRequest, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: usedCode}, nil))
+
+	// the code confirming the enrollment can't be replayed
+	challenge = suite.challenge(creds)
+	suite.Equal(http.StatusUnauthorized, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: usedCode}, nil))
+
+	var signedIn AuthResponse
+	challenge = suite.challenge(creds)
+	status := suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: enrollment.RecoveryCodes[0]}, &signedIn)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(http.StatusOK, suite.me(signedIn.Token))
+
+	challenge = suite.challenge(creds)
+	suite.Equal(http.StatusUnauthorized, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: enrollment.RecoveryCodes[0]}, nil))
+}
+
+func (suite *SessionSuite) TestChangeEmailNeedsSecondFactor() {
+	var (
+		session = suite.login()
+		url     = "/users/" + session.User.ID.Hex()
+		email   = "jimmy@foo.com"
+	)
+	totp, _, confirmed := suite.enableTOTP(session)
+
+	status := suite.send("PATCH", url, confirmed.Token, types.UpdateUserParams{Email: &email, CurrentPassword: "james_foo"}, nil)
+	suite.Equal(http.StatusForbidden, status)
+	status = suite.send("PATCH", url, confirmed.Token, types.UpdateUserParams{Email: &email, CurrentPassword: "james_foo", Code: "000000"}, nil)
+	suite.Equal(http.StatusUnauthorized, status)
+
+	code, err := totp.Code(time.Now().Add(30 * time.Second))
+	suite.Nil(err)
+	status = suite.send("PATCH", url, confirmed.Token, types.UpdateUserParams{Email: &email, CurrentPassword: "james_foo", Code: code}, nil)
+	suite.Equal(http.StatusOK, status)
+}
+
+func (suite *SessionSuite) TestTOTPLockout() {
+	var (
+		session = suite.login()
+		creds   = AuthParams{Email: "james_foo@foo.com", Password: "james_foo"}
+		policy  = types.DefaultEmailLockoutPolicy()
+	)
+	totp, _, _ := suite.enableTOTP(session)
+
+	// signing in with the password again doesn't forget the wrong codes
+	for i := 0; i <= policy.FreeAttempts; i++ {
+		challenge := suite.challenge(creds)
+		suite.Equal(http.StatusUnauthorized, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: "000000"}, nil))
+	}
+	code, err := totp.Code(time.Now().Add(30 * time.Second))
+	suite.Nil(err)
+	challenge := suite.challenge(creds)
+	suite.Equal(http.StatusTooManyRequests, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: code}, nil))
+}
+
+func (suite *SessionSuite) TestTOTPLockoutPerIP() {
+	var (
+		session = suite.login()
+		creds   = AuthParams{Email: "james_foo@foo.com", Password: "james_foo"}
+	)
+	suite.enableTOTP(session)
+
+	challenges := make([]string, types.DefaultIPLockoutPolicy().FreeAttempts+2)
+	for i := range challenges {
+		challenges[i] = suite.challenge(creds)
+	}
+	// wrong codes lock the client IP out even when the user is unlocked
+	last := len(challenges) - 1
+	for _, challenge := range challenges[:last] {
+		suite.Nil(suite.tdb.store.Lockout.Reset(context.Background(), types.TOTPLockoutKey(session.User.ID.Hex())))
+		suite.Equal(http.StatusUnauthorized, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: "000000"}, nil))
+	}
+	suite.Nil(suite.tdb.store.Lockout.Reset(context.Background(), types.TOTPLockoutKey(session.User.ID.Hex())))
+	suite.Equal(http.StatusTooManyRequests, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenges[last], Code: "000000"}, nil))
+}
+
+func (suite *SessionSuite) TestAdminWithTOTPNeedsSecondFactor() {
+	var (
+		admin  = fixtures.AddUser(suite.tdb.store, "admin", "admin", true)
+		creds  = AuthParams{Email: "admin_admin@foo.com", Password: "admin_admin"}
+		signer = newTestTokenSigner(suite.T())
+	)
+	var session AuthResponse
+	suite.Equal(http.StatusOK, suite.post("/auth", "", creds, &session))
+	suite.Equal(http.StatusOK, suite.get("/admin", session.Token))
+
+	_, enrollment, confirmed := suite.enableTOTP(session)
+	suite.Equal(http.StatusForbidden, suite.get("/admin", session.Token))
+	suite.Equal(http.StatusForbidden, suite.get("/admin", testToken(suite.T(), signer, admin)))
+	suite.Equal(http.StatusOK, suite.get("/admin", confirmed.Token))
+
+	// refreshing keeps the second factor of the session
+	var refreshed AuthResponse
+	suite.Equal(http.StatusOK, suite.post("/auth/refresh", "", RefreshParams{RefreshToken: confirmed.RefreshToken}, &refreshed))
+	suite.Equal(http.StatusOK, suite.get("/admin", refreshed.Token))
+
+	var signedIn AuthResponse
+	challenge := suite.challenge(creds)
+	suite.Equal(http.StatusOK, suite.post("/auth/totp", "", types.TOTPLoginParams{Challenge: challenge, Code: enrollment.RecoveryCodes[1]}, &signedIn))
+	suite.Equal(http.StatusOK, suite.get("/admin", signedIn.Token))
+}
+
+func (suite *SessionSuite) TestAdminOverridesNeedSecondFactor() {
+	var (
+		store   = suite.tdb.store
+		guest   = fixtures.AddUser(store, "james", "foo", false)
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room    = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, hotel.ID)
+		from    = time.Now().AddDate(0, 0, 5)
+		booking = fixtures.AddBooking(store, guest.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+		creds   = AuthParams{Email: "admin_admin@foo.com", Password: "admin_admin"}
+		email   = "james@bar.com"
+		patch   = types.UpdateBookingParams{FromDate: from, TillDate: from.AddDate(0, 0, 1), NumPersons: 1}
+	)
+	fixtures.AddUser(store, "admin", "admin", true)
+	var session AuthResponse
+	suite.Equal(http.StatusOK, suite.post("/auth", "", creds, &session))
+	_, enrollment, confirmed := suite.enableTOTP(session)
+	update := types.UpdateUserParams{Email: &email, CurrentPassword: creds.Password, Code: enrollment.RecoveryCodes[0]}
+
+	// a token without the second factor can't act on other users' records
+	suite.Equal(http.StatusForbidden, suite.send("PATCH", "/users/"+guest.ID.Hex(), session.Token, update, nil))
+	suite.Equal(http.StatusUnauthorized, suite.get("/bookings/"+booking.ID.Hex(), session.Token))
+	suite.Equal(http.StatusForbidden, suite.send("PATCH", "/bookings/"+booking.ID.Hex(), session.Token, patch, nil))
+	suite.Equal(http.StatusForbidden, suite.send("DELETE", "/bookings/"+booking.ID.Hex(), session.Token, nil, nil))
+	user, err := store.User.GetUserById(context.Background(), guest.ID.Hex())
+	suite.Nil(err)
+	suite.NotEqual(email, user.Email)
+
+	suite.Equal(http.StatusOK, suite.send("PATCH", "/users/"+guest.ID.Hex(), confirmed.Token, update, nil))
+	suite.Equal(http.StatusOK, suite.get("/bookings/"+booking.ID.Hex(), confirmed.Token))
+	suite.Equal(http.StatusOK, suite.send("PATCH", "/bookings/"+booking.ID.Hex(), confirmed.Token, patch, nil))
+	suite.Equal(http.StatusOK, suite.send("DELETE", "/bookings/"+booking.ID.Hex(), confirmed.Token, nil, nil))
+}
+
+func TestSessionSuite(t *testing.T) {
+	suite.Run(t, new(SessionSuite))
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const dateLayout = "2006-01-02"
+
+type AvailabilityHandler struct {
+	store *db.HotelReservationStore
+}
+
+func NewAvailabilityHandler(store *db.HotelReservationStore) *AvailabilityHandler {
+	return &AvailabilityHandler{
+		store: store,
+	}
+}
+
+type AvailabilityQueryParams struct {
+	From   string `query:"from"`
+	Till   string `query:"till"`
+	Guests int    `query:"guests"`
+	db.Pagination
+}
+
+// RoomTypeAvailability lists the free rooms of one type together with the
+// lowest nightly price among them.
+type RoomTypeAvailability struct {
+	Type      types.RoomType `json:"type"`
+	Available int            `json:"available"`
+	Price     float64        `json:"price"`
+	Rooms     []*types.Room  `json:"rooms"`
+}
+
+type HotelAvailability struct {
+	Hotel    *types.Hotel           `json:"hotel"`
+	FromDate time.Time              `json:"fromDate"`
+	TillDate time.Time              `json:"tillDate"`
+	Rooms    []RoomTypeAvailability `json:"rooms"`
+}
+
+type stayQuery struct {
+	from   time.Time
+	till   time.Time
+	guests int
+}
+
+func parseStayQuery(params AvailabilityQueryParams) (stayQuery, map[string]string) {
+	var (
+		query = stayQuery{guests: params.Guests}
+		errs  = map[string]string{}
+		err   error
+	)
+	if query.from, err = parseDate(params.From); err != nil {
+		errs["from"] = err.Error()
+	}
+	if query.till, err = parseDate(params.Till); err != nil {
+		errs["till"] = err.Error()
+	}
+	if len(errs) == 0 && !types.StayDay(query.till).After(types.StayDay(query.from)) {
+		errs["till"] = "till should be at least one night after from"
+	}
+	if query.guests == 0 {
+		query.guests = 1
+	}
+	if query.guests < 0 {
+		errs["guests"] = "guests should be a positive number"
+	}
+	return query, errs
+}
+
+// parseDate accepts either a plain date or an RFC 3339 timestamp.
+func parseDate(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, fmt.Errorf("date is required")
+	}
+	if t, err := time.Parse(dateLayout, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date %s should be formatted as %s", s, dateLayout)
+	}
+	return t, nil
+}
+
+// roomFilter matches the rooms that sleep the guests as adults and can be
+// booked for the number of nights of the stay. Rooms stored without
+// maxAdults fall back to the capacity of their type.
+func (q stayQuery) roomFilter() bson.M {
+	nights := types.Nights(q.from, q.till)
+	return bson.M{
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"maxAdults": bson.M{"$gte": q.guests}},
+				bson.M{"maxAdults": bson.M{"$exists": false}, "type": bson.M{"$in": types.RoomTypesFor(q.guests)}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"minStay": bson.M{"$exists": false}},
+				bson.M{"minStay": bson.M{"$lte": nights}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"maxStay": bson.M{"$exists": false}},
+				bson.M{"maxStay": 0},
+				bson.M{"maxStay": bson.M{"$gte": nights}},
+			}},
+		},
+	}
+}
+
+func (h *AvailabilityHandler) HandleGetHotelAvailability(c *fiber.Ctx) error {
+	var params AvailabilityQueryParams
+	if err := c.QueryParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	query, errs := parseStayQuery(params)
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(errs)
+	}
+
+	hotel, err := h.store.Hotel.GetHotelById(c.Context(), c.Params("id"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrResourceNotFound()
+		}
+		return ErrInvalidId()
+	}
+
+	filter := query.roomFilter()
+	filter["hotelId"] = hotel.ID
+	rooms, err := h.store.Room.GetAvailableRooms(c.Context(), filter, query.from, query.till)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(HotelAvailability{
+		Hotel:    hotel,
+		FromDate: query.from,
+		TillDate: query.till,
+		Rooms:    groupByRoomType(rooms),
+	})
+}
+
+func (h *AvailabilityHandler) HandleSearchAvailability(c *fiber.Ctx) error {
+	var params AvailabilityQueryParams
+	if err := c.QueryParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	query, errs := parseStayQuery(params)
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(errs)
+	}
+
+	rooms, err := h.store.Room.GetAvailableRooms(c.Context(), query.roomFilter(), query.from, query.till)
+	if err != nil {
+		return err
+	}
+
+	roomsByHotel := map[primitive.ObjectID][]*types.Room{}
+	hotelIDs := []primitive.ObjectID{}
+	for _, room := range rooms {
+		if _, ok := roomsByHotel[room.HotelID]; !ok {
+			hotelIDs = append(hotelIDs, room.HotelID)
+		}
+		roomsByHotel[room.HotelID] = append(roomsByHotel[room.HotelID], room)
+	}
+
+	if params.Page == 0 {
+		params.Page = 1
+	}
+	hotels, err := h.store.Hotel.GetHotels(c.Context(), bson.M{"_id": bson.M{"$in": hotelIDs}}, &params.Pagination)
+	if err != nil {
+		return err
+	}
+
+	results := make([]HotelAvailability, 0, len(hotels))
+	for _, hotel := range hotels {
+		results = append(results, HotelAvailability{
+			Hotel:    hotel,
+			FromDate: query.from,
+			TillDate: query.till,
+			Rooms:    groupByRoomType(roomsByHotel[hotel.ID]),
+		})
+	}
+	return c.JSON(ResourceResponse{
+		Results: len(results),
+		Data:    results,
+		Page:    int(params.Page),
+	})
+}
+
+func groupByRoomType(rooms []*types.Room) []RoomTypeAvailability {
+	byType := map[types.RoomType]*RoomTypeAvailability{}
+	for _, room := range rooms {
+		group, ok := byType[room.Type]
+		if !ok {
+			group = &RoomTypeAvailability{Type: room.Type, Price: room.Price}
+			byType[room.Type] = group
+		}
+		group.Available++
+		group.Rooms = append(group.Rooms, room)
+		if room.Price < group.Price {
+			group.Price = room.Price
+		}
+	}
+	groups := make([]RoomTypeAvailability, 0, len(byType))
+	for _, group := range byType {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Type < groups[j].Type
+	})
+	return groups
+}
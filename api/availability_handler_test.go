@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"github.com/swarajroy/hotel-reservation/db/fixtures"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+type AvailabilityHandlerSuite struct {
+	suite.Suite
+	tdb *testdb
+}
+
+func (suite *AvailabilityHandlerSuite) SetupTest() {
+	suite.tdb = Setup(suite.T(), context.Background())
+}
+
+func (suite *AvailabilityHandlerSuite) TearDownTest() {
+	suite.tdb.TearDown(suite.T(), context.Background())
+}
+
+func (suite *AvailabilityHandlerSuite) TestHotelAvailabilityExcludesBookedRooms() {
+	var (
+		store   = suite.tdb.store
+		user    = fixtures.AddUser(store, "james", "foo", false)
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		single  = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, hotel.ID)
+		_       = fixtures.AddRoom(store, types.DOUBLE, 149.99, 159.99, hotel.ID)
+		_       = fixtures.AddRoom(store, types.DOUBLE, 149.99, 139.99, hotel.ID)
+		from    = time.Now().AddDate(0, 0, 10)
+		app     = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		handler = NewAvailabilityHandler(store)
+	)
+	fixtures.AddBooking(store, user.ID, single.ID, from, from.AddDate(0, 0, 3), time.Time{}, 1)
+	app.Get("/:id/availability", handler.HandleGetHotelAvailability)
+
+	url := fmt.Sprintf("/%s/availability?from=%s&till=%s&guests=1",
+		hotel.ID.Hex(), from.AddDate(0, 0, 1).Format(dateLayout), from.AddDate(0, 0, 2).Format(dateLayout))
+	resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	var availability HotelAvailability
+	if err := json.NewDecoder(resp.Body).Decode(&availability); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Len(availability.Rooms, 1)
+	suite.Equal(types.DOUBLE, availability.Rooms[0].Type)
+	suite.Equal(2, availability.Rooms[0].Available)
+	suite.Equal(139.99, availability.Rooms[0].Price)
+}
+
+func (suite *AvailabilityHandlerSuite) TestSearchAvailabilityAcrossHotels() {
+	var (
+		store   = suite.tdb.store
+		london  = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		paris   = fixtures.AddHotel(store, "foo hotel", "paris", nil)
+		_       = fixtures.AddHotel(store, "empty hotel", "rome", nil)
+		_       = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, london.ID)
+		_       = fixtures.AddRoom(store, types.DELUXE, 299.99, 299.99, paris.ID)
+		from    = time.Now().AddDate(0, 0, 10)
+		app     = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		handler = NewAvailabilityHandler(store)
+	)
+	app.Get("/availability", handler.HandleSearchAvailability)
+
+	url := fmt.Sprintf("/availability?from=%s&till=%s&guests=3",
+		from.Format(dateLayout), from.AddDate(0, 0, 2).Format(dateLayout))
+	resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Results int                 `json:"results"`
+		Data    []HotelAvailability `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(1, result.Results)
+	suite.Equal(paris.ID, result.Data[0].Hotel.ID)
+	suite.Equal(types.DELUXE, result.Data[0].Rooms[0].Type)
+}
+
+func (suite *AvailabilityHandlerSuite) TestSearchAvailabilityForMoreGuestsThanAnyRoomType() {
+	var (
+		store   = suite.tdb.store
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		_       = fixtures.AddRoom(store, types.DELUXE, 299.99, 299.99, hotel.ID)
+		from    = time.Now().AddDate(0, 0, 10)
+		app     = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		handler = NewAvailabilityHandler(store)
+	)
+	app.Get("/availability", handler.HandleSearchAvailability)
+
+	url := fmt.Sprintf("/availability?from=%s&till=%s&guests=5",
+		from.Format(dateLayout), from.AddDate(0, 0, 2).Format(dateLayout))
+	resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Results int `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(0, result.Results)
+
+	// MongoDB refuses an $in without an array, which the memory store
+	// doesn't check
+	raw, err := bson.Marshal(stayQuery{from: from, till: from.AddDate(0, 0, 2), guests: 5}.roomFilter())
+	suite.Nil(err)
+	inTypes := bson.Raw(raw).Lookup("$and", "0", "$or", "1", "type", "$in")
+	suite.Equal(bsontype.Array, inTypes.Type)
+}
+
+func (suite *AvailabilityHandlerSuite) TestAvailabilityRequiresDates() {
+	var (
+		app     = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		handler = NewAvailabilityHandler(suite.tdb.store)
+	)
+	app.Get("/availability", handler.HandleSearchAvailability)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/availability?from=2030-01-02&till=2030-01-02", nil))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAvailabilityHandlerSuite(t *testing.T) {
+	suite.Run(t, new(AvailabilityHandlerSuite))
+}
@@ -1,36 +1,151 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/metrics"
 	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type BookingHandler struct {
-	store *db.HotelReservationStore
+	store  *db.HotelReservationStore
+	policy types.CancellationPolicy
 }
 
-func NewBookingHandler(store *db.HotelReservationStore) *BookingHandler {
+func NewBookingHandler(store *db.HotelReservationStore, policy types.CancellationPolicy) *BookingHandler {
 	return &BookingHandler{
-		store: store,
+		store:  store,
+		policy: policy,
 	}
 }
 
 // This needs to be admin authorised
 func (bh *BookingHandler) HandleGetBookings(c *fiber.Ctx) error {
-	bookings, err := bh.store.Booking.GetBookings(c.Context(), bson.M{})
+	bookings, err := bh.store.Booking.GetBookings(c.Context(), bson.M{}, nil)
 	if err != nil {
 		return nil
 	}
 	return c.JSON(bookings)
 }
 
+const (
+	BookingStatusUpcoming  = "upcoming"
+	BookingStatusPast      = "past"
+	BookingStatusCancelled = "cancelled"
+)
+
+type BookingQueryParams struct {
+	// Status is one of upcoming (not cancelled and not checked out yet), past
+	// (not cancelled and checked out) or cancelled. Empty lists all bookings.
+	Status string `query:"status"`
+	// From and Till restrict the listing to stays sharing a night with from..till.
+	From string `query:"from"`
+	Till string `query:"till"`
+	db.Pagination
+}
+
+// filter builds the bookings filter of the query within scope, e.g. the
+// bookings of a user.
+func (params BookingQueryParams) filter(scope bson.M, now time.Time) (bson.M, map[string]string) {
+	var (
+		errs       = map[string]string{}
+		conditions = bson.A{scope}
+	)
+	switch params.Status {
+	case "":
+	case BookingStatusUpcoming:
+		conditions = append(conditions, bson.M{"cancelledAt": bson.M{"$exists": false}, "tillDate": bson.M{"$gt": now}})
+	case BookingStatusPast:
+		conditions = append(conditions, bson.M{"cancelledAt": bson.M{"$exists": false}, "tillDate": bson.M{"$lte": now}})
+	case BookingStatusCancelled:
+		conditions = append(conditions, bson.M{"cancelledAt": bson.M{"$exists": true}})
+	default:
+		errs["status"] = fmt.Sprintf("status should be one of %s, %s or %s", BookingStatusUpcoming, BookingStatusPast, BookingStatusCancelled)
+	}
+	if len(params.From) > 0 {
+		from, err := parseDate(params.From)
+		if err != nil {
+			errs["from"] = err.Error()
+		} else {
+			// checking out on from shares no night with the range
+			conditions = append(conditions, bson.M{"tillDate": bson.M{"$gte": types.StayDay(from).AddDate(0, 0, 1)}})
+		}
+	}
+	if len(params.Till) > 0 {
+		till, err := parseDate(params.Till)
+		if err != nil {
+			errs["till"] = err.Error()
+		} else {
+			conditions = append(conditions, bson.M{"fromDate": bson.M{"$lt": types.StayDay(till)}})
+		}
+	}
+	if params.Page < 0 {
+		errs["page"] = "page should be a positive number"
+	}
+	if params.Limit < 0 {
+		errs["limit"] = "limit should be a positive number"
+	}
+	return bson.M{"$and": conditions}, errs
+}
+
+// HandleGetUserBookings lists the bookings of the authenticated user.
+func (bh *BookingHandler) HandleGetUserBookings(c *fiber.Ctx) error {
+	user, ok := c.Context().UserValue("user").(*types.User)
+	if !ok {
+		return ErrUnAuthenticated()
+	}
+	return bh.listBookings(c, bson.M{"userID": user.ID})
+}
+
+// HandleGetHotelBookings lists the bookings of the rooms of a hotel for its
+// staff.
+func (bh *BookingHandler) HandleGetHotelBookings(c *fiber.Ctx) error {
+	hotel, err := bh.store.Hotel.GetHotelById(c.Context(), c.Params("id"))
+	if err != nil {
+		return inventoryError(err)
+	}
+	rooms, err := bh.store.Room.GetRooms(c.Context(), bson.M{"hotelId": hotel.ID})
+	if err != nil {
+		return err
+	}
+	roomIDs := []primitive.ObjectID{}
+	for _, room := range rooms {
+		roomIDs = append(roomIDs, room.ID)
+	}
+	return bh.listBookings(c, bson.M{"roomID": bson.M{"$in": roomIDs}})
+}
+
+func (bh *BookingHandler) listBookings(c *fiber.Ctx, scope bson.M) error {
+	var params BookingQueryParams
+	if err := c.QueryParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	filter, errs := params.filter(scope, time.Now())
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(errs)
+	}
+	if params.Page == 0 {
+		params.Page = 1
+	}
+	bookings, err := bh.store.Booking.GetBookings(c.Context(), filter, &params.Pagination)
+	if err != nil {
+		return err
+	}
+	return c.JSON(ResourceResponse{
+		Results: len(bookings),
+		Data:    bookings,
+		Page:    int(params.Page),
+	})
+}
+
 // This needs to be user authorised
 func (bh *BookingHandler) HandleGetBooking(c *fiber.Ctx) error {
 	booking, err := bh.store.Booking.GetBooking(c.Context(), c.Params("id"))
@@ -42,7 +157,11 @@ func (bh *BookingHandler) HandleGetBooking(c *fiber.Ctx) error {
 		return err
 	}
 
-	if booking.UserID != user.ID {
+	staff, err := bh.isHotelStaff(c, user, types.READ_BOOKINGS, booking)
+	if err != nil {
+		return err
+	}
+	if booking.UserID != user.ID && !staff {
 		return c.Status(http.StatusUnauthorized).JSON(AuthErrorResponse{
 			Status: http.StatusUnauthorized,
 			Msg:    "error",
@@ -52,33 +171,180 @@ func (bh *BookingHandler) HandleGetBooking(c *fiber.Ctx) error {
 	return c.JSON(booking)
 }
 
+// HandleDeleteBooking cancels a booking. Owners are bound by the cancellation
+// policy, staff allowed to manage the hotel's bookings cancel free of charge.
 func (bh *BookingHandler) HandleDeleteBooking(c *fiber.Ctx) error {
 	booking, err := bh.store.Booking.GetBooking(c.Context(), c.Params("id"))
+	if err != nil {
+		return ErrResourceNotFound()
+	}
+	user, ok := c.Context().UserValue("user").(*types.User)
+	if !ok {
+		return ErrUnAuthenticated()
+	}
+	staff, err := bh.isHotelStaff(c, user, types.MANAGE_BOOKINGS, booking)
 	if err != nil {
 		return err
 	}
+	if booking.UserID != user.ID && !staff {
+		return ErrUnAuthorized()
+	}
+	if !booking.CancelledAt.IsZero() {
+		return NewError(http.StatusConflict, "booking is already cancelled")
+	}
+
+	var params types.CancelBookingParams
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&params); err != nil {
+			return ErrBadRequest()
+		}
+	}
+
+	cancellation := types.Cancellation{
+		At:     time.Now(),
+		By:     user.ID,
+		Reason: params.Reason,
+	}
+	if !staff {
+		stayPrice, err := bh.stayPrice(c.Context(), booking)
+		if err != nil {
+			return err
+		}
+		fee, err := bh.policy.Fee(booking, stayPrice, cancellation.At)
+		if err != nil {
+			return NewError(http.StatusUnprocessableEntity, err.Error())
+		}
+		cancellation.Fee = fee
+	}
+
+	if err := bh.store.Booking.CancelBooking(c.Context(), booking.ID.Hex(), cancellation); err != nil {
+		var conflict db.ConflictError
+		if errors.As(err, &conflict) {
+			return NewError(http.StatusConflict, conflict.Error())
+		}
+		return err
+	}
+	if staff {
+		metrics.BookingsCancelled.WithLabelValues("staff").Inc()
+	} else {
+		metrics.BookingsCancelled.WithLabelValues("guest").Inc()
+	}
+
+	booking, err = bh.store.Booking.GetBooking(c.Context(), booking.ID.Hex())
+	if err != nil {
+		return err
+	}
+	return c.JSON(booking)
+}
+
+// HandlePatchBooking changes the dates, the number of persons or the room of
+// a booking. The new room must be in the same hotel as the booked one. Once
+// the free cancellation is over, owners can neither move the dates nor make
+// the stay cheaper, which would dodge the late fee.
+func (bh *BookingHandler) HandlePatchBooking(c *fiber.Ctx) error {
+	booking, err := bh.store.Booking.GetBooking(c.Context(), c.Params("id"))
+	if err != nil {
+		return ErrResourceNotFound()
+	}
 	user, ok := c.Context().UserValue("user").(*types.User)
-	log.Info("user = ", user)
 	if !ok {
-		return fmt.Errorf("not authorized")
+		return ErrUnAuthenticated()
+	}
+	staff, err := bh.isHotelStaff(c, user, types.MANAGE_BOOKINGS, booking)
+	if err != nil {
+		return err
+	}
+	if booking.UserID != user.ID && !staff {
+		return ErrUnAuthorized()
+	}
+	if !booking.CancelledAt.IsZero() {
+		return NewError(http.StatusConflict, "booking is cancelled")
 	}
 
-	fmt.Printf("user = %+v\n", user)
-	fmt.Printf("booking = %+v\n", booking)
-	if !user.IsAdmin {
-		log.Error("illegal action as user trying to cancel a booking that does not belong to him/her or user is not an admin")
-		return c.Status(http.StatusForbidden).JSON(AuthErrorResponse{
-			Status: http.StatusForbidden,
-			Msg:    "error",
-		})
+	var params types.UpdateBookingParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
 	}
-	update := map[string]any{
-		"cancelledAt": time.Now(),
+	stay, roomID, err := params.Apply(*booking)
+	if err != nil {
+		return NewError(http.StatusBadRequest, err.Error())
+	}
+
+	room, err := bh.store.Room.GetRoomById(c.Context(), roomID.Hex())
+	if err != nil {
+		return inventoryError(err)
+	}
+	if roomID != booking.RoomID {
+		current, err := bh.store.Room.GetRoomById(c.Context(), booking.RoomID.Hex())
+		if err != nil {
+			return inventoryError(err)
+		}
+		if current.HotelID != room.HotelID {
+			return NewError(http.StatusBadRequest, "a booking can only be moved to a room of the same hotel")
+		}
+	}
+	if errors := stay.Validate(room); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
 	}
-	if err := bh.store.Booking.UpdateBookingById(c.Context(), c.Params("id"), update); err != nil {
+
+	modified := types.NewBookingFromParams(stay, booking.UserID, room.ID)
+	modified.ID = booking.ID
+	modified.Price = booking.Price
+	// a changed stay is quoted again at the current rates
+	if modified.Price == nil || modified.RoomID != booking.RoomID || modified.NumPersons != booking.NumPersons ||
+		!modified.FromDate.Equal(booking.FromDate) || !modified.TillDate.Equal(booking.TillDate) {
+		hotel, err := bh.store.Hotel.GetHotelById(c.Context(), room.HotelID.Hex())
+		if err != nil {
+			return inventoryError(err)
+		}
+		modified.Price = hotel.Quote(room, modified.FromDate, modified.TillDate, modified.NumPersons)
+	}
+	if !staff && bh.policy.Late(booking, time.Now()) {
+		stayPrice, err := bh.stayPrice(c.Context(), booking)
+		if err != nil {
+			return err
+		}
+		if !modified.FromDate.Equal(booking.FromDate) || !modified.TillDate.Equal(booking.TillDate) || modified.Price.Total < stayPrice {
+			return NewError(http.StatusConflict, fmt.Sprintf("bookings can only be changed until %s before check-in", bh.policy.FreeUntil))
+		}
+	}
+
+	if err := bh.store.Booking.ModifyBooking(c.Context(), modified); err != nil {
+		var conflict db.ConflictError
+		if errors.As(err, &conflict) {
+			metrics.BookingConflicts.WithLabelValues("modify").Inc()
+			return NewError(http.StatusConflict, conflict.Error())
+		}
 		return err
 	}
-	return c.JSON(map[string]string{
-		"msg": "updated",
-	})
+	return c.JSON(modified)
+}
+
+// isHotelStaff reports whether user has permission for the hotel of the
+// booked room.
+func (bh *BookingHandler) isHotelStaff(c *fiber.Ctx, user *types.User, permission types.Permission, booking *types.Booking) (bool, error) {
+	if canOverride(c, user, permission, primitive.NilObjectID) {
+		return true, nil
+	}
+	if !user.EffectiveRole().Has(permission) || secondFactorMissing(c, user) {
+		return false, nil
+	}
+	room, err := bh.store.Room.GetRoomById(c.Context(), booking.RoomID.Hex())
+	if err != nil {
+		return false, err
+	}
+	return canOverride(c, user, permission, room.HotelID), nil
+}
+
+// stayPrice is the price the booking was made at. Bookings made before they
+// were priced fall back to the room's current rate.
+func (bh *BookingHandler) stayPrice(ctx context.Context, booking *types.Booking) (float64, error) {
+	if booking.Price != nil {
+		return booking.Price.Total, nil
+	}
+	room, err := bh.store.Room.GetRoomById(ctx, booking.RoomID.Hex())
+	if err != nil {
+		return 0, err
+	}
+	return room.Price * float64(types.Nights(booking.FromDate, booking.TillDate)), nil
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"github.com/swarajroy/hotel-reservation/db/fixtures"
 	"github.com/swarajroy/hotel-reservation/db/mongo"
 	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type BookingHandlerSuite struct {
@@ -34,13 +36,16 @@ func (suite *BookingHandlerSuite) SetupSuite() {
 	}
 
 	suite.testMongoClient = client
-	userStore := db.NewMongoDbUserStore(suite.testMongoClient.Client, DB_NAME)
-	hotelStore := db.NewMongoDbHotelStore(suite.testMongoClient.Client, DB_NAME)
-	roomStore := db.NewMongoDbRoomStore(suite.testMongoClient.Client, DB_NAME, hotelStore)
-	bookingStore := db.NewMongoDbBookingStore(suite.testMongoClient.Client, DB_NAME)
-	store := db.NewHotelReservationStore(userStore, hotelStore, roomStore, bookingStore)
+	userStore := db.NewMongoDbUserStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	hotelStore := db.NewMongoDbHotelStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	roomStore := db.NewMongoDbRoomStore(suite.testMongoClient.Client, suite.testMongoClient.Config(), hotelStore)
+	bookingStore := db.NewMongoDbBookingStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	tokenStore := db.NewMongoDbTokenStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	lockoutStore := db.NewMongoDbLockoutStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	apiKeyStore := db.NewMongoDbAPIKeyStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	store := db.NewHotelReservationStore(userStore, hotelStore, roomStore, bookingStore, tokenStore, lockoutStore, apiKeyStore)
 	suite.store = store
-	suite.bookingHandler = NewBookingHandler(store)
+	suite.bookingHandler = NewBookingHandler(store, types.DefaultCancellationPolicy())
 }
 
 func (suite *BookingHandlerSuite) TearDownSuite() {
@@ -64,15 +69,16 @@ func (suite *BookingHandlerSuite) TestAdminUserGetBookingsSuccessful() {
 		room           = fixtures.AddRoom(suite.store, types.SINGLE, 99.99, 99.99, hotel.ID)
 		booking        = fixtures.AddBooking(suite.store, user.ID, room.ID, time.Now(), time.Now().AddDate(0, 0, 5), time.Time{}, 2)
 		app            = fiber.New()
-		admin          = app.Group("/", JWTAuthentication(suite.store), AdminAuth)
-		bookingHandler = NewBookingHandler(suite.store)
+		signer         = newTestTokenSigner(suite.T())
+		admin          = app.Group("/", JWTAuthentication(suite.store, signer), AdminAuth)
+		bookingHandler = NewBookingHandler(suite.store, types.DefaultCancellationPolicy())
 	)
 
 	_ = booking
 
 	admin.Get("/", bookingHandler.HandleGetBookings)
 	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Add("X-Api-Token", CreateTokenFromUser(admin_user))
+	req.Header.Add("X-Api-Token", testToken(suite.T(), signer, admin_user))
 	resp, err := app.Test(req)
 
 	if err != nil {
@@ -100,15 +106,16 @@ func (suite *BookingHandlerSuite) TestNormalUserGetBookingsFail() {
 		room           = fixtures.AddRoom(suite.store, types.SINGLE, 99.99, 99.99, hotel.ID)
 		booking        = fixtures.AddBooking(suite.store, user.ID, room.ID, time.Now(), time.Now().AddDate(0, 0, 5), time.Time{}, 2)
 		app            = fiber.New()
-		admin          = app.Group("/", JWTAuthentication(suite.store), AdminAuth)
-		bookingHandler = NewBookingHandler(suite.store)
+		signer         = newTestTokenSigner(suite.T())
+		admin          = app.Group("/", JWTAuthentication(suite.store, signer), AdminAuth)
+		bookingHandler = NewBookingHandler(suite.store, types.DefaultCancellationPolicy())
 	)
 
 	_ = booking
 
 	admin.Get("/", bookingHandler.HandleGetBookings)
 	req := httptest.NewRequest("GET", "/", nil)
-	req.Header.Add("X-Api-Token", CreateTokenFromUser(user))
+	req.Header.Add("X-Api-Token", testToken(suite.T(), signer, user))
 	resp, err := app.Test(req)
 
 	if err != nil {
@@ -127,15 +134,16 @@ func (suite *BookingHandlerSuite) TestNormalUserGetBookingSuccess() {
 		room           = fixtures.AddRoom(suite.store, types.SINGLE, 99.99, 99.99, hotel.ID)
 		booking        = fixtures.AddBooking(suite.store, user.ID, room.ID, time.Now(), time.Now().AddDate(0, 0, 5), time.Time{}, 2)
 		app            = fiber.New()
-		userRoute      = app.Group("/", JWTAuthentication(suite.store))
-		bookingHandler = NewBookingHandler(suite.store)
+		signer         = newTestTokenSigner(suite.T())
+		userRoute      = app.Group("/", JWTAuthentication(suite.store, signer))
+		bookingHandler = NewBookingHandler(suite.store, types.DefaultCancellationPolicy())
 	)
 
 	_ = booking
 
 	userRoute.Get("/:id", bookingHandler.HandleGetBooking)
 	req := httptest.NewRequest("GET", fmt.Sprintf("/%s", booking.ID.Hex()), nil)
-	req.Header.Add("X-Api-Token", CreateTokenFromUser(user))
+	req.Header.Add("X-Api-Token", testToken(suite.T(), signer, user))
 	resp, err := app.Test(req)
 
 	if err != nil {
@@ -152,3 +160,299 @@ func (suite *BookingHandlerSuite) TestNormalUserGetBookingSuccess() {
 	}
 	fmt.Println(returnedBooking)
 }
+
+type GuestBookingSuite struct {
+	suite.Suite
+	tdb *testdb
+}
+
+func (suite *GuestBookingSuite) SetupTest() {
+	suite.tdb = Setup(suite.T(), context.Background())
+}
+
+func (suite *GuestBookingSuite) TearDownTest() {
+	suite.tdb.TearDown(suite.T(), context.Background())
+}
+
+func (suite *GuestBookingSuite) cancel(user *types.User, booking *types.Booking, reason string) (*http.Response, *types.Booking) {
+	var (
+		app            = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		bookingHandler = NewBookingHandler(suite.tdb.store, types.CancellationPolicy{FreeUntil: 48 * time.Hour, LateFee: 0.5, AllowLate: true})
+	)
+	app.Delete("/:id", withUser(user), bookingHandler.HandleDeleteBooking)
+
+	b, _ := json.Marshal(types.CancelBookingParams{Reason: reason})
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/%s", booking.ID.Hex()), bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	var cancelled types.Booking
+	if err := json.NewDecoder(resp.Body).Decode(&cancelled); err != nil {
+		suite.T().Fatal(err)
+	}
+	return resp, &cancelled
+}
+
+func (suite *GuestBookingSuite) TestOwnerCancelsFreeOfCharge() {
+	var (
+		store   = suite.tdb.store
+		user    = fixtures.AddUser(store, "james", "foo", false)
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room    = fixtures.AddRoom(store, types.SINGLE, 99.99, 100, hotel.ID)
+		from    = time.Now().AddDate(0, 0, 10)
+		booking = fixtures.AddBooking(store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+	)
+
+	resp, cancelled := suite.cancel(user, booking, "change of plans")
+
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.False(cancelled.CancelledAt.IsZero())
+	suite.Equal(user.ID, cancelled.CancelledBy)
+	suite.Equal("change of plans", cancelled.CancellationReason)
+	suite.Equal(0.0, cancelled.CancellationFee)
+
+	resp, _ = suite.cancel(user, booking, "again")
+	suite.Equal(http.StatusConflict, resp.StatusCode)
+}
+
+func (suite *GuestBookingSuite) TestOwnerPaysLateFee() {
+	var (
+		store   = suite.tdb.store
+		user    = fixtures.AddUser(store, "james", "foo", false)
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room    = fixtures.AddRoom(store, types.SINGLE, 99.99, 100, hotel.ID)
+		from    = time.Now().Add(24 * time.Hour)
+		booking = fixtures.AddBooking(store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+	)
+
+	resp, cancelled := suite.cancel(user, booking, "")
+
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal(100.0, cancelled.CancellationFee)
+}
+
+func (suite *GuestBookingSuite) TestOtherUserCannotCancel() {
+	var (
+		store   = suite.tdb.store
+		user    = fixtures.AddUser(store, "james", "foo", false)
+		other   = fixtures.AddUser(store, "alice", "bar", false)
+		admin   = fixtures.AddUser(store, "admin", "admin", true)
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room    = fixtures.AddRoom(store, types.SINGLE, 99.99, 100, hotel.ID)
+		from    = time.Now().Add(24 * time.Hour)
+		booking = fixtures.AddBooking(store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+	)
+
+	resp, _ := suite.cancel(other, booking, "")
+	suite.Equal(http.StatusForbidden, resp.StatusCode)
+
+	resp, cancelled := suite.cancel(admin, booking, "overbooked")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal(admin.ID, cancelled.CancelledBy)
+	suite.Equal(0.0, cancelled.CancellationFee)
+}
+
+func (suite *GuestBookingSuite) list(user *types.User, query string) (int, []types.Booking) {
+	var (
+		app            = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		bookingHandler = NewBookingHandler(suite.tdb.store, types.DefaultCancellationPolicy())
+	)
+	app.Get("/bookings", withUser(user), bookingHandler.HandleGetUserBookings)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/bookings?"+query, nil))
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	var result struct {
+		Results int             `json:"results"`
+		Data    []types.Booking `json:"data"`
+		Page    int             `json:"page"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(len(result.Data), result.Results)
+	return resp.StatusCode, result.Data
+}
+
+func (suite *GuestBookingSuite) TestListUserBookings() {
+	var (
+		store     = suite.tdb.store
+		user      = fixtures.AddUser(store, "james", "foo", false)
+		other     = fixtures.AddUser(store, "alice", "bar", false)
+		hotel     = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room      = fixtures.AddRoom(store, types.SINGLE, 99.99, 100, hotel.ID)
+		now       = time.Now()
+		past      = fixtures.AddBooking(store, user.ID, room.ID, now.AddDate(0, 0, -10), now.AddDate(0, 0, -8), time.Time{}, 1)
+		later     = fixtures.AddBooking(store, user.ID, room.ID, now.AddDate(0, 0, 20), now.AddDate(0, 0, 22), time.Time{}, 1)
+		soon      = fixtures.AddBooking(store, user.ID, room.ID, now.AddDate(0, 0, 5), now.AddDate(0, 0, 7), time.Time{}, 1)
+		cancelled = fixtures.AddBooking(store, user.ID, room.ID, now.AddDate(0, 0, 10), now.AddDate(0, 0, 12), now, 1)
+		_         = fixtures.AddBooking(store, other.ID, room.ID, now.AddDate(0, 0, 30), now.AddDate(0, 0, 32), time.Time{}, 1)
+		ids       = func(bookings []types.Booking) []primitive.ObjectID {
+			var ids []primitive.ObjectID
+			for _, booking := range bookings {
+				ids = append(ids, booking.ID)
+			}
+			return ids
+		}
+	)
+
+	status, bookings := suite.list(user, "")
+	suite.Equal(http.StatusOK, status)
+	suite.Equal([]primitive.ObjectID{past.ID, soon.ID, cancelled.ID, later.ID}, ids(bookings))
+
+	_, bookings = suite.list(user, "status=upcoming")
+	suite.Equal([]primitive.ObjectID{soon.ID, later.ID}, ids(bookings))
+
+	_, bookings = suite.list(user, "status=past")
+	suite.Equal([]primitive.ObjectID{past.ID}, ids(bookings))
+
+	_, bookings = suite.list(user, "status=cancelled")
+	suite.Equal([]primitive.ObjectID{cancelled.ID}, ids(bookings))
+
+	_, bookings = suite.list(user, fmt.Sprintf("from=%s&till=%s",
+		now.AddDate(0, 0, 6).Format(dateLayout), now.AddDate(0, 0, 21).Format(dateLayout)))
+	suite.Equal([]primitive.ObjectID{soon.ID, cancelled.ID, later.ID}, ids(bookings))
+
+	_, bookings = suite.list(user, "limit=2&page=2")
+	suite.Equal([]primitive.ObjectID{cancelled.ID, later.ID}, ids(bookings))
+
+	status, _ = suite.list(user, "status=soon")
+	suite.Equal(http.StatusBadRequest, status)
+}
+
+func (suite *GuestBookingSuite) TestListUserBookingsSharingANight() {
+	var (
+		store = suite.tdb.store
+		user  = fixtures.AddUser(store, "james", "foo", false)
+		hotel = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room  = fixtures.AddRoom(store, types.SINGLE, 99.99, 100, hotel.ID)
+		from  = types.StayDay(time.Now()).AddDate(0, 0, 10)
+		till  = from.AddDate(0, 0, 3)
+		// checks out on from and checks in on till, sharing no night
+		_    = fixtures.AddBooking(store, user.ID, room.ID, from.AddDate(0, 0, -2).Add(15*time.Hour), from.Add(11*time.Hour), time.Time{}, 1)
+		_    = fixtures.AddBooking(store, user.ID, room.ID, till.Add(15*time.Hour), till.AddDate(0, 0, 2).Add(11*time.Hour), time.Time{}, 1)
+		stay = fixtures.AddBooking(store, user.ID, room.ID, from.AddDate(0, 0, -1).Add(15*time.Hour), from.AddDate(0, 0, 1).Add(11*time.Hour), time.Time{}, 1)
+	)
+
+	_, bookings := suite.list(user, fmt.Sprintf("from=%s&till=%s", from.Format(dateLayout), till.Format(dateLayout)))
+	suite.Len(bookings, 1)
+	suite.Equal(stay.ID, bookings[0].ID)
+}
+
+func (suite *GuestBookingSuite) patch(user *types.User, booking *types.Booking, params types.UpdateBookingParams) (int, *types.Booking) {
+	var (
+		app            = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		bookingHandler = NewBookingHandler(suite.tdb.store, types.DefaultCancellationPolicy())
+	)
+	app.Patch("/:id", withUser(user), bookingHandler.HandlePatchBooking)
+
+	b, _ := json.Marshal(params)
+	req := httptest.NewRequest("PATCH", fmt.Sprintf("/%s", booking.ID.Hex()), bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	var modified types.Booking
+	if err := json.NewDecoder(resp.Body).Decode(&modified); err != nil {
+		suite.T().Fatal(err)
+	}
+	return resp.StatusCode, &modified
+}
+
+func (suite *GuestBookingSuite) TestModifyBooking() {
+	var (
+		ctx     = context.Background()
+		store   = suite.tdb.store
+		user    = fixtures.AddUser(store, "james", "foo", false)
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		other   = fixtures.AddHotel(store, "foo hotel", "paris", nil)
+		room    = fixtures.AddRoom(store, types.DOUBLE, 99.99, 100, hotel.ID)
+		spare   = fixtures.AddRoom(store, types.DOUBLE, 99.99, 100, hotel.ID)
+		abroad  = fixtures.AddRoom(store, types.DOUBLE, 99.99, 100, other.ID)
+		from    = types.StayDay(time.Now()).AddDate(0, 0, 10)
+		booking = fixtures.AddBooking(store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+		_       = fixtures.AddBooking(store, user.ID, room.ID, from.AddDate(0, 0, 5), from.AddDate(0, 0, 7), time.Time{}, 1)
+	)
+
+	status, modified := suite.patch(user, booking, types.UpdateBookingParams{TillDate: from.AddDate(0, 0, 4), NumPersons: 2})
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(from.AddDate(0, 0, 4), modified.TillDate.UTC())
+	suite.Equal(2, modified.NumPersons)
+
+	status, _ = suite.patch(user, booking, types.UpdateBookingParams{TillDate: from.AddDate(0, 0, 6)})
+	suite.Equal(http.StatusConflict, status)
+
+	stored, err := store.Booking.GetBooking(ctx, booking.ID.Hex())
+	suite.Nil(err)
+	suite.Equal(from.AddDate(0, 0, 4), stored.TillDate.UTC())
+
+	status, _ = suite.patch(user, booking, types.UpdateBookingParams{RoomID: abroad.ID.Hex()})
+	suite.Equal(http.StatusBadRequest, status)
+
+	status, modified = suite.patch(user, booking, types.UpdateBookingParams{RoomID: spare.ID.Hex(), TillDate: from.AddDate(0, 0, 6)})
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(spare.ID, modified.RoomID)
+
+	overlapping, err := store.Booking.FindOverlapping(ctx, room.ID, from, from.AddDate(0, 0, 4))
+	suite.Nil(err)
+	suite.Empty(overlapping)
+}
+
+func (suite *GuestBookingSuite) TestLateModifyKeepsFee() {
+	var (
+		store   = suite.tdb.store
+		user    = fixtures.AddUser(store, "james", "foo", false)
+		admin   = fixtures.AddUser(store, "admin", "admin", true)
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room    = fixtures.AddRoom(store, types.DOUBLE, 99.99, 100, hotel.ID)
+		from    = time.Now().Add(24 * time.Hour)
+		booking = fixtures.AddBooking(store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+	)
+
+	// moving the stay out of the late window would make cancelling free
+	status, _ := suite.patch(user, booking, types.UpdateBookingParams{FromDate: from.AddDate(0, 0, 10), TillDate: from.AddDate(0, 0, 12)})
+	suite.Equal(http.StatusConflict, status)
+	status, _ = suite.patch(user, booking, types.UpdateBookingParams{TillDate: from.AddDate(0, 0, 1)})
+	suite.Equal(http.StatusConflict, status)
+
+	resp, cancelled := suite.cancel(user, booking, "")
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal(100.0, cancelled.CancellationFee)
+
+	// staff still move bookings inside the late window
+	late := fixtures.AddBooking(store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+	status, _ = suite.patch(admin, late, types.UpdateBookingParams{FromDate: from.AddDate(0, 0, 10), TillDate: from.AddDate(0, 0, 12)})
+	suite.Equal(http.StatusOK, status)
+}
+
+func (suite *GuestBookingSuite) TestOtherUserCannotModify() {
+	var (
+		store   = suite.tdb.store
+		user    = fixtures.AddUser(store, "james", "foo", false)
+		other   = fixtures.AddUser(store, "alice", "bar", false)
+		hotel   = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room    = fixtures.AddRoom(store, types.SINGLE, 99.99, 100, hotel.ID)
+		from    = time.Now().AddDate(0, 0, 10)
+		booking = fixtures.AddBooking(store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+	)
+
+	status, _ := suite.patch(other, booking, types.UpdateBookingParams{NumPersons: 1})
+	suite.Equal(http.StatusForbidden, status)
+}
+
+func TestGuestBookingSuite(t *testing.T) {
+	suite.Run(t, new(GuestBookingSuite))
+}
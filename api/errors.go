@@ -1,6 +1,20 @@
 package api
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorHandler is the fiber error handler of the API. It renders an Error
+// with its own status code and any other error as an internal server error.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	if apiError, ok := err.(Error); ok {
+		return c.Status(apiError.Code).JSON(apiError)
+	}
+	apiError := NewError(http.StatusInternalServerError, err.Error())
+	return c.Status(apiError.Code).JSON(apiError)
+}
 
 type Error struct {
 	Code int    `json:"code"`
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// readinessTimeout bounds each dependency check of a readiness probe.
+const readinessTimeout = 2 * time.Second
+
+// HealthCheck reports why a dependency, such as the database, can't be used.
+type HealthCheck func(ctx context.Context) error
+
+type HealthHandler struct {
+	checks map[string]HealthCheck
+}
+
+func NewHealthHandler(checks map[string]HealthCheck) *HealthHandler {
+	return &HealthHandler{
+		checks: checks,
+	}
+}
+
+type DependencyStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string                      `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks,omitempty"`
+}
+
+// HandleLiveness tells the process is up, whatever the state of its
+// dependencies.
+func (h *HealthHandler) HandleLiveness(c *fiber.Ctx) error {
+	return c.JSON(HealthResponse{Status: "ok"})
+}
+
+// HandleReadiness runs the dependency checks at once and answers 503 when
+// any of them fails or takes longer than readinessTimeout.
+func (h *HealthHandler) HandleReadiness(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), readinessTimeout)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		response = HealthResponse{Status: "ok", Checks: map[string]DependencyStatus{}}
+	)
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			status := DependencyStatus{Status: "ok"}
+			if err := check(ctx); err != nil {
+				status = DependencyStatus{Status: "down", Error: err.Error()}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[name] = status
+		}(name, check)
+	}
+	wg.Wait()
+
+	for _, status := range response.Checks {
+		if status.Status != "ok" {
+			response.Status = "unavailable"
+			return c.Status(http.StatusServiceUnavailable).JSON(response)
+		}
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	var (
+		mongoErr = errors.New("server selection timeout")
+		app      = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		handler  = NewHealthHandler(map[string]HealthCheck{
+			"mongo": func(ctx context.Context) error {
+				return mongoErr
+			},
+			"mail": func(ctx context.Context) error {
+				return nil
+			},
+		})
+	)
+	app.Get("/healthz", handler.HandleLiveness)
+	app.Get("/readyz", handler.HandleReadiness)
+
+	get := func(url string) (int, HealthResponse) {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var health HealthResponse
+		if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, health
+	}
+
+	status, health := get("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", health.Status)
+
+	status, health = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "unavailable", health.Status)
+	assert.Equal(t, DependencyStatus{Status: "down", Error: mongoErr.Error()}, health.Checks["mongo"])
+	assert.Equal(t, DependencyStatus{Status: "ok"}, health.Checks["mail"])
+
+	mongoErr = nil
+	status, health = get("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", health.Status)
+	assert.Equal(t, DependencyStatus{Status: "ok"}, health.Checks["mongo"])
+}
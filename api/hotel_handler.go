@@ -2,10 +2,11 @@ package api
 
 import (
 	"errors"
-	"fmt"
+	"net/http"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -55,7 +56,6 @@ func (h *HotelHandler) HandleGetHotels(c *fiber.Ctx) error {
 func (h *HotelHandler) HandleGetHotelById(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if len(id) == 0 {
-		fmt.Printf("supplied empty id %s", id)
 		return ErrInvalidId()
 	}
 
@@ -88,3 +88,99 @@ func (h *HotelHandler) HandleGetRooms(c *fiber.Ctx) error {
 	}
 	return c.JSON(rooms)
 }
+
+func (h *HotelHandler) HandlePostHotel(c *fiber.Ctx) error {
+	var params types.HotelParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
+
+	hotel, err := h.store.Hotel.InsertHotel(c.Context(), types.NewHotelFromParams(params))
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusCreated).JSON(hotel)
+}
+
+func (h *HotelHandler) HandlePutHotel(c *fiber.Ctx) error {
+	var params types.HotelParams
+	id := c.Params("id")
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
+
+	if err := h.store.Hotel.UpdateHotelById(c.Context(), id, params.ToUpdate()); err != nil {
+		return inventoryError(err)
+	}
+	hotel, err := h.store.Hotel.GetHotelById(c.Context(), id)
+	if err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(hotel)
+}
+
+func (h *HotelHandler) HandlePutRatePlan(c *fiber.Ctx) error {
+	var plan types.RatePlan
+	id := c.Params("id")
+	if err := c.BodyParser(&plan); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := plan.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
+
+	if err := h.store.Hotel.UpdateHotelById(c.Context(), id, map[string]any{"ratePlan": plan}); err != nil {
+		return inventoryError(err)
+	}
+	hotel, err := h.store.Hotel.GetHotelById(c.Context(), id)
+	if err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(hotel)
+}
+
+// HandleDeleteHotel removes a hotel together with its rooms. Hotels with
+// upcoming bookings are kept so that no guest loses a reservation.
+func (h *HotelHandler) HandleDeleteHotel(c *fiber.Ctx) error {
+	id := c.Params("id")
+	hotel, err := h.store.Hotel.GetHotelById(c.Context(), id)
+	if err != nil {
+		return inventoryError(err)
+	}
+
+	booked, err := hasUpcomingBookings(c.Context(), h.store, hotel.Rooms)
+	if err != nil {
+		return err
+	}
+	if booked {
+		return NewError(http.StatusConflict, "hotel has upcoming bookings")
+	}
+
+	for _, roomID := range hotel.Rooms {
+		if err := h.store.Room.DeleteRoomById(c.Context(), roomID.Hex()); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+	if err := h.store.Hotel.DeleteHotelById(c.Context(), id); err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(map[string]string{"Deleted": id})
+}
+
+// inventoryError maps store errors for a hotel or room id onto api errors.
+func inventoryError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrResourceNotFound()
+	}
+	var dbErr db.DBError
+	if errors.As(err, &dbErr) {
+		return ErrInvalidId()
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"github.com/swarajroy/hotel-reservation/db/fixtures"
+	"github.com/swarajroy/hotel-reservation/types"
+)
+
+type InventorySuite struct {
+	suite.Suite
+	tdb *testdb
+	app *fiber.App
+}
+
+func (suite *InventorySuite) SetupTest() {
+	suite.tdb = Setup(suite.T(), context.Background())
+
+	var (
+		hotelHandler = NewHotelHandler(suite.tdb.store)
+		roomHandler  = NewRoomHandler(suite.tdb.store)
+	)
+	suite.app = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	suite.app.Post("/hotels", hotelHandler.HandlePostHotel)
+	suite.app.Put("/hotels/:id", hotelHandler.HandlePutHotel)
+	suite.app.Delete("/hotels/:id", hotelHandler.HandleDeleteHotel)
+	suite.app.Put("/hotels/:id/rateplan", hotelHandler.HandlePutRatePlan)
+	suite.app.Post("/hotels/:id/rooms", roomHandler.HandlePostRoom)
+	suite.app.Put("/hotels/:id/rooms/:roomID", roomHandler.HandlePutRoom)
+	suite.app.Delete("/hotels/:id/rooms/:roomID", roomHandler.HandleDeleteRoom)
+}
+
+func (suite *InventorySuite) TearDownTest() {
+	suite.tdb.TearDown(suite.T(), context.Background())
+}
+
+func (suite *InventorySuite) do(method, url string, body any, out any) int {
+	var reader io.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		reader = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, url, reader)
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := suite.app.Test(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			suite.T().Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func (suite *InventorySuite) TestHotelAndRoomLifecycle() {
+	var (
+		ctx   = context.Background()
+		hotel types.Hotel
+		room  types.Room
+	)
+	status := suite.do("POST", "/hotels", types.HotelParams{Name: "bar hotel", Location: "london", Rating: 4}, &hotel)
+	suite.Equal(http.StatusCreated, status)
+
+	status = suite.do("POST", fmt.Sprintf("/hotels/%s/rooms", hotel.ID.Hex()), types.RoomParams{Type: types.DOUBLE, BasePrice: 100, Price: 120}, &room)
+	suite.Equal(http.StatusCreated, status)
+	suite.Equal(hotel.ID, room.HotelID)
+
+	stored, err := suite.tdb.store.Hotel.GetHotelById(ctx, hotel.ID.Hex())
+	suite.Nil(err)
+	suite.Equal(room.ID, stored.Rooms[0])
+
+	status = suite.do("PUT", fmt.Sprintf("/hotels/%s/rooms/%s", hotel.ID.Hex(), room.ID.Hex()), types.RoomParams{Type: types.DELUXE, BasePrice: 200, Price: 220}, &room)
+	suite.Equal(http.StatusOK, status)
+	suite.Equal(types.DELUXE, room.Type)
+
+	status = suite.do("DELETE", fmt.Sprintf("/hotels/%s/rooms/%s", hotel.ID.Hex(), room.ID.Hex()), nil, nil)
+	suite.Equal(http.StatusOK, status)
+
+	stored, err = suite.tdb.store.Hotel.GetHotelById(ctx, hotel.ID.Hex())
+	suite.Nil(err)
+	suite.Empty(stored.Rooms)
+
+	status = suite.do("DELETE", fmt.Sprintf("/hotels/%s", hotel.ID.Hex()), nil, nil)
+	suite.Equal(http.StatusOK, status)
+}
+
+func (suite *InventorySuite) TestPostHotelValidation() {
+	var errors map[string]string
+	status := suite.do("POST", "/hotels", types.HotelParams{Name: "b", Rating: 9}, &errors)
+
+	suite.Equal(http.StatusBadRequest, status)
+	suite.Contains(errors, "name")
+	suite.Contains(errors, "location")
+	suite.Contains(errors, "rating")
+}
+
+func (suite *InventorySuite) TestDeleteHotelWithUpcomingBookings() {
+	var (
+		store = suite.tdb.store
+		user  = fixtures.AddUser(store, "james", "foo", false)
+		hotel = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room  = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, hotel.ID)
+		from  = time.Now().AddDate(0, 0, 1)
+	)
+	fixtures.AddBooking(store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+
+	status := suite.do("DELETE", fmt.Sprintf("/hotels/%s", hotel.ID.Hex()), nil, nil)
+	suite.Equal(http.StatusConflict, status)
+
+	status = suite.do("DELETE", fmt.Sprintf("/hotels/%s/rooms/%s", hotel.ID.Hex(), room.ID.Hex()), nil, nil)
+	suite.Equal(http.StatusConflict, status)
+}
+
+func (suite *InventorySuite) TestRoomOfAnotherHotel() {
+	var (
+		store = suite.tdb.store
+		hotel = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		other = fixtures.AddHotel(store, "foo hotel", "paris", nil)
+		room  = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, other.ID)
+	)
+	status := suite.do("DELETE", fmt.Sprintf("/hotels/%s/rooms/%s", hotel.ID.Hex(), room.ID.Hex()), nil, nil)
+
+	suite.Equal(ErrResourceNotFound().Code, status)
+}
+
+func (suite *InventorySuite) TestRatePlanPricesBookings() {
+	var (
+		store = suite.tdb.store
+		user  = fixtures.AddUser(store, "james", "foo", false)
+		hotel = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room  = fixtures.AddRoom(store, types.DOUBLE, 100, 100, hotel.ID)
+		from  = types.StayDay(time.Now()).AddDate(0, 0, 10)
+		plan  = types.RatePlan{StayDiscounts: []types.StayDiscount{{MinNights: 2, Discount: 0.25}}}
+	)
+	status := suite.do("PUT", fmt.Sprintf("/hotels/%s/rateplan", hotel.ID.Hex()), plan, &types.Hotel{})
+	suite.Equal(http.StatusOK, status)
+
+	roomHandler := NewRoomHandler(store)
+	suite.app.Post("/rooms/:id/book", withUser(user), roomHandler.HandleBookRoom)
+
+	var booking types.Booking
+	params := types.BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 2), NumPersons: 2}
+	status = suite.do("POST", fmt.Sprintf("/rooms/%s/book", room.ID.Hex()), params, &booking)
+	suite.Equal(http.StatusOK, status)
+	suite.Len(booking.Price.Nights, 2)
+	suite.Equal(150.0, booking.Price.Total)
+
+	// changing the room's price leaves existing bookings alone
+	status = suite.do("PUT", fmt.Sprintf("/hotels/%s/rooms/%s", hotel.ID.Hex(), room.ID.Hex()), types.RoomParams{Type: types.DOUBLE, BasePrice: 200, Price: 200}, &types.Room{})
+	suite.Equal(http.StatusOK, status)
+
+	stored, err := store.Booking.GetBooking(context.Background(), booking.ID.Hex())
+	suite.Nil(err)
+	suite.Equal(150.0, stored.Price.Total)
+}
+
+func (suite *InventorySuite) TestPutRatePlanValidation() {
+	var (
+		hotel  = fixtures.AddHotel(suite.tdb.store, "bar hotel", "london", nil)
+		errors map[string]string
+	)
+	status := suite.do("PUT", fmt.Sprintf("/hotels/%s/rateplan", hotel.ID.Hex()), types.RatePlan{WeekendUplift: -1}, &errors)
+
+	suite.Equal(http.StatusBadRequest, status)
+	suite.Contains(errors, "weekendUplift")
+}
+
+func TestInventorySuite(t *testing.T) {
+	suite.Run(t, new(InventorySuite))
+}
@@ -1,9 +1,7 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,58 +9,72 @@ import (
 	"github.com/swarajroy/hotel-reservation/db"
 )
 
-func JWTAuthentication(store *db.HotelReservationStore) fiber.Handler {
+// JWTAuthentication accepts the access token of a user in the X-Api-Token
+// header, or the key of an integration in the X-Api-Key header.
+func JWTAuthentication(store *db.HotelReservationStore, signer *TokenSigner) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if key := c.Get("X-Api-Key"); len(key) > 0 {
+			return authenticateAPIKey(c, store, key)
+		}
 		token := c.Get("X-Api-Token")
 		if len(token) == 0 {
 			return ErrUnAuthorized()
 		}
 
-		claims, err := validateToken(token)
+		claims, err := signer.Verify(token)
 		if err != nil {
-			return fmt.Errorf("error = %s", err.Error())
+			requestLogger(c).Warn("invalid access token", "error", err)
+			return NewError(http.StatusUnauthorized, "invalid token")
 		}
 
-		expiresFloat := claims["expires"].(float64)
-		expires := int64(expiresFloat)
-
-		if time.Now().Unix() > expires {
-			return NewError(http.StatusUnauthorized, "token expired")
+		jti, _ := claims["jti"].(string)
+		sid, _ := claims["sid"].(string)
+		revoked, err := store.Token.IsRevoked(c.Context(), jti, sid)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return NewError(http.StatusUnauthorized, "token revoked")
 		}
 
-		userID := claims["id"].(string)
+		userID, err := claims.GetSubject()
+		if err != nil {
+			return ErrUnAuthorized()
+		}
 		user, err := store.User.GetUserById(c.Context(), userID)
 		if err != nil {
 			return ErrUnAuthorized()
 		}
+		// iat has whole seconds, so the tokens of the session started along
+		// with a password change are still accepted
+		issuedAt, err := claims.GetIssuedAt()
+		if err != nil || issuedAt == nil || issuedAt.Before(user.TokensValidAfter.Truncate(time.Second)) {
+			return NewError(http.StatusUnauthorized, "token revoked")
+		}
 
 		//set the current authenticated user in the context
 		c.Context().SetUserValue("user", user)
+		c.Context().SetUserValue("mfa", hasAuthMethod(claims, "otp"))
 
 		return c.Next()
 	}
 
 }
 
-func validateToken(tokenStr string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			fmt.Println("invalid signing method", token.Header["alg"])
-			return nil, ErrUnAuthorized()
+// hasAuthMethod reports whether the amr claim of claims lists method.
+func hasAuthMethod(claims jwt.MapClaims, method string) bool {
+	amr, _ := claims["amr"].([]any)
+	for _, m := range amr {
+		if m == method {
+			return true
 		}
-		secret := os.Getenv("JWT_SECRET")
-		// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
-		return []byte(secret), nil
-	})
-	fmt.Println("parseToken = ", token)
-	if err != nil {
-		_ = fmt.Errorf("failed to parse jwt token = %s", tokenStr)
-		return nil, ErrUnAuthorized()
 	}
+	return false
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		return claims, nil
-	}
-	return nil, ErrUnAuthorized()
+// sessionHasMFA reports whether the token of the request was issued after
+// the user gave a second factor.
+func sessionHasMFA(c *fiber.Ctx) bool {
+	mfa, _ := c.Context().UserValue("mfa").(bool)
+	return mfa
 }
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/swarajroy/hotel-reservation/logging"
+	"github.com/swarajroy/hotel-reservation/types"
+)
+
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+// requestIDPattern keeps ids given by callers from forging log lines.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID tags the request with the X-Request-ID header of the caller, or
+// a new id without one, and returns it in the response so the caller's logs
+// can be matched with ours.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(REQUEST_ID_HEADER)
+		if !requestIDPattern.MatchString(id) {
+			id = newTokenID()
+		}
+		c.Set(REQUEST_ID_HEADER, id)
+		c.Context().SetUserValue("requestID", id)
+		return c.Next()
+	}
+}
+
+// AccessLog gives the request a logger tagged with its id, which handlers
+// and stores get with logging.FromContext, and logs every request with its
+// status and latency once it was handled. It comes after RequestID.
+func AccessLog(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		requestID, _ := c.Context().UserValue("requestID").(string)
+		reqLogger := logger.With("request_id", requestID)
+		c.Context().SetUserValue(logging.CONTEXT_KEY, reqLogger)
+
+		// errors are rendered here rather than after the middleware returns
+		// so that the logged status is the one sent
+		handlerErr := c.Next()
+		renderError(c, handlerErr)
+
+		var (
+			status = c.Response().StatusCode()
+			level  = slog.LevelInfo
+			attrs  = []slog.Attr{
+				slog.String("method", c.Method()),
+				slog.String("path", c.Path()),
+				slog.Int("status", status),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("ip", c.IP()),
+				slog.Int("bytes", len(c.Response().Body())),
+			}
+		)
+		if user, ok := c.Context().UserValue("user").(*types.User); ok {
+			attrs = append(attrs, slog.String("user_id", user.ID.Hex()))
+		}
+		if apiKey, ok := c.Context().UserValue("apiKey").(*types.APIKey); ok {
+			attrs = append(attrs, slog.String("api_key_id", apiKey.ID.Hex()))
+		}
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+			if handlerErr != nil {
+				attrs = append(attrs, slog.Any("error", handlerErr))
+			}
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		reqLogger.LogAttrs(c.Context(), level, "request", attrs...)
+		return nil
+	}
+}
+
+// requestLogger returns the logger of the request, see AccessLog.
+func requestLogger(c *fiber.Ctx) *slog.Logger {
+	return logging.FromContext(c.Context())
+}
+
+// renderError writes the response of err with the error handler of the app,
+// for middleware that needs the final status.
+func renderError(c *fiber.Ctx, err error) {
+	if err == nil {
+		return
+	}
+	if err := c.App().ErrorHandler(c, err); err != nil {
+		c.Status(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/config"
+	"github.com/swarajroy/hotel-reservation/logging"
+)
+
+func TestRequestLogging(t *testing.T) {
+	var (
+		buf    bytes.Buffer
+		logger = logging.New(&buf, config.Log{Level: "debug", Format: config.LogFormatJSON})
+		app    = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	)
+	app.Use(RequestID(), AccessLog(logger))
+	app.Post("/auth", func(c *fiber.Ctx) error {
+		requestLogger(c).Info("login failed", "email", "james@example.com", "password", "supersecret")
+		return NewError(http.StatusBadRequest, "invalid credentials")
+	})
+	app.Get("/ok", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	records := func() []map[string]any {
+		defer buf.Reset()
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+
+	req := httptest.NewRequest("POST", "/auth", nil)
+	req.Header.Set(REQUEST_ID_HEADER, "client-42")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "client-42", resp.Header.Get(REQUEST_ID_HEADER))
+
+	logged := buf.String()
+	assert.NotContains(t, logged, "supersecret")
+	assert.NotContains(t, logged, "james@")
+	recs := records()
+	if assert.Len(t, recs, 2) {
+		assert.Equal(t, "login failed", recs[0]["msg"])
+		assert.Equal(t, "client-42", recs[0]["request_id"])
+		assert.Equal(t, "request", recs[1]["msg"])
+		assert.Equal(t, "WARN", recs[1]["level"])
+		assert.Equal(t, "client-42", recs[1]["request_id"])
+		assert.Equal(t, "POST", recs[1]["method"])
+		assert.Equal(t, "/auth", recs[1]["path"])
+		assert.Equal(t, float64(http.StatusBadRequest), recs[1]["status"])
+		assert.Contains(t, recs[1], "latency_ms")
+	}
+
+	// ids that could forge log lines are replaced
+	req = httptest.NewRequest("GET", "/ok", nil)
+	req.Header.Set(REQUEST_ID_HEADER, "bad id\n{\"level\":\"ERROR\"}")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	id := resp.Header.Get(REQUEST_ID_HEADER)
+	assert.Regexp(t, requestIDPattern, id)
+	recs = records()
+	if assert.Len(t, recs, 1) {
+		assert.Equal(t, "INFO", recs[0]["level"])
+		assert.Equal(t, id, recs[0]["request_id"])
+		assert.Equal(t, float64(http.StatusOK), recs[0]["status"])
+	}
+}
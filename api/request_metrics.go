@@ -0,0 +1,25 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/swarajroy/hotel-reservation/metrics"
+)
+
+// RequestMetrics records the latency of every request in
+// metrics.RequestDuration under the pattern of the route that handled it.
+// It comes before AccessLog, which renders the errors.
+func RequestMetrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		renderError(c, c.Next())
+		metrics.RequestDuration.WithLabelValues(
+			c.Method(),
+			c.Route().Path,
+			strconv.Itoa(c.Response().StatusCode()),
+		).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/metrics"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		app      = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	)
+	if err := metrics.Register(registry); err != nil {
+		t.Fatal(err)
+	}
+	app.Use(RequestMetrics())
+	app.Get("/metrics", adaptor.HTTPHandler(metrics.Handler(registry)))
+	app.Get("/hotels/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "missing" {
+			return NewError(http.StatusNotFound, "no such hotel")
+		}
+		return c.SendString("hotel")
+	})
+
+	get := func(url string) *http.Response {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	assert.Equal(t, http.StatusOK, get("/hotels/1").StatusCode)
+	assert.Equal(t, http.StatusOK, get("/hotels/2").StatusCode)
+	assert.Equal(t, http.StatusNotFound, get("/hotels/missing").StatusCode)
+
+	resp := get("/metrics")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// requests are counted per route, not per path
+	assert.Contains(t, string(body), `hotel_reservation_http_request_duration_seconds_count{method="GET",route="/hotels/:id",status="200"} 2`)
+	assert.Contains(t, string(body), `hotel_reservation_http_request_duration_seconds_count{method="GET",route="/hotels/:id",status="404"} 1`)
+	assert.NotContains(t, string(body), `route="/hotels/1"`)
+}
@@ -2,10 +2,13 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/metrics"
 	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -25,70 +28,141 @@ func (h *RoomHandler) HandleBookRoom(c *fiber.Ctx) error {
 
 	var params types.BookRoomParams
 	ctx := c.Context()
+	user, ok := ctx.Value("user").(*types.User)
+	if !ok {
+		// API keys act for no user the booking could belong to
+		if _, isKey := principal(c); isKey {
+			return ErrUnAuthorized()
+		}
+		return ErrUnAuthenticated()
+	}
 	if err := c.BodyParser(&params); err != nil {
 		return err
 	}
-	if err := params.Validate(); err != nil {
-		return err
+
+	room, err := h.store.Room.GetRoomById(ctx, c.Params("id"))
+	if err != nil {
+		return inventoryError(err)
+	}
+	if errors := params.Validate(room); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
 	}
 
-	roomID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	hotel, err := h.store.Hotel.GetHotelById(ctx, room.HotelID.Hex())
 	if err != nil {
+		return inventoryError(err)
+	}
+	booking := types.NewBookingFromParams(params, user.ID, room.ID)
+	booking.Price = hotel.Quote(room, booking.FromDate, booking.TillDate, booking.NumPersons)
+
+	insertedBooking, err := h.store.Booking.BookRoom(ctx, booking)
+	if err != nil {
+		var conflict db.ConflictError
+		if errors.As(err, &conflict) {
+			metrics.BookingConflicts.WithLabelValues("book").Inc()
+			return c.Status(http.StatusConflict).JSON(types.BookingErrorResponse{
+				Type: "error",
+				Msg:  "room already booked",
+			})
+		}
 		return err
 	}
+	metrics.BookingsCreated.Inc()
 
-	user, ok := ctx.Value("user").(*types.User)
-	if !ok {
-		return c.Status(http.StatusInternalServerError).JSON(AuthErrorResponse{
-			Status: http.StatusInternalServerError,
-			Msg:    "internal server error",
-		})
+	return c.JSON(insertedBooking)
+}
+
+func (h *RoomHandler) HandlePostRoom(c *fiber.Ctx) error {
+	var params types.RoomParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
 	}
 
-	ok, err = h.isRoomAvailableForBooking(ctx, params, roomID)
+	hotel, err := h.store.Hotel.GetHotelById(c.Context(), c.Params("id"))
+	if err != nil {
+		return inventoryError(err)
+	}
+
+	room, err := h.store.Room.InsertRoom(c.Context(), types.NewRoomFromParams(params, hotel.ID))
 	if err != nil {
 		return err
 	}
+	return c.Status(http.StatusCreated).JSON(room)
+}
 
-	if !ok {
-		return c.Status(http.StatusBadRequest).JSON(types.BookingErrorResponse{
-			Type: "error",
-			Msg:  "room already booked",
-		})
+func (h *RoomHandler) HandlePutRoom(c *fiber.Ctx) error {
+	var params types.RoomParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
 	}
 
-	booking := types.Booking{
-		UserID:     user.ID,
-		RoomID:     roomID,
-		FromDate:   params.FromDate,
-		TillDate:   params.TillDate,
-		NumPersons: params.NumPersons,
+	room, err := h.getHotelRoom(c)
+	if err != nil {
+		return err
+	}
+	if err := h.store.Room.UpdateRoomById(c.Context(), room.ID.Hex(), params.ToUpdate()); err != nil {
+		return inventoryError(err)
 	}
+	room, err = h.store.Room.GetRoomById(c.Context(), room.ID.Hex())
+	if err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(room)
+}
 
-	insertedBooking, err := h.store.Booking.InsertBooking(ctx, &booking)
+func (h *RoomHandler) HandleDeleteRoom(c *fiber.Ctx) error {
+	room, err := h.getHotelRoom(c)
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(insertedBooking)
+	booked, err := hasUpcomingBookings(c.Context(), h.store, []primitive.ObjectID{room.ID})
+	if err != nil {
+		return err
+	}
+	if booked {
+		return NewError(http.StatusConflict, "room has upcoming bookings")
+	}
+
+	if err := h.store.Room.DeleteRoomById(c.Context(), room.ID.Hex()); err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(map[string]string{"Deleted": room.ID.Hex()})
 }
 
-func (rh *RoomHandler) isRoomAvailableForBooking(ctx context.Context, params types.BookRoomParams, roomID primitive.ObjectID) (bool, error) {
-	where := bson.M{
-		"roomID": roomID,
-		"fromDate": bson.M{
-			"$gte": params.FromDate,
-		},
-		"tillDate": bson.M{
-			"$lte": params.TillDate,
-		},
+// getHotelRoom loads the room named by the roomID param and checks that it
+// belongs to the hotel named by the id param.
+func (h *RoomHandler) getHotelRoom(c *fiber.Ctx) (*types.Room, error) {
+	room, err := h.store.Room.GetRoomById(c.Context(), c.Params("roomID"))
+	if err != nil {
+		return nil, inventoryError(err)
 	}
+	if room.HotelID.Hex() != c.Params("id") {
+		return nil, ErrResourceNotFound()
+	}
+	return room, nil
+}
 
-	bookings, err := rh.store.Booking.GetBookings(ctx, where)
+// hasUpcomingBookings reports whether any of the rooms has an active booking
+// that has not ended yet.
+func hasUpcomingBookings(ctx context.Context, store *db.HotelReservationStore, roomIDs []primitive.ObjectID) (bool, error) {
+	if len(roomIDs) == 0 {
+		return false, nil
+	}
+	filter := bson.M{
+		"roomID":      bson.M{"$in": roomIDs},
+		"cancelledAt": bson.M{"$exists": false},
+		"tillDate":    bson.M{"$gt": time.Now()},
+	}
+	bookings, err := store.Booking.GetBookings(ctx, filter, nil)
 	if err != nil {
 		return false, err
 	}
-
-	ok := len(bookings) == 0
-	return ok, nil
+	return len(bookings) > 0, nil
 }
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+	"github.com/swarajroy/hotel-reservation/db/fixtures"
+	"github.com/swarajroy/hotel-reservation/metrics"
+	"github.com/swarajroy/hotel-reservation/types"
+)
+
+type RoomHandlerSuite struct {
+	suite.Suite
+	tdb *testdb
+}
+
+func (suite *RoomHandlerSuite) SetupTest() {
+	suite.tdb = Setup(suite.T(), context.Background())
+}
+
+func (suite *RoomHandlerSuite) TearDownTest() {
+	suite.tdb.TearDown(suite.T(), context.Background())
+}
+
+// withUser stands in for JWTAuthentication and puts user in the context.
+func withUser(user *types.User) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Context().SetUserValue("user", user)
+		return c.Next()
+	}
+}
+
+func (suite *RoomHandlerSuite) bookRoom(app *fiber.App, room *types.Room, params types.BookRoomParams) *http.Response {
+	b, _ := json.Marshal(params)
+	req := httptest.NewRequest("POST", fmt.Sprintf("/%s/book", room.ID.Hex()), bytes.NewReader(b))
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	return resp
+}
+
+func (suite *RoomHandlerSuite) TestConcurrentBookingsOfSameRoom() {
+	var (
+		store       = suite.tdb.store
+		user        = fixtures.AddUser(store, "james", "foo", false)
+		hotel       = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room        = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, hotel.ID)
+		app         = fiber.New()
+		roomHandler = NewRoomHandler(store)
+		from        = time.Now().AddDate(0, 0, 1)
+		params      = types.BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 3), NumPersons: 1}
+		attempts    = 10
+		statuses    = make(chan int, attempts)
+		wg          sync.WaitGroup
+		created     = testutil.ToFloat64(metrics.BookingsCreated)
+		conflicts   = testutil.ToFloat64(metrics.BookingConflicts.WithLabelValues("book"))
+	)
+	app.Post("/:id/book", withUser(user), roomHandler.HandleBookRoom)
+
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- suite.bookRoom(app, room, params).StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	suite.Equal(1, counts[http.StatusOK])
+	suite.Equal(attempts-1, counts[http.StatusConflict])
+	suite.Equal(created+1, testutil.ToFloat64(metrics.BookingsCreated))
+	suite.Equal(conflicts+float64(attempts-1), testutil.ToFloat64(metrics.BookingConflicts.WithLabelValues("book")))
+}
+
+func (suite *RoomHandlerSuite) TestBookingAfterCancellation() {
+	var (
+		ctx         = context.Background()
+		store       = suite.tdb.store
+		user        = fixtures.AddUser(store, "james", "foo", false)
+		hotel       = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room        = fixtures.AddRoom(store, types.SINGLE, 99.99, 99.99, hotel.ID)
+		app         = fiber.New()
+		roomHandler = NewRoomHandler(store)
+		from        = time.Now().AddDate(0, 0, 1)
+		params      = types.BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 3), NumPersons: 1}
+	)
+	app.Post("/:id/book", withUser(user), roomHandler.HandleBookRoom)
+
+	resp := suite.bookRoom(app, room, params)
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	var booking types.Booking
+	if err := json.NewDecoder(resp.Body).Decode(&booking); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(http.StatusConflict, suite.bookRoom(app, room, params).StatusCode)
+
+	if err := store.Booking.CancelBooking(ctx, booking.ID.Hex(), types.Cancellation{}); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(http.StatusOK, suite.bookRoom(app, room, params).StatusCode)
+}
+
+func (suite *RoomHandlerSuite) TestBookingOverCapacity() {
+	var (
+		ctx         = context.Background()
+		store       = suite.tdb.store
+		user        = fixtures.AddUser(store, "james", "foo", false)
+		hotel       = fixtures.AddHotel(store, "bar hotel", "london", nil)
+		room        = fixtures.AddRoom(store, types.DOUBLE, 99.99, 99.99, hotel.ID)
+		app         = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		roomHandler = NewRoomHandler(store)
+		from        = time.Now().AddDate(0, 0, 1)
+		errors      map[string]string
+	)
+	err := store.Room.UpdateRoomById(ctx, room.ID.Hex(), map[string]any{"maxAdults": 2, "maxChildren": 1, "maxStay": 5})
+	suite.Nil(err)
+	app.Post("/:id/book", withUser(user), roomHandler.HandleBookRoom)
+
+	resp := suite.bookRoom(app, room, types.BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 6), NumAdults: 3})
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+	if err := json.NewDecoder(resp.Body).Decode(&errors); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Contains(errors, "numAdults")
+	suite.Contains(errors, "tillDate")
+
+	resp = suite.bookRoom(app, room, types.BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 2), NumAdults: 2, NumChildren: 1})
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	var booking types.Booking
+	if err := json.NewDecoder(resp.Body).Decode(&booking); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.Equal(3, booking.NumPersons)
+}
+
+func TestRoomHandlerSuite(t *testing.T) {
+	suite.Run(t, new(RoomHandlerSuite))
+}
@@ -5,33 +5,20 @@ import (
 	"testing"
 
 	"github.com/swarajroy/hotel-reservation/db"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/swarajroy/hotel-reservation/db/memory"
+	"github.com/swarajroy/hotel-reservation/types"
 )
 
 type testdb struct {
 	store *db.HotelReservationStore
 }
 
+// Setup returns a testdb backed by the in-memory stores so handler tests do
+// not need a running MongoDB.
 func Setup(t *testing.T, ctx context.Context) *testdb {
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(db.DB_URI))
-	if err != nil {
-		t.Fatal(err)
-	}
-	userStore := db.NewMongoDbUserStore(client, db.TEST_DB_NAME)
-	hotelStore := db.NewMongoDbHotelStore(client, db.TEST_DB_NAME)
-	roomStore := db.NewMongoDbRoomStore(client, db.TEST_DB_NAME, hotelStore)
-	bookingStore := db.NewMongoDbBookingStore(client, db.TEST_DB_NAME)
 	return &testdb{
-		store: &db.HotelReservationStore{
-			User:    userStore,
-			Hotel:   hotelStore,
-			Room:    roomStore,
-			Booking: bookingStore,
-		},
+		store: memory.NewHotelReservationStore(),
 	}
-
 }
 
 func (tdb *testdb) TearDown(t *testing.T, ctx context.Context) {
@@ -50,4 +37,34 @@ func (tdb *testdb) TearDown(t *testing.T, ctx context.Context) {
 	if err := tdb.store.Booking.Drop(ctx); err != nil {
 		t.Fatal(err)
 	}
+
+	if err := tdb.store.Lockout.Drop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tdb.store.APIKey.Drop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tdb.store.Token.Drop(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestTokenSigner returns an HS256 TokenSigner with a fixed secret.
+func newTestTokenSigner(t *testing.T) *TokenSigner {
+	signer, err := NewHMACTokenSigner(DefaultTokenKeyID, []byte("test-secret"), DefaultTokenIssuer, DefaultTokenAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// testToken returns an access token for user signed by signer.
+func testToken(t *testing.T, signer *TokenSigner, user *types.User) string {
+	token, err := CreateTokenFromUser(signer, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
 }
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/swarajroy/hotel-reservation/config"
+)
+
+const (
+	DefaultTokenIssuer   = config.DefaultTokenIssuer
+	DefaultTokenAudience = config.DefaultTokenAudience
+	DefaultTokenKeyID    = config.DefaultTokenKeyID
+)
+
+// tokenKey is a key the TokenSigner verifies tokens with. Its method is the
+// only algorithm accepted for tokens naming its kid.
+type tokenKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    any
+}
+
+// TokenSigner signs the API's JWTs with one key and verifies them against
+// all of its verification keys, picked by the kid header. Keeping the
+// previous keys as verification keys lets the signing key be rotated without
+// invalidating the tokens already handed out.
+type TokenSigner struct {
+	issuer   string
+	audience string
+	signing  tokenKey
+	keys     map[string]tokenKey
+}
+
+// NewHMACTokenSigner returns a TokenSigner that signs with HS256. It refuses
+// an empty secret.
+func NewHMACTokenSigner(kid string, secret []byte, issuer, audience string) (*TokenSigner, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("the JWT secret must not be empty")
+	}
+	return newTokenSigner(tokenKey{kid: kid, method: jwt.SigningMethodHS256, key: secret}, secret, issuer, audience)
+}
+
+// NewTokenSigner returns a TokenSigner that signs with RS256 for an RSA key
+// and with EdDSA for an Ed25519 key.
+func NewTokenSigner(kid string, key crypto.Signer, issuer, audience string) (*TokenSigner, error) {
+	method, err := signingMethodFor(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return newTokenSigner(tokenKey{kid: kid, method: method, key: key}, key.Public(), issuer, audience)
+}
+
+// NewTokenSignerFromConfig signs with the key file of cfg, or with its secret
+// when there is none, and also accepts tokens of the kid=file keys listed in
+// its verify keys.
+func NewTokenSignerFromConfig(cfg config.JWT) (*TokenSigner, error) {
+	var (
+		signer *TokenSigner
+		err    error
+	)
+	if len(cfg.KeyFile) > 0 {
+		signer, err = LoadTokenSigner(cfg.KeyID, cfg.KeyFile, cfg.Issuer, cfg.Audience)
+	} else {
+		signer, err = NewHMACTokenSigner(cfg.KeyID, []byte(cfg.Secret), cfg.Issuer, cfg.Audience)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.VerifyKeys) == 0 {
+		return signer, nil
+	}
+	for _, entry := range strings.Split(cfg.VerifyKeys, ",") {
+		kid, file, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("verification key %q should be given as kid=file", entry)
+		}
+		if err := signer.LoadVerificationKey(kid, file); err != nil {
+			return nil, err
+		}
+	}
+	return signer, nil
+}
+
+// LoadTokenSigner returns a TokenSigner for the PEM encoded RSA or Ed25519
+// private key in path.
+func LoadTokenSigner(kid, path, issuer, audience string) (*TokenSigner, error) {
+	key, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain a private key", path)
+	}
+	return NewTokenSigner(kid, signer, issuer, audience)
+}
+
+func newTokenSigner(signing tokenKey, verify any, issuer, audience string) (*TokenSigner, error) {
+	if len(signing.kid) == 0 {
+		return nil, fmt.Errorf("the JWT signing key needs a key id")
+	}
+	s := &TokenSigner{
+		issuer:   issuer,
+		audience: audience,
+		signing:  signing,
+		keys:     map[string]tokenKey{},
+	}
+	s.keys[signing.kid] = tokenKey{kid: signing.kid, method: signing.method, key: verify}
+	return s, nil
+}
+
+// AddVerificationKey accepts tokens with the kid signed by the RSA or Ed25519
+// public key.
+func (s *TokenSigner) AddVerificationKey(kid string, key crypto.PublicKey) error {
+	if _, ok := s.keys[kid]; ok {
+		return fmt.Errorf("duplicate JWT key id %s", kid)
+	}
+	method, err := signingMethodFor(key)
+	if err != nil {
+		return err
+	}
+	s.keys[kid] = tokenKey{kid: kid, method: method, key: key}
+	return nil
+}
+
+// LoadVerificationKey adds the PEM encoded public key in path, or the public
+// half of a private key, as a verification key.
+func (s *TokenSigner) LoadVerificationKey(kid, path string) error {
+	key, err := readPEM(path)
+	if err != nil {
+		return err
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	return s.AddVerificationKey(kid, key)
+}
+
+// Sign returns a token with claims that expires after ttl. It sets the
+// standard iss, aud, iat, nbf and exp claims.
+func (s *TokenSigner) Sign(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims["iss"] = s.issuer
+	claims["aud"] = s.audience
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+
+	token := jwt.NewWithClaims(s.signing.method, claims)
+	token.Header["kid"] = s.signing.kid
+	return token.SignedString(s.signing.key)
+}
+
+// Verify parses token and checks its signature, issuer, audience and times.
+func (s *TokenSigner) Verify(token string) (jwt.MapClaims, error) {
+	var methods []string
+	for _, key := range s.keys {
+		methods = append(methods, key.method.Alg())
+	}
+	parsed, err := jwt.Parse(token, s.keyFunc,
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("unexpected claims %T", parsed.Claims)
+	}
+	return claims, nil
+}
+
+// keyFunc picks the verification key by kid and makes sure the token uses
+// that key's algorithm, so an RSA public key can never be used as an HMAC
+// secret.
+func (s *TokenSigner) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %s does not sign with %s", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+// JWK is a public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys. HMAC secrets are never
+// published.
+func (s *TokenSigner) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range s.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.key.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
+
+func (s *TokenSigner) HandleJWKS(c *fiber.Ctx) error {
+	return c.JSON(s.JWKS())
+}
+
+func signingMethodFor(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported JWT key type %T", key)
+}
+
+// readPEM reads the first PEM block of path as a PKCS #8 or PKCS #1 private
+// key or as a PKIX public key.
+func readPEM(path string) (any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", path)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("%s contains an unsupported PEM block %s", path, block.Type)
+}
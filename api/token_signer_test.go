@@ -0,0 +1,122 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHMACTokenSignerRefusesEmptySecret(t *testing.T) {
+	_, err := NewHMACTokenSigner(DefaultTokenKeyID, nil, DefaultTokenIssuer, DefaultTokenAudience)
+
+	assert.NotNil(t, err)
+}
+
+func TestTokenSignerSetsStandardClaims(t *testing.T) {
+	signer := newTestTokenSigner(t)
+
+	token, err := signer.Sign(jwt.MapClaims{"sub": "james"}, time.Minute)
+	assert.Nil(t, err)
+
+	claims, err := signer.Verify(token)
+	assert.Nil(t, err)
+	for _, claim := range []string{"iss", "aud", "iat", "nbf", "exp"} {
+		assert.Contains(t, claims, claim)
+	}
+
+	expired, err := signer.Sign(jwt.MapClaims{"sub": "james"}, -time.Minute)
+	assert.Nil(t, err)
+	_, err = signer.Verify(expired)
+	assert.NotNil(t, err)
+
+	other, err := NewHMACTokenSigner(DefaultTokenKeyID, []byte("test-secret"), DefaultTokenIssuer, "another-api")
+	assert.Nil(t, err)
+	_, err = other.Verify(token)
+	assert.NotNil(t, err)
+}
+
+func TestTokenSignerKeyRotation(t *testing.T) {
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDER, err := x509.MarshalPKCS8PrivateKey(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPublicDER, err := x509.MarshalPKIXPublicKey(oldKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldSigner, err := LoadTokenSigner("2029", writePEM(t, "PRIVATE KEY", oldDER), DefaultTokenIssuer, DefaultTokenAudience)
+	assert.Nil(t, err)
+	oldToken, err := oldSigner.Sign(jwt.MapClaims{"sub": "james"}, time.Minute)
+	assert.Nil(t, err)
+
+	newSigner, err := LoadTokenSigner("2030", writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(newKey)), DefaultTokenIssuer, DefaultTokenAudience)
+	assert.Nil(t, err)
+	_, err = newSigner.Verify(oldToken)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, newSigner.LoadVerificationKey("2029", writePEM(t, "PUBLIC KEY", oldPublicDER)))
+	_, err = newSigner.Verify(oldToken)
+	assert.Nil(t, err)
+
+	newToken, err := newSigner.Sign(jwt.MapClaims{"sub": "james"}, time.Minute)
+	assert.Nil(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	assert.Nil(t, err)
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+	assert.Equal(t, "2030", parsed.Header["kid"])
+
+	jwks := newSigner.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+	assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+}
+
+func TestTokenSignerRejectsAlgorithmOfAnotherKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewTokenSigner(DefaultTokenKeyID, key, DefaultTokenIssuer, DefaultTokenAudience)
+	assert.Nil(t, err)
+
+	// an HS256 token keyed with the published RSA public key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "james",
+		"iss": DefaultTokenIssuer,
+		"aud": DefaultTokenAudience,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	forged.Header["kid"] = DefaultTokenKeyID
+	token, err := forged.SignedString(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	assert.Nil(t, err)
+
+	_, err = signer.Verify(token)
+	assert.NotNil(t, err)
+	assert.Empty(t, newTestTokenSigner(t).JWKS().Keys)
+}
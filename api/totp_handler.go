@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/metrics"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	totpChallengeTTL = 5 * time.Minute
+)
+
+// AuthChallengeResponse is the answer to the password of a user with a
+// second factor. The challenge is exchanged for a session along with a code.
+type AuthChallengeResponse struct {
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func (auth *AuthHandler) totpChallenge(c *fiber.Ctx, user *types.User) error {
+	challenge, token, err := newOneTimeToken(c.Context(), auth.store, user, types.TOTP_CHALLENGE, totpChallengeTTL)
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusAccepted).JSON(AuthChallengeResponse{
+		Challenge: challenge,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
+
+// HandleTOTPLogin finishes the login of a user with a second factor. The
+// challenge works once, so a wrong code means starting over with the
+// password.
+func (auth *AuthHandler) HandleTOTPLogin(c *fiber.Ctx) error {
+	var params types.TOTPLoginParams
+	if err := c.BodyParser(&params); err != nil || len(params.Challenge) == 0 || len(params.Code) == 0 {
+		return ErrBadRequest()
+	}
+	token, err := auth.useOneTimeToken(c.Context(), params.Challenge, types.TOTP_CHALLENGE)
+	if err != nil {
+		return err
+	}
+	user, err := auth.store.User.GetUserById(c.Context(), token.UserID.Hex())
+	if err != nil {
+		return ErrUnAuthenticated()
+	}
+	if err := verifySecondFactor(c, auth.store, auth.emailLockout, auth.ipLockout, user, params.Code); err != nil {
+		return err
+	}
+
+	authResp, err := auth.newSession(c.Context(), user, true)
+	if err != nil {
+		return err
+	}
+	return c.JSON(authResp)
+}
+
+// HandleEnrollTOTP generates a TOTP secret and recovery codes for the
+// authenticated user. The second factor is only asked for once the user
+// confirms it with a first code.
+func (auth *AuthHandler) HandleEnrollTOTP(c *fiber.Ctx) error {
+	user, err := auth.currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled() {
+		return NewError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+	totp, codes, err := types.NewTOTP()
+	if err != nil {
+		return err
+	}
+	if err := auth.store.User.SetTOTP(c.Context(), user.ID.Hex(), totp); err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(TOTPEnrollmentResponse{
+		Secret:        totp.Secret,
+		URI:           totp.URI(auth.signer.issuer, user.Email),
+		RecoveryCodes: codes,
+	})
+}
+
+// HandleConfirmTOTP enables the second factor enrolled by the user and
+// returns a session that counts as signed in with it.
+func (auth *AuthHandler) HandleConfirmTOTP(c *fiber.Ctx) error {
+	var params types.TOTPCodeParams
+	if err := c.BodyParser(&params); err != nil || len(params.Code) == 0 {
+		return ErrBadRequest()
+	}
+	user, err := auth.currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTP == nil {
+		return NewError(http.StatusBadRequest, "two-factor authentication was not enrolled")
+	}
+	if user.TOTPEnabled() {
+		return NewError(http.StatusConflict, "two-factor authentication is already enabled")
+	}
+	step, ok := user.TOTP.Verify(params.Code, time.Now())
+	if !ok {
+		return NewError(http.StatusBadRequest, "invalid two-factor code")
+	}
+	totp := *user.TOTP
+	totp.Enabled = true
+	totp.LastStep = step
+	if err := auth.store.User.SetTOTP(c.Context(), user.ID.Hex(), &totp); err != nil {
+		return inventoryError(err)
+	}
+	user.TOTP = &totp
+
+	authResp, err := auth.newSession(c.Context(), user, true)
+	if err != nil {
+		return err
+	}
+	return c.JSON(authResp)
+}
+
+// HandleDisableTOTP removes the second factor of the authenticated user, who
+// has to give a code or a recovery code.
+func (auth *AuthHandler) HandleDisableTOTP(c *fiber.Ctx) error {
+	var params types.TOTPCodeParams
+	if err := c.BodyParser(&params); err != nil || len(params.Code) == 0 {
+		return ErrBadRequest()
+	}
+	user, err := auth.currentUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled() {
+		return NewError(http.StatusBadRequest, "two-factor authentication is not enabled")
+	}
+	if err := verifySecondFactor(c, auth.store, auth.emailLockout, auth.ipLockout, user, params.Code); err != nil {
+		return err
+	}
+	if err := auth.store.User.SetTOTP(c.Context(), user.ID.Hex(), nil); err != nil {
+		return inventoryError(err)
+	}
+	return c.JSON(map[string]string{"Disabled": user.ID.Hex()})
+}
+
+// currentUser reloads the authenticated user, whose second factor is not
+// kept in the context.
+func (auth *AuthHandler) currentUser(c *fiber.Ctx) (*types.User, error) {
+	user, ok := c.Context().UserValue("user").(*types.User)
+	if !ok {
+		return nil, ErrUnAuthenticated()
+	}
+	user, err := auth.store.User.GetUserById(c.Context(), user.ID.Hex())
+	if err != nil {
+		return nil, ErrUnAuthenticated()
+	}
+	return user, nil
+}
+
+// verifySecondFactor checks a TOTP code or a recovery code of user and uses
+// it up. Wrong codes are counted per user, apart from failed passwords, and
+// per client IP, under userPolicy and ipPolicy.
+func verifySecondFactor(c *fiber.Ctx, store *db.HotelReservationStore, userPolicy, ipPolicy types.LockoutPolicy, user *types.User, code string) error {
+	var (
+		now     = time.Now()
+		totpKey = types.TOTPLockoutKey(user.ID.Hex())
+		ipKey   = types.IPLockoutKey(c.IP())
+	)
+	lockedUntil, err := store.Lockout.LockedUntil(c.Context(), now, totpKey, ipKey)
+	if err != nil {
+		return err
+	}
+	if lockedUntil.After(now) {
+		metrics.FailedLogins.WithLabelValues(metrics.LOGIN_LOCKED_OUT).Inc()
+		return tooManyAttempts(c, lockedUntil.Sub(now))
+	}
+
+	err = useSecondFactor(c.Context(), store, user, code, now)
+	var conflict db.ConflictError
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.As(err, &conflict) {
+		metrics.FailedLogins.WithLabelValues(metrics.LOGIN_INVALID_SECOND_FACTOR).Inc()
+		if _, err := store.Lockout.RecordFailure(c.Context(), totpKey, userPolicy, now); err != nil {
+			return err
+		}
+		if _, err := store.Lockout.RecordFailure(c.Context(), ipKey, ipPolicy, now); err != nil {
+			return err
+		}
+		return NewError(http.StatusUnauthorized, "invalid two-factor code")
+	}
+	if err != nil {
+		return err
+	}
+	return store.Lockout.Reset(c.Context(), totpKey)
+}
+
+func useSecondFactor(ctx context.Context, store *db.HotelReservationStore, user *types.User, code string, now time.Time) error {
+	if !user.TOTPEnabled() {
+		return mongo.ErrNoDocuments
+	}
+	if step, ok := user.TOTP.Verify(code, now); ok {
+		return store.User.UseTOTPStep(ctx, user.ID.Hex(), step)
+	}
+	return store.User.UseRecoveryCode(ctx, user.ID.Hex(), types.HashRecoveryCode(code))
+}
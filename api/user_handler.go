@@ -1,85 +1,224 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/mail"
 	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserHandler struct {
-	store *db.HotelReservationStore
+	store        *db.HotelReservationStore
+	mailer       mail.Mailer
+	emailLockout types.LockoutPolicy
+	ipLockout    types.LockoutPolicy
 }
 
-func NewUserHandler(store *db.HotelReservationStore) *UserHandler {
+func NewUserHandler(store *db.HotelReservationStore, mailer mail.Mailer) *UserHandler {
 	return &UserHandler{
-		store: store,
+		store:        store,
+		mailer:       mailer,
+		emailLockout: types.DefaultEmailLockoutPolicy(),
+		ipLockout:    types.DefaultIPLockoutPolicy(),
+	}
+}
+
+// authorize lets users act on their own record only, unless they may manage
+// all users.
+func (h *UserHandler) authorize(c *fiber.Ctx, userID string) error {
+	user, ok := c.Context().UserValue("user").(*types.User)
+	if !ok {
+		return ErrUnAuthenticated()
 	}
+	if user.ID.Hex() == userID || canOverride(c, user, types.MANAGE_USERS, primitive.NilObjectID) {
+		return nil
+	}
+	return ErrUnAuthorized()
 }
 
 func (h *UserHandler) HandleGetUser(c *fiber.Ctx) error {
-	user, err := h.store.User.GetUserById(c.Context(), c.Params("id"))
-	if err != nil {
+	userID := c.Params("id")
+	if err := h.authorize(c, userID); err != nil {
 		return err
 	}
+	user, err := h.store.User.GetUserById(c.Context(), userID)
+	if err != nil {
+		return inventoryError(err)
+	}
 	return c.JSON(user)
 }
 
 func (h *UserHandler) HandleGetUsers(c *fiber.Ctx) error {
-	log.Info("Enter HandleGetUsers")
 	users, err := h.store.User.GetUsers(c.Context())
 	if err != nil {
-		log.Error("error occurred")
 		return err
 	}
 	return c.JSON(users)
 }
 
+// HandlePostUser lets an admin create a user, optionally with a role.
 func (h *UserHandler) HandlePostUser(c *fiber.Ctx) error {
-	log.Info("Enter HandlePostUser")
-	var params types.CreateUserParams
+	var params types.CreateUserWithRoleParams
 	if err := c.BodyParser(&params); err != nil {
 		return ErrBadRequest()
 	}
 
 	if errors := params.Validate(); len(errors) > 0 {
-		return c.JSON(errors)
+		return c.Status(http.StatusBadRequest).JSON(errors)
 	}
 
-	log.Info("Before NewUserFromParams")
-	user, err := types.NewUserFromParams(params)
-	log.Info("user = ", &user)
+	user, err := params.NewUser()
 	if err != nil {
 		return err
 	}
 
 	insertedUser, err := h.store.User.InsertUser(c.Context(), user)
 	if err != nil {
-		return err
+		return userConflict(err)
 	}
-	log.Info("insertedUser = ", &insertedUser)
+	requestLogger(c).Info("user created", "user", insertedUser)
 
 	return c.JSON(insertedUser)
 }
 
 func (h *UserHandler) HandleDeleteUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
-	if err := h.store.User.DeleteUserById(c.Context(), userID); err != nil {
+	if err := h.authorize(c, userID); err != nil {
 		return err
 	}
+	if err := h.store.User.DeleteUserById(c.Context(), userID); err != nil {
+		return inventoryError(err)
+	}
 	return c.JSON(map[string]string{"Deleted": userID})
 }
 
-func (h *UserHandler) HandlePutUser(c *fiber.Ctx) error {
+// HandlePatchUser changes the fields of the profile that are given. A new
+// email is unverified until the user follows the verification mail sent to
+// it. Since password resets go to the email, changing it takes the password
+// and second factor of whoever makes the change, and the old address is
+// told about it.
+func (h *UserHandler) HandlePatchUser(c *fiber.Ctx) error {
 	var params types.UpdateUserParams
 	userID := c.Params("id")
+	if err := h.authorize(c, userID); err != nil {
+		return err
+	}
 
 	if err := c.BodyParser(&params); err != nil {
 		return ErrBadRequest()
 	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
 
+	if params.Email != nil {
+		if err := h.reauthenticate(c, params); err != nil {
+			return err
+		}
+	}
+	user, err := h.store.User.GetUserById(c.Context(), userID)
+	if err != nil {
+		return inventoryError(err)
+	}
+	oldEmail := user.Email
+	if params.Email != nil && types.NormalizeEmail(*params.Email) == oldEmail {
+		params.Email = nil
+	}
 	if err := h.store.User.UpdateUserById(c.Context(), params, userID); err != nil {
+		return userConflict(inventoryError(err))
+	}
+	user, err = h.store.User.GetUserById(c.Context(), userID)
+	if err != nil {
+		return inventoryError(err)
+	}
+
+	if params.Email != nil {
+		if err := h.mailer.Send(c.Context(), mail.Message{
+			To:      oldEmail,
+			Subject: "Your email was changed",
+			Body:    fmt.Sprintf("The email of your account was changed to %s. If you didn't change it, contact us right away.", user.Email),
+		}); err != nil {
+			requestLogger(c).Error("sending the email change notice failed", "user", user, "error", err)
+		}
+		if err := sendVerification(c.Context(), h.store, h.mailer, user); err != nil {
+			requestLogger(c).Error("sending the verification mail failed", "user", user, "error", err)
+		}
+	}
+	return c.JSON(user)
+}
+
+// reauthenticate checks the password, and the second factor when enrolled,
+// of the user making a change, which an access token alone doesn't allow.
+func (h *UserHandler) reauthenticate(c *fiber.Ctx, params types.UpdateUserParams) error {
+	current, ok := c.Context().UserValue("user").(*types.User)
+	if !ok {
+		return ErrUnAuthenticated()
+	}
+	user, err := h.store.User.GetUserById(c.Context(), current.ID.Hex())
+	if err != nil {
+		return ErrUnAuthenticated()
+	}
+	if err := checkPassword(c, h.store, h.emailLockout, user, params.CurrentPassword); err != nil {
+		return err
+	}
+	if !user.TOTPEnabled() {
+		return nil
+	}
+	if len(params.Code) == 0 {
+		return errSecondFactorRequired()
+	}
+	return verifySecondFactor(c, h.store, h.emailLockout, h.ipLockout, user, params.Code)
+}
+
+// HandleUnlockUser lifts the login lockouts of a user, for the password and
+// the second factor. Lockouts of client IPs are left in place.
+func (h *UserHandler) HandleUnlockUser(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	user, err := h.store.User.GetUserById(c.Context(), userID)
+	if err != nil {
+		return inventoryError(err)
+	}
+	if err := h.store.Lockout.Reset(c.Context(), types.EmailLockoutKey(user.Email)); err != nil {
+		return err
+	}
+	if err := h.store.Lockout.Reset(c.Context(), types.TOTPLockoutKey(userID)); err != nil {
+		return err
+	}
+	return c.JSON(map[string]string{"Unlocked": userID})
+}
+
+// HandlePutUserRole assigns the role of a user and the hotels it applies to.
+func (h *UserHandler) HandlePutUserRole(c *fiber.Ctx) error {
+	var params types.UpdateRoleParams
+	userID := c.Params("id")
+
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(errors)
+	}
+
+	if err := h.store.User.SetUserRole(c.Context(), userID, params.Role, params.ObjectHotelIDs()); err != nil {
+		return inventoryError(err)
+	}
+	user, err := h.store.User.GetUserById(c.Context(), userID)
+	if err != nil {
 		return err
 	}
-	return c.JSON(map[string]string{"Updated": userID})
+	return c.JSON(user)
+}
+
+// userConflict answers a taken email with 409 Conflict.
+func userConflict(err error) error {
+	var conflict db.ConflictError
+	if errors.As(err, &conflict) {
+		return NewError(http.StatusConflict, conflict.Error())
+	}
+	return err
 }
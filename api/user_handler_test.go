@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/go-faker/faker/v4"
 	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/db/fixtures"
 	"github.com/swarajroy/hotel-reservation/db/mongo"
+	"github.com/swarajroy/hotel-reservation/mail"
 	"github.com/swarajroy/hotel-reservation/types"
 	userfixtures "github.com/swarajroy/hotel-reservation/types/user_fixtures"
 )
@@ -34,15 +39,18 @@ func (suite *UserHandlerSuite) SetupSuite() {
 	}
 
 	suite.testMongoClient = client
-	userStore := db.NewMongoDbUserStore(suite.testMongoClient.Client, DB_NAME)
-	hotelStore := db.NewMongoDbHotelStore(suite.testMongoClient.Client, DB_NAME)
-	roomStore := db.NewMongoDbRoomStore(suite.testMongoClient.Client, DB_NAME, hotelStore)
-	bookingStore := db.NewMongoDbBookingStore(suite.testMongoClient.Client, DB_NAME)
-	store := db.NewHotelReservationStore(userStore, hotelStore, roomStore, bookingStore)
+	userStore := db.NewMongoDbUserStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	hotelStore := db.NewMongoDbHotelStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	roomStore := db.NewMongoDbRoomStore(suite.testMongoClient.Client, suite.testMongoClient.Config(), hotelStore)
+	bookingStore := db.NewMongoDbBookingStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	tokenStore := db.NewMongoDbTokenStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	lockoutStore := db.NewMongoDbLockoutStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	apiKeyStore := db.NewMongoDbAPIKeyStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+	store := db.NewHotelReservationStore(userStore, hotelStore, roomStore, bookingStore, tokenStore, lockoutStore, apiKeyStore)
 	suite.store = store
 
 	suite.testMongoClient = client
-	suite.userHandler = NewUserHandler(store)
+	suite.userHandler = NewUserHandler(store, mail.NewLogMailer(io.Discard))
 }
 
 func (suite *UserHandlerSuite) TearDownSuite() {
@@ -114,7 +122,7 @@ func (suite *UserHandlerSuite) TestGetByID() {
 	}
 
 	app := fiber.New()
-	app.Get(GET_BY_ID_ROUTE, suite.userHandler.HandleGetUser)
+	app.Get(GET_BY_ID_ROUTE, withUser(expected), suite.userHandler.HandleGetUser)
 
 	req := httptest.NewRequest("GET", strings.Replace(GET_BY_ID_ROUTE, ":id", expected.ID.Hex(), -1), nil)
 	resp, _ := app.Test(req)
@@ -127,6 +135,106 @@ func (suite *UserHandlerSuite) TestGetByID() {
 	}
 }
 
+func TestUsersOnlyManageTheirOwnRecord(t *testing.T) {
+	var (
+		ctx         = context.Background()
+		tdb         = Setup(t, ctx)
+		store       = tdb.store
+		james       = fixtures.AddUser(store, "james", "foo", false)
+		alice       = fixtures.AddUser(store, "alice", "bar", false)
+		admin       = fixtures.AddUser(store, "admin", "admin", true)
+		userHandler = NewUserHandler(store, mail.NewLogMailer(io.Discard))
+	)
+	defer tdb.TearDown(t, ctx)
+
+	send := func(as *types.User, method, id string) int {
+		app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		app.Get("/users/:id", withUser(as), userHandler.HandleGetUser)
+		app.Put("/users/:id", withUser(as), userHandler.HandlePatchUser)
+		app.Delete("/users/:id", withUser(as), userHandler.HandleDeleteUser)
+
+		b, _ := json.Marshal(map[string]string{"firstName": "jimmy"})
+		req := httptest.NewRequest(method, "/users/"+id, bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			var apiErr Error
+			json.NewDecoder(resp.Body).Decode(&apiErr)
+			assert.Equal(t, resp.StatusCode, apiErr.Code)
+		}
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, send(james, "GET", james.ID.Hex()))
+	assert.Equal(t, http.StatusOK, send(james, "PUT", james.ID.Hex()))
+	assert.Equal(t, http.StatusForbidden, send(james, "GET", alice.ID.Hex()))
+	assert.Equal(t, http.StatusForbidden, send(james, "PUT", alice.ID.Hex()))
+	assert.Equal(t, http.StatusForbidden, send(james, "DELETE", alice.ID.Hex()))
+	assert.Equal(t, http.StatusOK, send(admin, "GET", alice.ID.Hex()))
+	assert.Equal(t, http.StatusOK, send(admin, "DELETE", alice.ID.Hex()))
+	assert.Equal(t, http.StatusBadRequest, send(admin, "GET", alice.ID.Hex()))
+}
+
+func TestPatchUser(t *testing.T) {
+	var (
+		ctx         = context.Background()
+		tdb         = Setup(t, ctx)
+		store       = tdb.store
+		james       = fixtures.AddUser(store, "james", "foo", false)
+		alice       = fixtures.AddUser(store, "alice", "bar", false)
+		mailer      = &testMailer{}
+		userHandler = NewUserHandler(store, mailer)
+		app         = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	)
+	defer tdb.TearDown(t, ctx)
+	if err := store.User.SetEmailVerified(ctx, james.ID.Hex(), true); err != nil {
+		t.Fatal(err)
+	}
+	app.Patch("/users/:id", withUser(james), userHandler.HandlePatchUser)
+
+	patch := func(body map[string]string) (int, *types.User) {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest("PATCH", "/users/"+james.ID.Hex(), bytes.NewReader(b))
+		req.Header.Add("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var user types.User
+		json.NewDecoder(resp.Body).Decode(&user)
+		return resp.StatusCode, &user
+	}
+
+	status, user := patch(map[string]string{"firstName": "jimmy"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "jimmy", user.FirstName)
+	assert.Equal(t, "foo", user.LastName)
+	assert.True(t, user.EmailVerified)
+	assert.Empty(t, mailer.sent)
+
+	status, _ = patch(map[string]string{"lastName": ""})
+	assert.Equal(t, http.StatusBadRequest, status)
+	// an access token alone can't change the email password resets go to
+	status, _ = patch(map[string]string{"email": "jimmy@foo.com"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = patch(map[string]string{"email": "jimmy@foo.com", "currentPassword": "wrong"})
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = patch(map[string]string{"email": alice.Email, "currentPassword": "james_foo"})
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, user = patch(map[string]string{"email": "jimmy@foo.com", "currentPassword": "james_foo"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "jimmy@foo.com", user.Email)
+	assert.False(t, user.EmailVerified)
+	assert.Len(t, mailer.sent, 2)
+	assert.Equal(t, james.Email, mailer.sent[0].To)
+	assert.Contains(t, mailer.sent[0].Body, "jimmy@foo.com")
+	assert.Equal(t, "jimmy@foo.com", mailer.sent[1].To)
+}
+
 func TestUserHandlerSuite(t *testing.T) {
 	suite.Run(t, new(UserHandlerSuite))
 }
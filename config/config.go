@@ -0,0 +1,335 @@
+// Package config holds the settings of the API server. They are loaded from,
+// in increasing order of precedence, the defaults, an optional YAML file,
+// environment variables and command line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultListenAddr = ":3000"
+	// DefaultMetricsAddr is kept apart from the API so that the metrics
+	// aren't reachable wherever the API is published
+	DefaultMetricsAddr = ":9090"
+	// DefaultShutdownTimeout is spent at most twice on shutdown, draining
+	// requests and running hooks, which fits the stop_grace_period of
+	// docker-compose.yml
+	DefaultShutdownTimeout = 10 * time.Second
+	DefaultMongoURI        = "mongodb://localhost:27017"
+	DefaultDatabase        = "hotel-reservation"
+	DefaultTokenIssuer     = "hotel-reservation"
+	DefaultTokenAudience   = "hotel-reservation-api"
+	DefaultTokenKeyID      = "default"
+	DefaultMailFrom        = "no-reply@hotel-reservation.local"
+	DefaultLogLevel        = "info"
+)
+
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+type Config struct {
+	Server       Server       `yaml:"server"`
+	Mongo        Mongo        `yaml:"mongo"`
+	JWT          JWT          `yaml:"jwt"`
+	Mail         Mail         `yaml:"mail"`
+	Cancellation Cancellation `yaml:"cancellation"`
+	Log          Log          `yaml:"log"`
+}
+
+type Server struct {
+	ListenAddr string `yaml:"listenAddr"`
+	// ShutdownTimeout bounds the wait for requests in flight on shutdown and
+	// again for the shutdown hooks.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// TrustedProxies are the comma separated IPs and CIDR ranges of the
+	// reverse proxies in front of the server. Only their X-Real-IP header
+	// is taken as the client IP, which lockouts and logs are keyed by.
+	TrustedProxies string `yaml:"trustedProxies"`
+	// MetricsAddr is where /metrics is served, on a listener of its own
+	// that is only meant to be reachable by the scraper.
+	MetricsAddr string `yaml:"metricsAddr"`
+}
+
+// TrustedProxyList returns the entries of TrustedProxies.
+func (s Server) TrustedProxyList() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(s.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); len(proxy) > 0 {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+type Mongo struct {
+	URI      string `yaml:"uri"`
+	Database string `yaml:"database"`
+}
+
+type JWT struct {
+	// Secret signs tokens with HS256 when there is no KeyFile. It is not a
+	// flag so it doesn't show up in the process list.
+	Secret string `yaml:"secret"`
+	// KeyFile is a PEM file of the RSA or Ed25519 key signing tokens.
+	KeyFile string `yaml:"keyFile"`
+	KeyID   string `yaml:"keyID"`
+	// VerifyKeys are kid=file PEM keys of earlier signing keys whose tokens
+	// are still accepted, separated by commas.
+	VerifyKeys string `yaml:"verifyKeys"`
+	Issuer     string `yaml:"issuer"`
+	Audience   string `yaml:"audience"`
+}
+
+type Mail struct {
+	// SMTPAddr is the host:port of the SMTP server, mail is written to File
+	// when it is empty.
+	SMTPAddr     string `yaml:"smtpAddr"`
+	SMTPUser     string `yaml:"smtpUser"`
+	SMTPPassword string `yaml:"smtpPassword"`
+	From         string `yaml:"from"`
+	// File is appended to when there is no SMTP server, mail is logged to
+	// stdout when both are empty.
+	File string `yaml:"file"`
+}
+
+type Cancellation struct {
+	FreeUntil time.Duration `yaml:"freeUntil"`
+	LateFee   float64       `yaml:"lateFee"`
+	AllowLate bool          `yaml:"allowLate"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is json, which log collectors parse, or text for humans.
+	Format string `yaml:"format"`
+}
+
+func (c Cancellation) Policy() types.CancellationPolicy {
+	return types.CancellationPolicy{
+		FreeUntil: c.FreeUntil,
+		LateFee:   c.LateFee,
+		AllowLate: c.AllowLate,
+	}
+}
+
+func Default() *Config {
+	policy := types.DefaultCancellationPolicy()
+	return &Config{
+		Server: Server{ListenAddr: DefaultListenAddr, ShutdownTimeout: DefaultShutdownTimeout, MetricsAddr: DefaultMetricsAddr},
+		Mongo:  Mongo{URI: DefaultMongoURI, Database: DefaultDatabase},
+		JWT: JWT{
+			KeyID:    DefaultTokenKeyID,
+			Issuer:   DefaultTokenIssuer,
+			Audience: DefaultTokenAudience,
+		},
+		Mail: Mail{From: DefaultMailFrom},
+		Cancellation: Cancellation{
+			FreeUntil: policy.FreeUntil,
+			LateFee:   policy.LateFee,
+			AllowLate: policy.AllowLate,
+		},
+		Log: Log{Level: DefaultLogLevel, Format: LogFormatJSON},
+	}
+}
+
+// flagEnv names the environment variable of each flag.
+var flagEnv = map[string]string{
+	"listenAddr":            "LISTEN_ADDR",
+	"shutdownTimeout":       "SHUTDOWN_TIMEOUT",
+	"trustedProxies":        "TRUSTED_PROXIES",
+	"metricsAddr":           "METRICS_ADDR",
+	"mongoURI":              "MONGO_URI",
+	"mongoDatabase":         "MONGO_DATABASE",
+	"jwtIssuer":             "JWT_ISSUER",
+	"jwtAudience":           "JWT_AUDIENCE",
+	"jwtKeyID":              "JWT_KEY_ID",
+	"jwtKeyFile":            "JWT_KEY_FILE",
+	"jwtVerifyKeys":         "JWT_VERIFY_KEYS",
+	"smtpAddr":              "SMTP_ADDR",
+	"smtpUser":              "SMTP_USER",
+	"mailFrom":              "MAIL_FROM",
+	"mailFile":              "MAIL_FILE",
+	"freeCancellation":      "FREE_CANCELLATION",
+	"lateCancellationFee":   "LATE_CANCELLATION_FEE",
+	"allowLateCancellation": "ALLOW_LATE_CANCELLATION",
+	"logLevel":              "LOG_LEVEL",
+	"logFormat":             "LOG_FORMAT",
+}
+
+// register defines the flags of cfg on fs, defaulting to the current values.
+// The path of the config file is stored in file.
+func (cfg *Config) register(fs *flag.FlagSet, file *string) {
+	fs.StringVar(file, "config", *file, "YAML file with the settings, also read from CONFIG_FILE")
+	fs.StringVar(&cfg.Server.ListenAddr, "listenAddr", cfg.Server.ListenAddr, "The API Servers port")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdownTimeout", cfg.Server.ShutdownTimeout, "How long requests in flight may take to finish on shutdown")
+	fs.StringVar(&cfg.Server.TrustedProxies, "trustedProxies", cfg.Server.TrustedProxies, "Comma separated IPs and CIDR ranges of reverse proxies whose X-Real-IP header is trusted")
+	fs.StringVar(&cfg.Server.MetricsAddr, "metricsAddr", cfg.Server.MetricsAddr, "The address /metrics is served on, apart from the API")
+	fs.StringVar(&cfg.Mongo.URI, "mongoURI", cfg.Mongo.URI, "The MongoDB connection string")
+	fs.StringVar(&cfg.Mongo.Database, "mongoDatabase", cfg.Mongo.Database, "The MongoDB database")
+	fs.StringVar(&cfg.JWT.Issuer, "jwtIssuer", cfg.JWT.Issuer, "The iss claim of issued tokens")
+	fs.StringVar(&cfg.JWT.Audience, "jwtAudience", cfg.JWT.Audience, "The aud claim of issued tokens")
+	fs.StringVar(&cfg.JWT.KeyID, "jwtKeyID", cfg.JWT.KeyID, "The kid of the signing key")
+	fs.StringVar(&cfg.JWT.KeyFile, "jwtKeyFile", cfg.JWT.KeyFile, "PEM file of the RSA or Ed25519 key signing tokens, tokens are signed with JWT_SECRET when empty")
+	fs.StringVar(&cfg.JWT.VerifyKeys, "jwtVerifyKeys", cfg.JWT.VerifyKeys, "Comma separated kid=file PEM keys of earlier signing keys whose tokens are still accepted")
+	fs.StringVar(&cfg.Mail.SMTPAddr, "smtpAddr", cfg.Mail.SMTPAddr, "host:port of the SMTP server sending mail, mail is written to mailFile when empty")
+	fs.StringVar(&cfg.Mail.SMTPUser, "smtpUser", cfg.Mail.SMTPUser, "The SMTP user, authenticated with the SMTP_PASSWORD environment variable")
+	fs.StringVar(&cfg.Mail.From, "mailFrom", cfg.Mail.From, "The sender of mails")
+	fs.StringVar(&cfg.Mail.File, "mailFile", cfg.Mail.File, "File mail is appended to when there is no SMTP server, mail is logged to stdout when empty")
+	fs.DurationVar(&cfg.Cancellation.FreeUntil, "freeCancellation", cfg.Cancellation.FreeUntil, "How long before check-in guests can cancel a booking free of charge")
+	fs.Float64Var(&cfg.Cancellation.LateFee, "lateCancellationFee", cfg.Cancellation.LateFee, "Fraction of the stay price charged for a late cancellation")
+	fs.BoolVar(&cfg.Cancellation.AllowLate, "allowLateCancellation", cfg.Cancellation.AllowLate, "Whether guests can cancel after the free cancellation period")
+	fs.StringVar(&cfg.Log.Level, "logLevel", cfg.Log.Level, "The lowest level logged: debug, info, warn or error")
+	fs.StringVar(&cfg.Log.Format, "logFormat", cfg.Log.Format, "The log format: json or text")
+}
+
+// Load returns the validated config of the command line args, without the
+// program name, and the environment read with getenv.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	// the flags are parsed once to find the config file and again after the
+	// file and environment were read, so that they override both
+	var file string
+	fs := flag.NewFlagSet("hotel-reservation", flag.ContinueOnError)
+	Default().register(fs, &file)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if len(file) == 0 {
+		file = getenv("CONFIG_FILE")
+	}
+
+	cfg := Default()
+	if len(file) > 0 {
+		if err := cfg.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(getenv); err != nil {
+		return nil, err
+	}
+	fs = flag.NewFlagSet("hotel-reservation", flag.ContinueOnError)
+	cfg.register(fs, &file)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) loadEnv(getenv func(string) string) error {
+	var file string
+	fs := flag.NewFlagSet("env", flag.ContinueOnError)
+	cfg.register(fs, &file)
+	for name, env := range flagEnv {
+		value := getenv(env)
+		if len(value) == 0 {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", env, err)
+		}
+	}
+	if secret := getenv("JWT_SECRET"); len(secret) > 0 {
+		cfg.JWT.Secret = secret
+	}
+	if password := getenv("SMTP_PASSWORD"); len(password) > 0 {
+		cfg.Mail.SMTPPassword = password
+	}
+	return nil
+}
+
+// Validate reports every setting that is missing or out of range.
+func (cfg *Config) Validate() error {
+	problems := map[string]string{}
+	if len(cfg.Server.ListenAddr) == 0 {
+		problems["listenAddr"] = "is required"
+	}
+	if len(cfg.Server.MetricsAddr) == 0 {
+		problems["metricsAddr"] = "is required"
+	} else if cfg.Server.MetricsAddr == cfg.Server.ListenAddr {
+		problems["metricsAddr"] = "should differ from listenAddr"
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		problems["shutdownTimeout"] = "should be positive"
+	}
+	for _, proxy := range cfg.Server.TrustedProxyList() {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems["trustedProxies"] = fmt.Sprintf("%s is not an IP or a CIDR range", proxy)
+		}
+	}
+	if !strings.HasPrefix(cfg.Mongo.URI, "mongodb://") && !strings.HasPrefix(cfg.Mongo.URI, "mongodb+srv://") {
+		problems["mongoURI"] = "should start with mongodb:// or mongodb+srv://"
+	}
+	if len(cfg.Mongo.Database) == 0 {
+		problems["mongoDatabase"] = "is required"
+	}
+	if len(cfg.JWT.Secret) == 0 && len(cfg.JWT.KeyFile) == 0 {
+		problems["jwtKeyFile"] = "is required when JWT_SECRET is not set"
+	}
+	if len(cfg.JWT.Issuer) == 0 {
+		problems["jwtIssuer"] = "is required"
+	}
+	if len(cfg.JWT.Audience) == 0 {
+		problems["jwtAudience"] = "is required"
+	}
+	if len(cfg.Mail.From) == 0 {
+		problems["mailFrom"] = "is required"
+	}
+	if cfg.Cancellation.FreeUntil < 0 {
+		problems["freeCancellation"] = "can't be negative"
+	}
+	if cfg.Cancellation.LateFee < 0 || cfg.Cancellation.LateFee > 1 {
+		problems["lateCancellationFee"] = "should be between 0 and 1"
+	}
+	switch strings.ToLower(cfg.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		problems["logLevel"] = "should be debug, info, warn or error"
+	}
+	if cfg.Log.Format != LogFormatJSON && cfg.Log.Format != LogFormatText {
+		problems["logFormat"] = "should be json or text"
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(problems))
+	for name := range problems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]error, 0, len(names))
+	for _, name := range names {
+		errs = append(errs, fmt.Errorf("%s %s", name, problems[name]))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"JWT_SECRET": "secret"}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, Server{ListenAddr: DefaultListenAddr, ShutdownTimeout: DefaultShutdownTimeout, MetricsAddr: DefaultMetricsAddr}, cfg.Server)
+	assert.Equal(t, Mongo{URI: DefaultMongoURI, Database: DefaultDatabase}, cfg.Mongo)
+	assert.Equal(t, "secret", cfg.JWT.Secret)
+	assert.Equal(t, DefaultTokenIssuer, cfg.JWT.Issuer)
+	assert.Equal(t, 48*time.Hour, cfg.Cancellation.Policy().FreeUntil)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+server:
+  listenAddr: ":8080"
+mongo:
+  uri: "mongodb://file:27017"
+  database: "from-file"
+jwt:
+  secret: "file-secret"
+cancellation:
+  freeUntil: "24h"
+  lateFee: 0.25
+`
+	if err := os.WriteFile(file, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{
+		"CONFIG_FILE":     file,
+		"MONGO_URI":       "mongodb://mongo:27017",
+		"MONGO_DATABASE":  "from-env",
+		"JWT_SECRET":      "env-secret",
+		"TRUSTED_PROXIES": "172.28.0.0/16, 10.0.0.1",
+	}
+
+	cfg, err := Load([]string{"-mongoDatabase", "from-flag"}, env(vars))
+
+	assert.Nil(t, err)
+	assert.Equal(t, ":8080", cfg.Server.ListenAddr)
+	assert.Equal(t, "mongodb://mongo:27017", cfg.Mongo.URI)
+	assert.Equal(t, "from-flag", cfg.Mongo.Database)
+	assert.Equal(t, "env-secret", cfg.JWT.Secret)
+	assert.Equal(t, []string{"172.28.0.0/16", "10.0.0.1"}, cfg.Server.TrustedProxyList())
+	assert.Equal(t, 24*time.Hour, cfg.Cancellation.FreeUntil)
+	assert.Equal(t, 0.25, cfg.Cancellation.LateFee)
+	assert.True(t, cfg.Cancellation.AllowLate)
+
+	// the flag names the file instead of CONFIG_FILE
+	delete(vars, "CONFIG_FILE")
+	cfg, err = Load([]string{"-config", file}, env(vars))
+	assert.Nil(t, err)
+	assert.Equal(t, ":8080", cfg.Server.ListenAddr)
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	_, err := Load(nil, env(nil))
+	assert.ErrorContains(t, err, "jwtKeyFile")
+
+	_, err = Load(nil, env(map[string]string{"JWT_SECRET": "secret", "FREE_CANCELLATION": "two days"}))
+	assert.ErrorContains(t, err, "FREE_CANCELLATION")
+
+	_, err = Load([]string{"-mongoURI", "localhost:27017", "-lateCancellationFee", "2", "-shutdownTimeout", "0s"}, env(map[string]string{"JWT_SECRET": "secret"}))
+	assert.ErrorContains(t, err, "mongoURI")
+	assert.ErrorContains(t, err, "shutdownTimeout")
+	assert.ErrorContains(t, err, "lateCancellationFee")
+
+	_, err = Load(nil, env(map[string]string{"JWT_SECRET": "secret", "TRUSTED_PROXIES": "10.0.0.1, nginx"}))
+	assert.ErrorContains(t, err, "trustedProxies nginx is not an IP or a CIDR range")
+
+	_, err = Load([]string{"-metricsAddr", ":3000"}, env(map[string]string{"JWT_SECRET": "secret"}))
+	assert.ErrorContains(t, err, "metricsAddr")
+
+	_, err = Load(nil, env(map[string]string{"JWT_SECRET": "secret", "LOG_LEVEL": "verbose", "LOG_FORMAT": "xml"}))
+	assert.ErrorContains(t, err, "logLevel")
+	assert.ErrorContains(t, err, "logFormat")
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("mongo:\n  url: \"mongodb://mongo:27017\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load([]string{"-config", file}, env(map[string]string{"JWT_SECRET": "secret"}))
+	assert.ErrorContains(t, err, "url")
+}
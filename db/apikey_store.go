@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/config"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	API_KEY_COLL = "apiKeys"
+)
+
+type APIKeyStore interface {
+	Dropper
+	InsertAPIKey(context.Context, *types.APIKey) (*types.APIKey, error)
+	GetAPIKeys(context.Context) ([]*types.APIKey, error)
+	// UseAPIKey records a use at now of the active key with hash and returns
+	// it. A revoked, expired or unknown key gives mongo.ErrNoDocuments.
+	UseAPIKey(ctx context.Context, hash string, now time.Time) (*types.APIKey, error)
+	// RevokeAPIKey revokes the key with id at now. A key that is unknown or
+	// already revoked gives mongo.ErrNoDocuments.
+	RevokeAPIKey(ctx context.Context, id string, now time.Time) error
+}
+
+type MongoDbAPIKeyStore struct {
+	client *mongo.Client
+	coll   *mongo.Collection
+}
+
+func NewMongoDbAPIKeyStore(client *mongo.Client, cfg config.Mongo) *MongoDbAPIKeyStore {
+	return &MongoDbAPIKeyStore{
+		client: client,
+		coll:   client.Database(cfg.Database).Collection(API_KEY_COLL),
+	}
+}
+
+// EnsureIndexes makes key hashes unique.
+func (s *MongoDbAPIKeyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (s *MongoDbAPIKeyStore) Drop(ctx context.Context) error {
+	return s.coll.Drop(ctx)
+}
+
+func (s *MongoDbAPIKeyStore) InsertAPIKey(ctx context.Context, key *types.APIKey) (*types.APIKey, error) {
+	res, err := s.coll.InsertOne(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = res.InsertedID.(primitive.ObjectID)
+	return key, nil
+}
+
+func (s *MongoDbAPIKeyStore) GetAPIKeys(ctx context.Context) ([]*types.APIKey, error) {
+	cur, err := s.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	keys := []*types.APIKey{}
+	if err := cur.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *MongoDbAPIKeyStore) UseAPIKey(ctx context.Context, hash string, now time.Time) (*types.APIKey, error) {
+	var (
+		key  types.APIKey
+		opts = options.FindOneAndUpdate().SetReturnDocument(options.After)
+	)
+	if err := s.coll.FindOneAndUpdate(ctx, ActiveAPIKeyFilter(hash, now), APIKeyUse(now), opts).Decode(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *MongoDbAPIKeyStore) RevokeAPIKey(ctx context.Context, id string, now time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	filter := bson.M{"_id": oid, "revokedAt": bson.M{"$exists": false}}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": now}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// ActiveAPIKeyFilter matches the key with hash when it can be used at now.
+func ActiveAPIKeyFilter(hash string, now time.Time) bson.M {
+	return bson.M{
+		"hash":      hash,
+		"revokedAt": bson.M{"$exists": false},
+		"$or": []bson.M{
+			{"expiresAt": bson.M{"$exists": false}},
+			{"expiresAt": bson.M{"$gt": now}},
+		},
+	}
+}
+
+// APIKeyUse is the update recording a use of a key at now.
+func APIKeyUse(now time.Time) bson.M {
+	return bson.M{
+		"$set": bson.M{"lastUsedAt": now},
+		"$inc": bson.M{"useCount": 1},
+	}
+}
@@ -3,53 +3,359 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/swarajroy/hotel-reservation/config"
+	"github.com/swarajroy/hotel-reservation/logging"
 	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	BOOKING_COLL = "bookings"
+	BOOKING_COLL     = "bookings"
+	RESERVATION_COLL = "reservations"
 )
 
 type BookingStore interface {
 	Dropper
 	InsertBooking(context.Context, *types.Booking) (*types.Booking, error)
-	GetBookings(ctx context.Context, filter map[string]any) ([]*types.Booking, error)
+	// BookRoom atomically checks that the booked room is free for the
+	// requested dates and inserts the booking. It returns a ConflictError when
+	// the room is already reserved.
+	BookRoom(context.Context, *types.Booking) (*types.Booking, error)
+	// ModifyBooking moves the booking with the ID of booking to its room, dates
+	// and number of persons. The original slot is kept when the new one is
+	// taken, in which case a ConflictError is returned.
+	ModifyBooking(ctx context.Context, booking *types.Booking) error
+	// CancelBooking records the cancellation on the booking and releases its
+	// dates. It returns a ConflictError when the booking is already cancelled.
+	CancelBooking(ctx context.Context, id string, cancellation types.Cancellation) error
+	// FindOverlapping returns the bookings of the room that are not cancelled
+	// and share at least one night with the stay from..till.
+	FindOverlapping(ctx context.Context, roomID primitive.ObjectID, from, till time.Time) ([]*types.Booking, error)
+	GetBookings(ctx context.Context, filter map[string]any, pag *Pagination) ([]*types.Booking, error)
 	GetBooking(ctx context.Context, id string) (*types.Booking, error)
 	UpdateBookingById(context.Context, string, map[string]any) error
 }
 
+// CancellationUpdate returns the booking fields that record cancellation.
+func CancellationUpdate(cancellation types.Cancellation) map[string]any {
+	if cancellation.At.IsZero() {
+		cancellation.At = time.Now()
+	}
+	update := map[string]any{
+		"cancelledAt":     cancellation.At,
+		"cancellationFee": cancellation.Fee,
+	}
+	if !cancellation.By.IsZero() {
+		update["cancelledBy"] = cancellation.By
+	}
+	if len(cancellation.Reason) > 0 {
+		update["cancellationReason"] = cancellation.Reason
+	}
+	return update
+}
+
+// OverlappingBookingsFilter matches the active bookings of roomID that share a
+// night with the stay from..till. Two stays overlap when each one checks in
+// before the other checks out; the check-out day itself is free.
+func OverlappingBookingsFilter(roomID primitive.ObjectID, from, till time.Time) bson.M {
+	filter := activeStayFilter(from, till)
+	filter["roomID"] = roomID
+	return filter
+}
+
+// activeStayFilter matches the active bookings of any room that share a night
+// with the stay from..till.
+func activeStayFilter(from, till time.Time) bson.M {
+	return bson.M{
+		"cancelledAt": bson.M{"$exists": false},
+		"fromDate":    bson.M{"$lt": types.StayDay(till)},
+		"tillDate":    bson.M{"$gte": types.StayDay(from).AddDate(0, 0, 1)},
+	}
+}
+
+// reservation is an entry of the per-room ledger kept in RESERVATION_COLL.
+// Every room has a single ledger document, so checking for an overlap and
+// recording a new reservation is one atomic update on that document. The
+// dates are stored as stay days, see types.StayDay.
+type reservation struct {
+	BookingID primitive.ObjectID `bson:"bookingID"`
+	FromDate  time.Time          `bson:"fromDate"`
+	TillDate  time.Time          `bson:"tillDate"`
+}
+
 type MongoDbBookingStore struct {
-	client      *mongo.Client
-	bookingColl *mongo.Collection
+	client          *mongo.Client
+	bookingColl     *mongo.Collection
+	reservationColl *mongo.Collection
 }
 
-func NewMongoDbBookingStore(client *mongo.Client, dbname string) *MongoDbBookingStore {
+func NewMongoDbBookingStore(client *mongo.Client, cfg config.Mongo) *MongoDbBookingStore {
 	return &MongoDbBookingStore{
-		client:      client,
-		bookingColl: client.Database(dbname).Collection(BOOKING_COLL),
+		client:          client,
+		bookingColl:     client.Database(cfg.Database).Collection(BOOKING_COLL),
+		reservationColl: client.Database(cfg.Database).Collection(RESERVATION_COLL),
 	}
 }
 
 func (s *MongoDbBookingStore) Drop(ctx context.Context) error {
-	fmt.Println("--- dropping booking collection ---")
+	logging.FromContext(ctx).Info("dropping collections", "collections", []string{BOOKING_COLL, RESERVATION_COLL})
+	if err := s.reservationColl.Drop(ctx); err != nil {
+		return err
+	}
 	return s.bookingColl.Drop(ctx)
 }
 
+// BackfillReservations puts the active bookings missing from their room's
+// ledger on it, which are the bookings made before the ledger existed.
+// Without their entries BookRoom would book over them and ModifyBooking
+// would refuse to move them. It is safe to run on every start.
+func (s *MongoDbBookingStore) BackfillReservations(ctx context.Context) error {
+	cur, err := s.bookingColl.Find(ctx, bson.M{"cancelledAt": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	var bookings []*types.Booking
+	if err := cur.All(ctx, &bookings); err != nil {
+		return err
+	}
+	backfilled := 0
+	for _, booking := range bookings {
+		// an existing ledger already holding the booking doesn't match, so
+		// the upsert tries to insert a second ledger for the room and fails
+		// with a duplicate key error
+		filter := bson.M{
+			"_id":                    booking.RoomID,
+			"reservations.bookingID": bson.M{"$ne": booking.ID},
+		}
+		update := bson.M{"$push": bson.M{"reservations": newReservation(booking)}}
+		_, err := s.reservationColl.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		backfilled++
+	}
+	if backfilled > 0 {
+		logging.FromContext(ctx).Info("backfilled room reservations", "bookings", backfilled)
+	}
+	return nil
+}
+
 func (s *MongoDbBookingStore) InsertBooking(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
 	res, err := s.bookingColl.InsertOne(ctx, booking)
 	if err != nil {
 		return nil, err
 	}
 	booking.ID = res.InsertedID.(primitive.ObjectID)
+
+	// keep the ledger in step with bookings that bypass BookRoom, e.g. fixtures
+	if booking.CancelledAt.IsZero() {
+		filter := bson.M{"_id": booking.RoomID}
+		update := bson.M{"$push": bson.M{"reservations": newReservation(booking)}}
+		if _, err := s.reservationColl.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+			return nil, err
+		}
+	}
+	return booking, nil
+}
+
+func (s *MongoDbBookingStore) BookRoom(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
+	if booking.ID.IsZero() {
+		booking.ID = primitive.NewObjectID()
+	}
+	if err := s.reserve(ctx, booking); err != nil {
+		return nil, err
+	}
+	if _, err := s.bookingColl.InsertOne(ctx, booking); err != nil {
+		if releaseErr := s.release(ctx, booking.RoomID, booking.ID); releaseErr != nil {
+			return nil, fmt.Errorf("%w (releasing reservation failed: %s)", err, releaseErr.Error())
+		}
+		return nil, err
+	}
 	return booking, nil
 }
 
-func (s *MongoDbBookingStore) GetBookings(ctx context.Context, filter map[string]any) ([]*types.Booking, error) {
-	resp, err := s.bookingColl.Find(ctx, filter)
+// reserve pushes the booking onto its room's ledger unless an existing entry
+// overlaps it. When the ledger document exists but the overlap check fails the
+// upsert tries to insert a second document with the same _id, which MongoDB
+// rejects with a duplicate key error.
+func (s *MongoDbBookingStore) reserve(ctx context.Context, booking *types.Booking) error {
+	filter := bson.M{
+		"_id": booking.RoomID,
+		"reservations": bson.M{
+			"$not": bson.M{
+				"$elemMatch": bson.M{
+					"fromDate": bson.M{"$lt": types.StayDay(booking.TillDate)},
+					"tillDate": bson.M{"$gt": types.StayDay(booking.FromDate)},
+				},
+			},
+		},
+	}
+	update := bson.M{"$push": bson.M{"reservations": newReservation(booking)}}
+	opts := options.Update().SetUpsert(true)
+
+	var err error
+	// two first-time bookings of a room can race on creating its ledger
+	// document, so a duplicate key error is retried once before it is
+	// reported as a conflict
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err = s.reservationColl.UpdateOne(ctx, filter, update, opts)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return NewConflictError(fmt.Sprintf("room %s is not available for the requested dates", booking.RoomID.Hex()))
+}
+
+// reschedule changes the dates of the booking's entry on its room's ledger
+// unless they overlap another entry. The check and the change are a single
+// update of the ledger document, so the booking either gets the new dates or
+// keeps the old ones.
+func (s *MongoDbBookingStore) reschedule(ctx context.Context, booking *types.Booking) error {
+	filter := bson.M{
+		"_id":                    booking.RoomID,
+		"reservations.bookingID": booking.ID,
+		"reservations": bson.M{
+			"$not": bson.M{
+				"$elemMatch": bson.M{
+					"bookingID": bson.M{"$ne": booking.ID},
+					"fromDate":  bson.M{"$lt": types.StayDay(booking.TillDate)},
+					"tillDate":  bson.M{"$gt": types.StayDay(booking.FromDate)},
+				},
+			},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"reservations.$[r].fromDate": types.StayDay(booking.FromDate),
+		"reservations.$[r].tillDate": types.StayDay(booking.TillDate),
+	}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []any{bson.M{"r.bookingID": booking.ID}},
+	})
+	res, err := s.reservationColl.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return NewConflictError(fmt.Sprintf("room %s is not available for the requested dates", booking.RoomID.Hex()))
+	}
+	return nil
+}
+
+func (s *MongoDbBookingStore) release(ctx context.Context, roomID, bookingID primitive.ObjectID) error {
+	filter := bson.M{"_id": roomID}
+	update := bson.M{"$pull": bson.M{"reservations": bson.M{"bookingID": bookingID}}}
+	_, err := s.reservationColl.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func newReservation(booking *types.Booking) reservation {
+	return reservation{
+		BookingID: booking.ID,
+		FromDate:  types.StayDay(booking.FromDate),
+		TillDate:  types.StayDay(booking.TillDate),
+	}
+}
+
+func (s *MongoDbBookingStore) ModifyBooking(ctx context.Context, booking *types.Booking) error {
+	current, err := s.GetBooking(ctx, booking.ID.Hex())
+	if err != nil {
+		return err
+	}
+	if !current.CancelledAt.IsZero() {
+		return NewConflictError(fmt.Sprintf("booking %s is cancelled", booking.ID.Hex()))
+	}
+
+	moved := current.RoomID != booking.RoomID
+	// a move reserves the new room before the old one is released, so the
+	// guest holds one of the two slots at any time
+	if moved {
+		err = s.reserve(ctx, booking)
+	} else {
+		err = s.reschedule(ctx, booking)
+	}
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"_id":         booking.ID,
+		"cancelledAt": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{
+		"roomID":      booking.RoomID,
+		"fromDate":    booking.FromDate,
+		"tillDate":    booking.TillDate,
+		"numPersons":  booking.NumPersons,
+		"numAdults":   booking.NumAdults,
+		"numChildren": booking.NumChildren,
+		"price":       booking.Price,
+	}}
+	res, err := s.bookingColl.UpdateOne(ctx, filter, update)
+	if err == nil && res.MatchedCount == 0 {
+		err = NewConflictError(fmt.Sprintf("booking %s is cancelled", booking.ID.Hex()))
+	}
+	if err != nil {
+		if moved {
+			if releaseErr := s.release(ctx, booking.RoomID, booking.ID); releaseErr != nil {
+				return fmt.Errorf("%w (releasing reservation failed: %s)", err, releaseErr.Error())
+			}
+		}
+		return err
+	}
+	if moved {
+		return s.release(ctx, current.RoomID, booking.ID)
+	}
+	return nil
+}
+
+func (s *MongoDbBookingStore) CancelBooking(ctx context.Context, id string, cancellation types.Cancellation) error {
+	booking, err := s.GetBooking(ctx, id)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{
+		"_id":         booking.ID,
+		"cancelledAt": bson.M{"$exists": false},
+	}
+	res, err := s.bookingColl.UpdateOne(ctx, filter, bson.M{"$set": CancellationUpdate(cancellation)})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return NewConflictError(fmt.Sprintf("booking %s is already cancelled", id))
+	}
+	return s.release(ctx, booking.RoomID, booking.ID)
+}
+
+func (s *MongoDbBookingStore) FindOverlapping(ctx context.Context, roomID primitive.ObjectID, from, till time.Time) ([]*types.Booking, error) {
+	opts := options.Find().SetSort(bson.M{"fromDate": 1})
+	resp, err := s.bookingColl.Find(ctx, OverlappingBookingsFilter(roomID, from, till), opts)
+	if err != nil {
+		return nil, err
+	}
+	var bookings []*types.Booking
+	if err := resp.All(ctx, &bookings); err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+// GetBookings returns the bookings matching filter ordered by check-in date.
+// A nil pag returns all of them.
+func (s *MongoDbBookingStore) GetBookings(ctx context.Context, filter map[string]any, pag *Pagination) ([]*types.Booking, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "fromDate", Value: 1}})
+	if pag != nil {
+		opts.SetSkip((pag.Page - 1) * pag.Limit).SetLimit(pag.Limit)
+	}
+	resp, err := s.bookingColl.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
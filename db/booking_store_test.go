@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/swarajroy/hotel-reservation/db/mongo"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BookingStoreSuite struct {
+	suite.Suite
+	bookingStore    *MongoDbBookingStore
+	testMongoClient *mongo.TestMongoClient
+}
+
+func (suite *BookingStoreSuite) SetupSuite() {
+	const (
+		DB_NAME = "hotel-reservation-test"
+	)
+	client, err := mongo.NewTestMongoClient(DB_NAME)
+	if err != nil {
+		suite.T().Error("failed to connect to mongo db container in docker using testcontainers")
+	}
+
+	suite.testMongoClient = client
+	suite.bookingStore = NewMongoDbBookingStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
+}
+
+func (suite *BookingStoreSuite) TearDownSuite() {
+	suite.testMongoClient.Container.Terminate(context.Background())
+}
+
+func (suite *BookingStoreSuite) TearDownTest() {
+	suite.bookingStore.Drop(context.Background())
+}
+
+// insertLegacyBooking writes booking straight to the bookings collection,
+// the way bookings were stored before the reservation ledger.
+func (suite *BookingStoreSuite) insertLegacyBooking(booking *types.Booking) *types.Booking {
+	booking.ID = primitive.NewObjectID()
+	if _, err := suite.bookingStore.bookingColl.InsertOne(context.Background(), booking); err != nil {
+		suite.T().Fatal(err)
+	}
+	return booking
+}
+
+func (suite *BookingStoreSuite) TestBackfillReservations() {
+	var (
+		ctx    = context.Background()
+		roomID = primitive.NewObjectID()
+		from   = time.Date(2030, time.March, 10, 15, 0, 0, 0, time.UTC)
+		legacy = suite.insertLegacyBooking(&types.Booking{
+			RoomID:     roomID,
+			NumPersons: 1,
+			FromDate:   from,
+			TillDate:   from.AddDate(0, 0, 5),
+		})
+	)
+
+	suite.Nil(suite.bookingStore.BackfillReservations(ctx))
+	// running it again doesn't add the booking twice
+	suite.Nil(suite.bookingStore.BackfillReservations(ctx))
+
+	_, err := suite.bookingStore.BookRoom(ctx, &types.Booking{
+		RoomID:     roomID,
+		NumPersons: 1,
+		FromDate:   from.AddDate(0, 0, 2),
+		TillDate:   from.AddDate(0, 0, 4),
+	})
+	var conflict ConflictError
+	suite.True(errors.As(err, &conflict))
+
+	// the legacy booking can be moved within its own dates
+	legacy.TillDate = from.AddDate(0, 0, 3)
+	suite.Nil(suite.bookingStore.ModifyBooking(ctx, legacy))
+
+	_, err = suite.bookingStore.BookRoom(ctx, &types.Booking{
+		RoomID:     roomID,
+		NumPersons: 1,
+		FromDate:   from.AddDate(0, 0, 3),
+		TillDate:   from.AddDate(0, 0, 5),
+	})
+	suite.Nil(err)
+}
+
+func TestBookingStoreSuite(t *testing.T) {
+	suite.Run(t, new(BookingStoreSuite))
+}
@@ -1,24 +1,37 @@
 package db
 
-const (
-	DBNAME       = "hotel-reservation"
-	TEST_DB_NAME = "hotel-reservation-test"
-	DB_URI       = "mongodb://localhost:27017"
+import (
+	"context"
+
+	"github.com/swarajroy/hotel-reservation/config"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Connect returns a client of the MongoDB server of cfg.
+func Connect(ctx context.Context, cfg config.Mongo) (*mongo.Client, error) {
+	return mongo.Connect(ctx, options.Client().ApplyURI(cfg.URI))
+}
+
 type HotelReservationStore struct {
 	User    UserStore
 	Hotel   HotelStore
 	Room    RoomStore
 	Booking BookingStore
+	Token   TokenStore
+	Lockout LockoutStore
+	APIKey  APIKeyStore
 }
 
-func NewHotelReservationStore(user UserStore, hotel HotelStore, room RoomStore, booking BookingStore) *HotelReservationStore {
+func NewHotelReservationStore(user UserStore, hotel HotelStore, room RoomStore, booking BookingStore, token TokenStore, lockout LockoutStore, apiKey APIKeyStore) *HotelReservationStore {
 	return &HotelReservationStore{
 		User:    user,
 		Hotel:   hotel,
 		Room:    room,
 		Booking: booking,
+		Token:   token,
+		Lockout: lockout,
+		APIKey:  apiKey,
 	}
 }
 
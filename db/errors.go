@@ -13,3 +13,19 @@ func NewResourceError(err string) error {
 func (e DBError) Error() string {
 	return e.Err
 }
+
+// ConflictError is returned when a write would clash with existing data, for
+// example a booking that overlaps a reservation already held for the room.
+type ConflictError struct {
+	Err string
+}
+
+func NewConflictError(err string) error {
+	return ConflictError{
+		Err: err,
+	}
+}
+
+func (e ConflictError) Error() string {
+	return e.Err
+}
@@ -2,8 +2,9 @@ package db
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/swarajroy/hotel-reservation/config"
+	"github.com/swarajroy/hotel-reservation/logging"
 	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -21,6 +22,8 @@ type HotelStore interface {
 	UpdateHotel(ctx context.Context, filter map[string]any, update map[string]any) error
 	GetHotels(ctx context.Context, filter map[string]any, paginaton *Pagination) ([]*types.Hotel, error)
 	GetHotelById(context.Context, string) (*types.Hotel, error)
+	UpdateHotelById(ctx context.Context, id string, update map[string]any) error
+	DeleteHotelById(context.Context, string) error
 }
 
 type MongoDbHotelStore struct {
@@ -28,15 +31,15 @@ type MongoDbHotelStore struct {
 	hotelColl *mongo.Collection
 }
 
-func NewMongoDbHotelStore(client *mongo.Client, dbname string) *MongoDbHotelStore {
+func NewMongoDbHotelStore(client *mongo.Client, cfg config.Mongo) *MongoDbHotelStore {
 	return &MongoDbHotelStore{
 		client:    client,
-		hotelColl: client.Database(dbname).Collection(HOTEL_COLL),
+		hotelColl: client.Database(cfg.Database).Collection(HOTEL_COLL),
 	}
 }
 
 func (s *MongoDbHotelStore) Drop(ctx context.Context) error {
-	fmt.Println("--- dropping hotel collection ---")
+	logging.FromContext(ctx).Info("dropping collection", "collection", HOTEL_COLL)
 	return s.hotelColl.Drop(ctx)
 }
 
@@ -88,3 +91,33 @@ func (s *MongoDbHotelStore) GetHotelById(ctx context.Context, id string) (*types
 	}
 	return &hotel, nil
 }
+
+func (s *MongoDbHotelStore) UpdateHotelById(ctx context.Context, id string, update map[string]any) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	res, err := s.hotelColl.UpdateByID(ctx, oid, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoDbHotelStore) DeleteHotelById(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	res, err := s.hotelColl.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/config"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	LOCKOUT_COLL = "loginAttempts"
+)
+
+type LockoutStore interface {
+	Dropper
+	// RecordFailure counts a failed login for key at now and locks key out
+	// as the policy says.
+	RecordFailure(ctx context.Context, key string, policy types.LockoutPolicy, now time.Time) (*types.LoginAttempts, error)
+	// LockedUntil returns the end of the latest lockout of any of keys that
+	// is in force at now, or the zero time when none is.
+	LockedUntil(ctx context.Context, now time.Time, keys ...string) (time.Time, error)
+	// Reset forgets the failed logins of key and lifts its lockout.
+	Reset(ctx context.Context, key string) error
+}
+
+type MongoDbLockoutStore struct {
+	client *mongo.Client
+	coll   *mongo.Collection
+}
+
+func NewMongoDbLockoutStore(client *mongo.Client, cfg config.Mongo) *MongoDbLockoutStore {
+	return &MongoDbLockoutStore{
+		client: client,
+		coll:   client.Database(cfg.Database).Collection(LOCKOUT_COLL),
+	}
+}
+
+// EnsureIndexes lets MongoDB remove failed logins once they are forgotten.
+func (s *MongoDbLockoutStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoDbLockoutStore) Drop(ctx context.Context) error {
+	return s.coll.Drop(ctx)
+}
+
+func (s *MongoDbLockoutStore) RecordFailure(ctx context.Context, key string, policy types.LockoutPolicy, now time.Time) (*types.LoginAttempts, error) {
+	// failures past the window may linger until the TTL monitor removes them
+	if _, err := s.coll.DeleteOne(ctx, bson.M{"_id": key, "expiresAt": bson.M{"$lte": now}}); err != nil {
+		return nil, err
+	}
+	var (
+		attempts types.LoginAttempts
+		update   = bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"lastFailure": now, "expiresAt": now.Add(policy.Window)},
+		}
+		opts = options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	)
+	if err := s.coll.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&attempts); err != nil {
+		return nil, err
+	}
+	lockedUntil := policy.LockedUntil(attempts.Failures, now)
+	if lockedUntil.IsZero() {
+		return &attempts, nil
+	}
+	if _, err := s.coll.UpdateByID(ctx, key, bson.M{"$max": bson.M{"lockedUntil": lockedUntil}}); err != nil {
+		return nil, err
+	}
+	if lockedUntil.After(attempts.LockedUntil) {
+		attempts.LockedUntil = lockedUntil
+	}
+	return &attempts, nil
+}
+
+func (s *MongoDbLockoutStore) LockedUntil(ctx context.Context, now time.Time, keys ...string) (time.Time, error) {
+	cur, err := s.coll.Find(ctx, LockedFilter(keys, now))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var attempts []*types.LoginAttempts
+	if err := cur.All(ctx, &attempts); err != nil {
+		return time.Time{}, err
+	}
+	return LatestLockout(attempts), nil
+}
+
+func (s *MongoDbLockoutStore) Reset(ctx context.Context, key string) error {
+	_, err := s.coll.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// LockedFilter matches the login attempts of keys that are locked out at now.
+func LockedFilter(keys []string, now time.Time) bson.M {
+	return bson.M{
+		"_id":         bson.M{"$in": keys},
+		"lockedUntil": bson.M{"$gt": now},
+	}
+}
+
+// LatestLockout returns the end of the latest lockout of attempts.
+func LatestLockout(attempts []*types.LoginAttempts) time.Time {
+	var latest time.Time
+	for _, a := range attempts {
+		if a.LockedUntil.After(latest) {
+			latest = a.LockedUntil
+		}
+	}
+	return latest
+}
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type APIKeyStore struct {
+	// mu makes finding and updating a used key atomic
+	mu   sync.Mutex
+	keys *collection
+}
+
+func NewAPIKeyStore() *APIKeyStore {
+	return &APIKeyStore{
+		keys: newCollection(),
+	}
+}
+
+func (s *APIKeyStore) Drop(ctx context.Context) error {
+	s.keys.drop()
+	return nil
+}
+
+func (s *APIKeyStore) InsertAPIKey(ctx context.Context, key *types.APIKey) (*types.APIKey, error) {
+	oid, err := s.keys.insert(key)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = oid
+	return key, nil
+}
+
+func (s *APIKeyStore) GetAPIKeys(ctx context.Context) ([]*types.APIKey, error) {
+	docs, err := s.keys.find(nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[types.APIKey](docs)
+}
+
+func (s *APIKeyStore) UseAPIKey(ctx context.Context, hash string, now time.Time) (*types.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var key types.APIKey
+	if err := s.keys.findOne(db.ActiveAPIKeyFilter(hash, now), &key); err != nil {
+		return nil, err
+	}
+	if _, err := s.keys.update(bson.M{"_id": key.ID}, db.APIKeyUse(now), true); err != nil {
+		return nil, err
+	}
+	var used types.APIKey
+	if err := s.keys.findByID(key.ID, &used); err != nil {
+		return nil, err
+	}
+	return &used, nil
+}
+
+func (s *APIKeyStore) RevokeAPIKey(ctx context.Context, id string, now time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return db.NewResourceError(err.Error())
+	}
+	filter := bson.M{"_id": oid, "revokedAt": bson.M{"$exists": false}}
+	matched, err := s.keys.update(filter, bson.M{"$set": bson.M{"revokedAt": now}}, true)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAPIKeyStoreOnlyUsesActiveKeys(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = NewAPIKeyStore()
+		now   = time.Now()
+	)
+	key, err := store.InsertAPIKey(ctx, &types.APIKey{Name: "channel manager", Hash: "a", Scopes: []types.Permission{types.MANAGE_ROOMS}, CreatedAt: now})
+	assert.Nil(t, err)
+	_, err = store.InsertAPIKey(ctx, &types.APIKey{Name: "nightly job", Hash: "b", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	assert.Nil(t, err)
+
+	used, err := store.UseAPIKey(ctx, "a", now)
+	assert.Nil(t, err)
+	assert.Equal(t, key.ID, used.ID)
+	assert.Equal(t, int64(1), used.UseCount)
+	used, err = store.UseAPIKey(ctx, "a", now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), used.UseCount)
+	assert.WithinDuration(t, now.Add(time.Minute), used.LastUsedAt, time.Millisecond)
+
+	_, err = store.UseAPIKey(ctx, "b", now.Add(time.Minute))
+	assert.Nil(t, err)
+	_, err = store.UseAPIKey(ctx, "b", now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	_, err = store.UseAPIKey(ctx, "c", now)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+
+	assert.Nil(t, store.RevokeAPIKey(ctx, key.ID.Hex(), now))
+	assert.ErrorIs(t, store.RevokeAPIKey(ctx, key.ID.Hex(), now), mongo.ErrNoDocuments)
+	_, err = store.UseAPIKey(ctx, "a", now)
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+
+	keys, err := store.GetAPIKeys(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
+}
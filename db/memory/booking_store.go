@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BookingStore struct {
+	// mu serialises writes so that the check-and-insert of BookRoom is atomic
+	mu       sync.Mutex
+	bookings *collection
+}
+
+func NewBookingStore() *BookingStore {
+	return &BookingStore{
+		bookings: newCollection(),
+	}
+}
+
+func (s *BookingStore) Drop(ctx context.Context) error {
+	s.bookings.drop()
+	return nil
+}
+
+func (s *BookingStore) InsertBooking(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(booking)
+}
+
+func (s *BookingStore) insert(booking *types.Booking) (*types.Booking, error) {
+	oid, err := s.bookings.insert(booking)
+	if err != nil {
+		return nil, err
+	}
+	booking.ID = oid
+	return booking, nil
+}
+
+func (s *BookingStore) BookRoom(ctx context.Context, booking *types.Booking) (*types.Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	overlapping, err := s.FindOverlapping(ctx, booking.RoomID, booking.FromDate, booking.TillDate)
+	if err != nil {
+		return nil, err
+	}
+	if len(overlapping) > 0 {
+		return nil, db.NewConflictError(fmt.Sprintf("room %s is not available for the requested dates", booking.RoomID.Hex()))
+	}
+	return s.insert(booking)
+}
+
+func (s *BookingStore) ModifyBooking(ctx context.Context, booking *types.Booking) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current types.Booking
+	if err := s.bookings.findByID(booking.ID, &current); err != nil {
+		return err
+	}
+	if !current.CancelledAt.IsZero() {
+		return db.NewConflictError(fmt.Sprintf("booking %s is cancelled", booking.ID.Hex()))
+	}
+	overlapping, err := s.FindOverlapping(ctx, booking.RoomID, booking.FromDate, booking.TillDate)
+	if err != nil {
+		return err
+	}
+	for _, other := range overlapping {
+		if other.ID != booking.ID {
+			return db.NewConflictError(fmt.Sprintf("room %s is not available for the requested dates", booking.RoomID.Hex()))
+		}
+	}
+	update := bson.M{"$set": bson.M{
+		"roomID":      booking.RoomID,
+		"fromDate":    booking.FromDate,
+		"tillDate":    booking.TillDate,
+		"numPersons":  booking.NumPersons,
+		"numAdults":   booking.NumAdults,
+		"numChildren": booking.NumChildren,
+		"price":       booking.Price,
+	}}
+	_, err = s.bookings.update(bson.M{"_id": booking.ID}, update, true)
+	return err
+}
+
+func (s *BookingStore) CancelBooking(ctx context.Context, id string, cancellation types.Cancellation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	var booking types.Booking
+	if err := s.bookings.findByID(oid, &booking); err != nil {
+		return err
+	}
+	filter := bson.M{
+		"_id":         oid,
+		"cancelledAt": bson.M{"$exists": false},
+	}
+	matched, err := s.bookings.update(filter, bson.M{"$set": db.CancellationUpdate(cancellation)}, true)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return db.NewConflictError(fmt.Sprintf("booking %s is already cancelled", id))
+	}
+	return nil
+}
+
+func (s *BookingStore) FindOverlapping(ctx context.Context, roomID primitive.ObjectID, from, till time.Time) ([]*types.Booking, error) {
+	docs, err := s.bookings.find(db.OverlappingBookingsFilter(roomID, from, till), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := decodeAll[types.Booking](docs)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(bookings, func(i, j int) bool {
+		return bookings[i].FromDate.Before(bookings[j].FromDate)
+	})
+	return bookings, nil
+}
+
+func (s *BookingStore) GetBookings(ctx context.Context, filter map[string]any, pag *db.Pagination) ([]*types.Booking, error) {
+	docs, err := s.bookings.find(filter, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := decodeAll[types.Booking](docs)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(bookings, func(i, j int) bool {
+		return bookings[i].FromDate.Before(bookings[j].FromDate)
+	})
+	if pag == nil {
+		return bookings, nil
+	}
+	skip := (pag.Page - 1) * pag.Limit
+	if skip < 0 {
+		return nil, fmt.Errorf("skip must be non-negative, got %d", skip)
+	}
+	if skip >= int64(len(bookings)) {
+		return []*types.Booking{}, nil
+	}
+	bookings = bookings[skip:]
+	if pag.Limit > 0 && pag.Limit < int64(len(bookings)) {
+		bookings = bookings[:pag.Limit]
+	}
+	return bookings, nil
+}
+
+func (s *BookingStore) GetBooking(ctx context.Context, id string) (*types.Booking, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var booking types.Booking
+	if err := s.bookings.findByID(oid, &booking); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+func (s *BookingStore) UpdateBookingById(ctx context.Context, id string, update map[string]any) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.bookings.update(bson.M{"_id": oid}, bson.M{"$set": update}, true)
+	return err
+}
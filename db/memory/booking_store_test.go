@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BookingStoreSuite struct {
+	suite.Suite
+	bookingStore db.BookingStore
+	roomID       primitive.ObjectID
+	// existing booking from day 10 (check-in) to day 15 (check-out)
+	existing *types.Booking
+}
+
+func day(d int, hour int) time.Time {
+	return time.Date(2030, time.March, d, hour, 0, 0, 0, time.UTC)
+}
+
+func (suite *BookingStoreSuite) SetupTest() {
+	suite.bookingStore = NewBookingStore()
+	suite.roomID = primitive.NewObjectID()
+	existing, err := suite.bookingStore.InsertBooking(context.Background(), &types.Booking{
+		RoomID:   suite.roomID,
+		FromDate: day(10, 15),
+		TillDate: day(15, 11),
+	})
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.existing = existing
+}
+
+func (suite *BookingStoreSuite) TestFindOverlapping() {
+	tests := []struct {
+		name     string
+		from     time.Time
+		till     time.Time
+		overlaps bool
+	}{
+		{"inside", day(11, 15), day(13, 11), true},
+		{"same dates", day(10, 15), day(15, 11), true},
+		{"encloses", day(8, 15), day(18, 11), true},
+		{"overlaps check-in", day(8, 15), day(11, 11), true},
+		{"overlaps check-out", day(14, 15), day(17, 11), true},
+		{"checks out on check-in day", day(8, 15), day(10, 11), false},
+		{"checks in on check-out day", day(15, 9), day(17, 11), false},
+		{"before", day(1, 15), day(5, 11), false},
+		{"after", day(20, 15), day(25, 11), false},
+	}
+	for _, tt := range tests {
+		bookings, err := suite.bookingStore.FindOverlapping(context.Background(), suite.roomID, tt.from, tt.till)
+		suite.Nil(err, tt.name)
+		if tt.overlaps {
+			suite.Len(bookings, 1, tt.name)
+		} else {
+			suite.Empty(bookings, tt.name)
+		}
+	}
+}
+
+func (suite *BookingStoreSuite) TestFindOverlappingIgnoresOtherRooms() {
+	bookings, err := suite.bookingStore.FindOverlapping(context.Background(), primitive.NewObjectID(), day(10, 15), day(15, 11))
+
+	suite.Nil(err)
+	suite.Empty(bookings)
+}
+
+func (suite *BookingStoreSuite) TestFindOverlappingIgnoresCancelled() {
+	var (
+		ctx = context.Background()
+	)
+	err := suite.bookingStore.CancelBooking(ctx, suite.existing.ID.Hex(), types.Cancellation{})
+	suite.Nil(err)
+
+	bookings, err := suite.bookingStore.FindOverlapping(ctx, suite.roomID, day(10, 15), day(15, 11))
+
+	suite.Nil(err)
+	suite.Empty(bookings)
+}
+
+func (suite *BookingStoreSuite) TestBookRoomConflict() {
+	var (
+		ctx = context.Background()
+	)
+	_, err := suite.bookingStore.BookRoom(ctx, &types.Booking{
+		RoomID:   suite.roomID,
+		FromDate: day(14, 15),
+		TillDate: day(16, 11),
+	})
+	suite.ErrorAs(err, &db.ConflictError{})
+
+	booking, err := suite.bookingStore.BookRoom(ctx, &types.Booking{
+		RoomID:   suite.roomID,
+		FromDate: day(15, 15),
+		TillDate: day(16, 11),
+	})
+	suite.Nil(err)
+	suite.False(booking.ID.IsZero())
+}
+
+func (suite *BookingStoreSuite) TestModifyBooking() {
+	var (
+		ctx   = context.Background()
+		other = &types.Booking{RoomID: suite.roomID, FromDate: day(20, 15), TillDate: day(22, 11)}
+	)
+	_, err := suite.bookingStore.BookRoom(ctx, other)
+	suite.Nil(err)
+
+	// extending into its own nights is fine
+	modified := *suite.existing
+	modified.TillDate = day(18, 11)
+	suite.Nil(suite.bookingStore.ModifyBooking(ctx, &modified))
+
+	// extending into the other booking keeps the current dates
+	modified.TillDate = day(21, 11)
+	suite.ErrorAs(suite.bookingStore.ModifyBooking(ctx, &modified), &db.ConflictError{})
+
+	booking, err := suite.bookingStore.GetBooking(ctx, suite.existing.ID.Hex())
+	suite.Nil(err)
+	suite.Equal(day(18, 11), booking.TillDate)
+
+	// moving to another room frees the original one
+	modified.TillDate = day(18, 11)
+	modified.RoomID = primitive.NewObjectID()
+	suite.Nil(suite.bookingStore.ModifyBooking(ctx, &modified))
+
+	bookings, err := suite.bookingStore.FindOverlapping(ctx, suite.roomID, day(10, 15), day(18, 11))
+	suite.Nil(err)
+	suite.Empty(bookings)
+}
+
+func TestBookingStoreSuite(t *testing.T) {
+	suite.Run(t, new(BookingStoreSuite))
+}
@@ -0,0 +1,659 @@
+package memory
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// collection keeps documents in their bson encoding so that every read hands
+// out a fresh copy and filters/updates see the same field names as MongoDB.
+type collection struct {
+	mu    sync.RWMutex
+	order []primitive.ObjectID
+	docs  map[primitive.ObjectID][]byte
+}
+
+func newCollection() *collection {
+	return &collection{
+		docs: map[primitive.ObjectID][]byte{},
+	}
+}
+
+func (c *collection) drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order = nil
+	c.docs = map[primitive.ObjectID][]byte{}
+}
+
+// insert stores doc and returns its _id, generating one when doc has none.
+func (c *collection) insert(doc any) (primitive.ObjectID, error) {
+	m, err := toM(doc)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	oid, ok := m["_id"].(primitive.ObjectID)
+	if !ok || oid.IsZero() {
+		oid = primitive.NewObjectID()
+		m["_id"] = oid
+	}
+	b, err := bson.Marshal(m)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.docs[oid]; ok {
+		return primitive.NilObjectID, fmt.Errorf("duplicate key error _id: %s", oid.Hex())
+	}
+	c.docs[oid] = b
+	c.order = append(c.order, oid)
+	return oid, nil
+}
+
+func (c *collection) findByID(oid primitive.ObjectID, out any) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	b, ok := c.docs[oid]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	return bson.Unmarshal(b, out)
+}
+
+// find returns the raw documents matching filter in insertion order, honouring
+// skip and limit the way options.FindOptions does (a limit of 0 means no limit).
+func (c *collection) find(filter map[string]any, skip, limit int64) ([][]byte, error) {
+	if skip < 0 {
+		return nil, fmt.Errorf("skip must be non-negative, got %d", skip)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var res [][]byte
+	for _, oid := range c.order {
+		b := c.docs[oid]
+		ok, err := matches(b, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		res = append(res, b)
+		if limit > 0 && int64(len(res)) == limit {
+			break
+		}
+	}
+	return res, nil
+}
+
+func (c *collection) findOne(filter map[string]any, out any) error {
+	docs, err := c.find(filter, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return bson.Unmarshal(docs[0], out)
+}
+
+// update applies update to every document matching filter and returns the
+// number of matched documents. When one is set, the update stops after the
+// first match, mirroring UpdateOne.
+func (c *collection) update(filter, update map[string]any, one bool) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	matched := 0
+	for _, oid := range c.order {
+		b := c.docs[oid]
+		ok, err := matches(b, filter)
+		if err != nil {
+			return matched, err
+		}
+		if !ok {
+			continue
+		}
+		var m bson.M
+		if err := bson.Unmarshal(b, &m); err != nil {
+			return matched, err
+		}
+		if err := applyUpdate(m, update); err != nil {
+			return matched, err
+		}
+		nb, err := bson.Marshal(m)
+		if err != nil {
+			return matched, err
+		}
+		c.docs[oid] = nb
+		matched++
+		if one {
+			break
+		}
+	}
+	return matched, nil
+}
+
+func (c *collection) delete(filter map[string]any, one bool) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deleted := 0
+	kept := c.order[:0]
+	for i, oid := range c.order {
+		if one && deleted > 0 {
+			kept = append(kept, c.order[i:]...)
+			break
+		}
+		ok, err := matches(c.docs[oid], filter)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			delete(c.docs, oid)
+			deleted++
+			continue
+		}
+		kept = append(kept, oid)
+	}
+	c.order = kept
+	return deleted, nil
+}
+
+func decodeAll[T any](docs [][]byte) ([]*T, error) {
+	res := make([]*T, 0, len(docs))
+	for _, b := range docs {
+		var v T
+		if err := bson.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		res = append(res, &v)
+	}
+	return res, nil
+}
+
+func toM(v any) (bson.M, error) {
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m bson.M
+	if err := bson.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// matches reports whether the bson document b satisfies filter. It supports the
+// subset of the MongoDB query language used by the stores: implicit equality,
+// $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $and and $or.
+func matches(b []byte, filter map[string]any) (bool, error) {
+	if len(filter) == 0 {
+		return true, nil
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(b, &doc); err != nil {
+		return false, err
+	}
+	return matchDoc(doc, filter)
+}
+
+func matchDoc(doc bson.M, filter map[string]any) (bool, error) {
+	for key, cond := range filter {
+		switch key {
+		case "$and", "$or":
+			clauses, err := asClauses(cond)
+			if err != nil {
+				return false, err
+			}
+			ok, err := matchClauses(doc, clauses, key == "$and")
+			if err != nil || !ok {
+				return false, err
+			}
+			continue
+		}
+		val, exists := lookup(doc, key)
+		ok, err := matchField(val, exists, cond)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchClauses(doc bson.M, clauses []map[string]any, all bool) (bool, error) {
+	for _, clause := range clauses {
+		ok, err := matchDoc(doc, clause)
+		if err != nil {
+			return false, err
+		}
+		if ok && !all {
+			return true, nil
+		}
+		if !ok && all {
+			return false, nil
+		}
+	}
+	return all, nil
+}
+
+func asClauses(v any) ([]map[string]any, error) {
+	var items []any
+	switch t := v.(type) {
+	case []bson.M:
+		for _, m := range t {
+			items = append(items, m)
+		}
+	case []map[string]any:
+		for _, m := range t {
+			items = append(items, m)
+		}
+	case bson.A:
+		items = t
+	case []any:
+		items = t
+	default:
+		return nil, fmt.Errorf("unsupported clause list %T", v)
+	}
+	res := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		m, ok := asMap(item)
+		if !ok {
+			return nil, fmt.Errorf("unsupported clause %T", item)
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+func asMap(v any) (map[string]any, bool) {
+	switch t := v.(type) {
+	case bson.M:
+		return t, true
+	case map[string]any:
+		return t, true
+	}
+	return nil, false
+}
+
+func isOperatorMap(m map[string]any) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+func matchField(val any, exists bool, cond any) (bool, error) {
+	m, ok := asMap(cond)
+	if !ok || !isOperatorMap(m) {
+		return exists && equalOrContains(val, cond), nil
+	}
+	for op, arg := range m {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = exists && equalOrContains(val, arg)
+		case "$ne":
+			ok = !exists || !equalOrContains(val, arg)
+		case "$gt", "$gte", "$lt", "$lte":
+			if !exists {
+				return false, nil
+			}
+			c, comparable := compare(val, arg)
+			if !comparable {
+				return false, nil
+			}
+			switch op {
+			case "$gt":
+				ok = c > 0
+			case "$gte":
+				ok = c >= 0
+			case "$lt":
+				ok = c < 0
+			case "$lte":
+				ok = c <= 0
+			}
+		case "$in", "$nin":
+			list, err := asList(arg)
+			if err != nil {
+				return false, err
+			}
+			found := false
+			for _, item := range list {
+				if exists && equalOrContains(val, item) {
+					found = true
+					break
+				}
+			}
+			ok = found == (op == "$in")
+		case "$exists":
+			want, _ := arg.(bool)
+			ok = exists == want
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func asList(v any) ([]any, error) {
+	switch t := v.(type) {
+	case bson.A:
+		return t, nil
+	case []any:
+		return t, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("unsupported list %T", v)
+	}
+	res := make([]any, rv.Len())
+	for i := range res {
+		res[i] = rv.Index(i).Interface()
+	}
+	return res, nil
+}
+
+// lookup resolves a possibly dotted path in doc.
+func lookup(doc bson.M, path string) (any, bool) {
+	var cur any = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := asMap(cur)
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// equalOrContains follows MongoDB's equality semantics where a scalar matches
+// an array field when any of its elements is equal.
+func equalOrContains(val, want any) bool {
+	if equal(val, want) {
+		return true
+	}
+	if arr, ok := val.(bson.A); ok {
+		for _, item := range arr {
+			if equal(item, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equal(a, b any) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	na, nb := normalize(a), normalize(b)
+	if ma, ok := asMap(na); ok {
+		mb, ok := asMap(nb)
+		if !ok || len(ma) != len(mb) {
+			return false
+		}
+		for k, v := range ma {
+			if !equal(v, mb[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	if la, ok := na.(bson.A); ok {
+		lb, ok := nb.(bson.A)
+		if !ok || len(la) != len(lb) {
+			return false
+		}
+		for i := range la {
+			if !equal(la[i], lb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return na == nb
+}
+
+// compare orders two scalar values of the same bson kind.
+func compare(a, b any) (int, bool) {
+	a, b = normalize(a), normalize(b)
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		return cmp3(x < y, x > y), true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case primitive.DateTime:
+		y, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		return cmp3(x < y, x > y), true
+	case primitive.ObjectID:
+		y, ok := b.(primitive.ObjectID)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x.Hex(), y.Hex()), true
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		return cmp3(!x && y, x && !y), true
+	}
+	return 0, false
+}
+
+func cmp3(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// normalize maps Go values onto the representation bson.Unmarshal produces.
+func normalize(v any) any {
+	switch t := v.(type) {
+	case int:
+		return float64(t)
+	case int8:
+		return float64(t)
+	case int16:
+		return float64(t)
+	case int32:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case uint:
+		return float64(t)
+	case uint8:
+		return float64(t)
+	case uint16:
+		return float64(t)
+	case uint32:
+		return float64(t)
+	case uint64:
+		return float64(t)
+	case float32:
+		return float64(t)
+	case primitive.DateTime:
+		return t
+	case time.Time:
+		return primitive.NewDateTimeFromTime(t)
+	case []any:
+		return bson.A(t)
+	case []primitive.ObjectID:
+		res := make(bson.A, len(t))
+		for i, oid := range t {
+			res[i] = oid
+		}
+		return res
+	}
+	// named types such as types.RoomType
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	}
+	return v
+}
+
+// applyUpdate applies the MongoDB update operators $set, $unset, $inc, $push
+// and $pull to doc.
+func applyUpdate(doc bson.M, update map[string]any) error {
+	for op, arg := range update {
+		fields, ok := asMap(arg)
+		if !ok {
+			return fmt.Errorf("update operator %s expects a document", op)
+		}
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, path := range keys {
+			v, err := encodeValue(fields[path])
+			if err != nil {
+				return err
+			}
+			switch op {
+			case "$set":
+				set(doc, path, v)
+			case "$unset":
+				unset(doc, path)
+			case "$inc":
+				cur, _ := lookup(doc, path)
+				set(doc, path, addNumbers(cur, v))
+			case "$push":
+				cur, _ := lookup(doc, path)
+				arr, _ := cur.(bson.A)
+				set(doc, path, append(append(bson.A{}, arr...), v))
+			case "$pull":
+				cur, _ := lookup(doc, path)
+				arr, _ := cur.(bson.A)
+				kept := bson.A{}
+				for _, item := range arr {
+					if pullMatches(item, v) {
+						continue
+					}
+					kept = append(kept, item)
+				}
+				set(doc, path, kept)
+			default:
+				return fmt.Errorf("unsupported update operator %s", op)
+			}
+		}
+	}
+	return nil
+}
+
+func pullMatches(item, cond any) bool {
+	if m, ok := asMap(cond); ok {
+		if isOperatorMap(m) {
+			ok, _ := matchField(item, true, m)
+			return ok
+		}
+		if doc, ok := asMap(item); ok {
+			ok, _ := matchDoc(doc, m)
+			return ok
+		}
+	}
+	return equal(item, cond)
+}
+
+// encodeValue converts v to the value bson.Unmarshal would have produced for
+// it, so updated documents look exactly like inserted ones.
+func encodeValue(v any) (any, error) {
+	b, err := bson.Marshal(bson.M{"v": v})
+	if err != nil {
+		return nil, err
+	}
+	var m bson.M
+	if err := bson.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m["v"], nil
+}
+
+func addNumbers(a, b any) any {
+	switch x := a.(type) {
+	case int32:
+		if y, ok := b.(int32); ok {
+			return x + y
+		}
+	case int64:
+		if y, ok := b.(int64); ok {
+			return x + y
+		}
+	case nil:
+		return b
+	}
+	fa, _ := normalize(a).(float64)
+	fb, _ := normalize(b).(float64)
+	return fa + fb
+}
+
+func set(doc bson.M, path string, v any) {
+	parts := strings.Split(path, ".")
+	cur := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := cur[part].(bson.M)
+		if !ok {
+			next = bson.M{}
+			cur[part] = next
+		}
+		cur = next
+	}
+	cur[parts[len(parts)-1]] = v
+}
+
+func unset(doc bson.M, path string) {
+	parts := strings.Split(path, ".")
+	cur := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := cur[part].(bson.M)
+		if !ok {
+			return
+		}
+		cur = next
+	}
+	delete(cur, parts[len(parts)-1])
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type HotelStore struct {
+	hotels *collection
+}
+
+func NewHotelStore() *HotelStore {
+	return &HotelStore{
+		hotels: newCollection(),
+	}
+}
+
+func (s *HotelStore) Drop(ctx context.Context) error {
+	s.hotels.drop()
+	return nil
+}
+
+func (s *HotelStore) InsertHotel(ctx context.Context, hotel *types.Hotel) (*types.Hotel, error) {
+	oid, err := s.hotels.insert(hotel)
+	if err != nil {
+		return nil, err
+	}
+	hotel.ID = oid
+	return hotel, nil
+}
+
+func (s *HotelStore) UpdateHotel(ctx context.Context, filter map[string]any, update map[string]any) error {
+	_, err := s.hotels.update(filter, update, true)
+	return err
+}
+
+func (s *HotelStore) GetHotels(ctx context.Context, filter map[string]any, pag *db.Pagination) ([]*types.Hotel, error) {
+	skip := (pag.Page - 1) * pag.Limit
+	docs, err := s.hotels.find(filter, skip, pag.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[types.Hotel](docs)
+}
+
+func (s *HotelStore) GetHotelById(ctx context.Context, id string) (*types.Hotel, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, db.NewResourceError(err.Error())
+	}
+	var hotel types.Hotel
+	if err := s.hotels.findByID(oid, &hotel); err != nil {
+		return nil, err
+	}
+	return &hotel, nil
+}
+
+func (s *HotelStore) UpdateHotelById(ctx context.Context, id string, update map[string]any) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return db.NewResourceError(err.Error())
+	}
+	matched, err := s.hotels.update(bson.M{"_id": oid}, bson.M{"$set": update}, true)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *HotelStore) DeleteHotelById(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return db.NewResourceError(err.Error())
+	}
+	deleted, err := s.hotels.delete(bson.M{"_id": oid}, true)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/db/fixtures"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type HotelStoreSuite struct {
+	suite.Suite
+	store *db.HotelReservationStore
+}
+
+func (suite *HotelStoreSuite) SetupTest() {
+	suite.store = NewHotelReservationStore()
+}
+
+func (suite *HotelStoreSuite) TestGetHotelsPagination() {
+	var (
+		ctx = context.Background()
+	)
+	for i := 1; i <= 5; i++ {
+		fixtures.AddHotel(suite.store, fmt.Sprintf("Hotel %d", i), "london", nil)
+	}
+
+	hotels, err := suite.store.Hotel.GetHotels(ctx, bson.M{}, &db.Pagination{Page: 2, Limit: 2})
+
+	suite.Nil(err)
+	suite.Len(hotels, 2)
+	suite.Equal("Hotel 3", hotels[0].Name)
+	suite.Equal("Hotel 4", hotels[1].Name)
+
+	hotels, err = suite.store.Hotel.GetHotels(ctx, bson.M{}, &db.Pagination{Page: 3, Limit: 2})
+
+	suite.Nil(err)
+	suite.Len(hotels, 1)
+}
+
+func (suite *HotelStoreSuite) TestInsertRoomUpdatesHotel() {
+	var (
+		ctx   = context.Background()
+		hotel = fixtures.AddHotel(suite.store, "bar hotel", "london", nil)
+		room  = fixtures.AddRoom(suite.store, types.DOUBLE, 120, 150, hotel.ID)
+	)
+
+	retrieved, err := suite.store.Hotel.GetHotelById(ctx, hotel.ID.Hex())
+
+	suite.Nil(err)
+	suite.Equal(room.ID, retrieved.Rooms[0])
+
+	rooms, err := suite.store.Room.GetRooms(ctx, bson.M{"hotelId": hotel.ID, "type": types.DOUBLE})
+
+	suite.Nil(err)
+	suite.Len(rooms, 1)
+}
+
+func (suite *HotelStoreSuite) TestGetBookingsFilter() {
+	var (
+		ctx   = context.Background()
+		user  = fixtures.AddUser(suite.store, "james", "foo", false)
+		hotel = fixtures.AddHotel(suite.store, "bar hotel", "london", nil)
+		room  = fixtures.AddRoom(suite.store, types.SINGLE, 99.99, 99.99, hotel.ID)
+		from  = time.Now().AddDate(0, 0, 1)
+	)
+	fixtures.AddBooking(suite.store, user.ID, room.ID, from, from.AddDate(0, 0, 2), time.Time{}, 1)
+	fixtures.AddBooking(suite.store, user.ID, room.ID, from.AddDate(0, 0, 10), from.AddDate(0, 0, 12), time.Time{}, 1)
+
+	bookings, err := suite.store.Booking.GetBookings(ctx, bson.M{
+		"roomID":   room.ID,
+		"fromDate": bson.M{"$gte": from.AddDate(0, 0, 5)},
+	}, nil)
+
+	suite.Nil(err)
+	suite.Len(bookings, 1)
+
+	err = suite.store.Booking.UpdateBookingById(ctx, bookings[0].ID.Hex(), map[string]any{"cancelledAt": time.Now()})
+	suite.Nil(err)
+
+	bookings, err = suite.store.Booking.GetBookings(ctx, bson.M{"cancelledAt": bson.M{"$exists": false}}, nil)
+
+	suite.Nil(err)
+	suite.Len(bookings, 1)
+}
+
+func TestHotelStoreSuite(t *testing.T) {
+	suite.Run(t, new(HotelStoreSuite))
+}
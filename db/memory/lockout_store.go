@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+)
+
+type LockoutStore struct {
+	mu       sync.Mutex
+	attempts map[string]types.LoginAttempts
+}
+
+func NewLockoutStore() *LockoutStore {
+	return &LockoutStore{
+		attempts: map[string]types.LoginAttempts{},
+	}
+}
+
+func (s *LockoutStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = map[string]types.LoginAttempts{}
+	return nil
+}
+
+func (s *LockoutStore) RecordFailure(ctx context.Context, key string, policy types.LockoutPolicy, now time.Time) (*types.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok || !attempts.ExpiresAt.After(now) {
+		attempts = types.LoginAttempts{Key: key}
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	attempts.ExpiresAt = now.Add(policy.Window)
+	if lockedUntil := policy.LockedUntil(attempts.Failures, now); lockedUntil.After(attempts.LockedUntil) {
+		attempts.LockedUntil = lockedUntil
+	}
+	s.attempts[key] = attempts
+	return &attempts, nil
+}
+
+func (s *LockoutStore) LockedUntil(ctx context.Context, now time.Time, keys ...string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locked := []*types.LoginAttempts{}
+	for _, key := range keys {
+		if attempts, ok := s.attempts[key]; ok && attempts.LockedUntil.After(now) {
+			locked = append(locked, &attempts)
+		}
+	}
+	return db.LatestLockout(locked), nil
+}
+
+func (s *LockoutStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/types"
+)
+
+func TestLockoutStoreForgetsFailuresAfterWindow(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		store  = NewLockoutStore()
+		policy = types.LockoutPolicy{FreeAttempts: 1, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+		now    = time.Now()
+		key    = types.EmailLockoutKey("James@foo.com")
+	)
+
+	_, err := store.RecordFailure(ctx, key, policy, now)
+	assert.Nil(t, err)
+	attempts, err := store.RecordFailure(ctx, key, policy, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts.Failures)
+
+	lockedUntil, err := store.LockedUntil(ctx, now, key, types.IPLockoutKey("10.0.0.1"))
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(time.Minute), lockedUntil)
+
+	later := now.Add(2 * time.Hour)
+	attempts, err = store.RecordFailure(ctx, key, policy, later)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, attempts.Failures)
+	lockedUntil, err = store.LockedUntil(ctx, later, key)
+	assert.Nil(t, err)
+	assert.True(t, lockedUntil.IsZero())
+}
@@ -0,0 +1,24 @@
+// Package memory provides thread-safe in-memory implementations of the db
+// store interfaces. They understand the same filters, updates and pagination
+// as the MongoDB stores, so handlers can be exercised without a database.
+package memory
+
+import "github.com/swarajroy/hotel-reservation/db"
+
+var (
+	_ db.UserStore    = (*UserStore)(nil)
+	_ db.HotelStore   = (*HotelStore)(nil)
+	_ db.RoomStore    = (*RoomStore)(nil)
+	_ db.BookingStore = (*BookingStore)(nil)
+	_ db.TokenStore   = (*TokenStore)(nil)
+	_ db.LockoutStore = (*LockoutStore)(nil)
+	_ db.APIKeyStore  = (*APIKeyStore)(nil)
+)
+
+func NewHotelReservationStore() *db.HotelReservationStore {
+	var (
+		hotelStore   = NewHotelStore()
+		bookingStore = NewBookingStore()
+	)
+	return db.NewHotelReservationStore(NewUserStore(), hotelStore, NewRoomStore(hotelStore, bookingStore), bookingStore, NewTokenStore(), NewLockoutStore(), NewAPIKeyStore())
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RoomStore struct {
+	rooms        *collection
+	hotelStore   db.HotelStore
+	bookingStore db.BookingStore
+}
+
+func NewRoomStore(hotelStore db.HotelStore, bookingStore db.BookingStore) *RoomStore {
+	return &RoomStore{
+		rooms:        newCollection(),
+		hotelStore:   hotelStore,
+		bookingStore: bookingStore,
+	}
+}
+
+func (s *RoomStore) Drop(ctx context.Context) error {
+	s.rooms.drop()
+	return nil
+}
+
+func (s *RoomStore) InsertRoom(ctx context.Context, room *types.Room) (*types.Room, error) {
+	oid, err := s.rooms.insert(room)
+	if err != nil {
+		return nil, err
+	}
+	room.ID = oid
+
+	// update the hotel with this room
+	filter := bson.M{"_id": room.HotelID}
+	update := bson.M{"$push": bson.M{"rooms": room.ID}}
+	if err := s.hotelStore.UpdateHotel(ctx, filter, update); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+func (s *RoomStore) GetRooms(ctx context.Context, filter bson.M) ([]*types.Room, error) {
+	docs, err := s.rooms.find(filter, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[types.Room](docs)
+}
+
+func (s *RoomStore) GetRoomById(ctx context.Context, id string) (*types.Room, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, db.NewResourceError(err.Error())
+	}
+	var room types.Room
+	if err := s.rooms.findByID(oid, &room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (s *RoomStore) UpdateRoomById(ctx context.Context, id string, update map[string]any) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return db.NewResourceError(err.Error())
+	}
+	matched, err := s.rooms.update(bson.M{"_id": oid}, bson.M{"$set": update}, true)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *RoomStore) DeleteRoomById(ctx context.Context, id string) error {
+	room, err := s.GetRoomById(ctx, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.rooms.delete(bson.M{"_id": room.ID}, true)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	// the reverse of the $push in InsertRoom
+	filter := bson.M{"_id": room.HotelID}
+	update := bson.M{"$pull": bson.M{"rooms": room.ID}}
+	return s.hotelStore.UpdateHotel(ctx, filter, update)
+}
+
+func (s *RoomStore) GetAvailableRooms(ctx context.Context, filter bson.M, from, till time.Time) ([]*types.Room, error) {
+	rooms, err := s.GetRooms(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	available := []*types.Room{}
+	for _, room := range rooms {
+		bookings, err := s.bookingStore.FindOverlapping(ctx, room.ID, from, till)
+		if err != nil {
+			return nil, err
+		}
+		if len(bookings) == 0 {
+			available = append(available, room)
+		}
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		if available[i].HotelID != available[j].HotelID {
+			return available[i].HotelID.Hex() < available[j].HotelID.Hex()
+		}
+		return available[i].Price < available[j].Price
+	})
+	return available, nil
+}
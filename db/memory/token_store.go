@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TokenStore struct {
+	// mu serialises rotations so that a refresh token is exchanged only once
+	mu            sync.Mutex
+	refreshTokens *collection
+	oneTimeTokens *collection
+	revocations   map[string]time.Time
+}
+
+func NewTokenStore() *TokenStore {
+	return &TokenStore{
+		refreshTokens: newCollection(),
+		oneTimeTokens: newCollection(),
+		revocations:   map[string]time.Time{},
+	}
+}
+
+func (s *TokenStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens.drop()
+	s.oneTimeTokens.drop()
+	s.revocations = map[string]time.Time{}
+	return nil
+}
+
+func (s *TokenStore) InsertRefreshToken(ctx context.Context, token *types.RefreshToken) (*types.RefreshToken, error) {
+	oid, err := s.refreshTokens.insert(token)
+	if err != nil {
+		return nil, err
+	}
+	token.ID = oid
+	return token, nil
+}
+
+func (s *TokenStore) GetRefreshToken(ctx context.Context, hash string) (*types.RefreshToken, error) {
+	var token types.RefreshToken
+	if err := s.refreshTokens.findOne(bson.M{"hash": hash}, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *TokenStore) RotateRefreshToken(ctx context.Context, hash string, next *types.RefreshToken) (*types.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var current types.RefreshToken
+	err := s.refreshTokens.findOne(db.ActiveRefreshTokenFilter(hash, now), &current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		token, err := s.GetRefreshToken(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		return nil, db.RefreshTokenError(token)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.refreshTokens.update(bson.M{"_id": current.ID}, bson.M{"$set": bson.M{"rotatedAt": now}}, true); err != nil {
+		return nil, err
+	}
+	next.UserID = current.UserID
+	next.SessionID = current.SessionID
+	next.MFA = current.MFA
+	return s.InsertRefreshToken(ctx, next)
+}
+
+func (s *TokenStore) RevokeSession(ctx context.Context, sessionID string, until time.Time) error {
+	filter := bson.M{
+		"sessionID": sessionID,
+		"revokedAt": bson.M{"$exists": false},
+	}
+	if _, err := s.refreshTokens.update(filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}}, false); err != nil {
+		return err
+	}
+	return s.Revoke(ctx, sessionID, until)
+}
+
+func (s *TokenStore) Revoke(ctx context.Context, id string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until.After(s.revocations[id]) {
+		s.revocations[id] = until
+	}
+	return nil
+}
+
+func (s *TokenStore) IsRevoked(ctx context.Context, ids ...string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, id := range ids {
+		if until, ok := s.revocations[id]; ok && until.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *TokenStore) RevokeUserSessions(ctx context.Context, userID primitive.ObjectID, until time.Time) error {
+	docs, err := s.refreshTokens.find(db.UserSessionsFilter(userID, time.Now()), 0, 0)
+	if err != nil {
+		return err
+	}
+	tokens, err := decodeAll[types.RefreshToken](docs)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := s.RevokeSession(ctx, token.SessionID, until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TokenStore) InsertOneTimeToken(ctx context.Context, token *types.OneTimeToken) (*types.OneTimeToken, error) {
+	oid, err := s.oneTimeTokens.insert(token)
+	if err != nil {
+		return nil, err
+	}
+	token.ID = oid
+	return token, nil
+}
+
+func (s *TokenStore) UseOneTimeToken(ctx context.Context, hash string, purpose types.TokenPurpose) (*types.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var token types.OneTimeToken
+	if err := s.oneTimeTokens.findOne(db.UnusedOneTimeTokenFilter(hash, purpose, now), &token); err != nil {
+		return nil, err
+	}
+	if _, err := s.oneTimeTokens.update(bson.M{"_id": token.ID}, bson.M{"$set": bson.M{"usedAt": now}}, true); err != nil {
+		return nil, err
+	}
+	token.UsedAt = now
+	return &token, nil
+}
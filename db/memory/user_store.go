@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/db/mongo/utils"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UserStore struct {
+	// mu makes the email checks of InsertUser and set atomic
+	mu    sync.Mutex
+	users *collection
+}
+
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users: newCollection(),
+	}
+}
+
+func (s *UserStore) Drop(ctx context.Context) error {
+	s.users.drop()
+	return nil
+}
+
+func (s *UserStore) GetUserById(ctx context.Context, id string) (*types.User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	var user types.User
+	if err := s.users.findByID(oid, &user); err != nil {
+		return nil, utils.ResourceNotFound("user", id, err)
+	}
+	return &user, nil
+}
+
+func (s *UserStore) GetUsers(ctx context.Context) ([]*types.User, error) {
+	docs, err := s.users.find(nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[types.User](docs)
+}
+
+func (s *UserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user.Email = types.NormalizeEmail(user.Email)
+	taken, err := s.users.find(bson.M{"email": user.Email}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(taken) > 0 {
+		return nil, db.EmailTaken(user.Email)
+	}
+	oid, err := s.users.insert(user)
+	if err != nil {
+		return nil, err
+	}
+	user.ID = oid
+	return user, nil
+}
+
+func (s *UserStore) DeleteUserById(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.users.delete(bson.M{"_id": oid}, true)
+	return err
+}
+
+func (s *UserStore) UpdateUserById(ctx context.Context, params types.UpdateUserParams, id string) error {
+	update := params.ToUpdate()
+	if len(update) == 0 {
+		return nil
+	}
+	return s.set(id, update)
+}
+
+func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	var user types.User
+	if err := s.users.findOne(bson.M{"email": types.NormalizeEmail(email)}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *UserStore) SetUserRole(ctx context.Context, id string, role types.Role, hotelIDs []primitive.ObjectID) error {
+	return s.set(id, db.RoleUpdate(role, hotelIDs))
+}
+
+func (s *UserStore) SetEmailVerified(ctx context.Context, id string, verified bool) error {
+	return s.set(id, bson.M{"emailVerified": verified})
+}
+
+func (s *UserStore) VerifyEmail(ctx context.Context, id string, email string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return db.NewResourceError(err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matched, err := s.users.update(db.VerifyEmailFilter(oid, email), bson.M{"$set": bson.M{"emailVerified": true}}, true)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *UserStore) SetPassword(ctx context.Context, id string, encryptedPassword string) error {
+	return s.set(id, db.PasswordUpdate(encryptedPassword, time.Now()))
+}
+
+func (s *UserStore) SetTOTP(ctx context.Context, id string, totp *types.TOTP) error {
+	return s.set(id, bson.M{"totp": totp})
+}
+
+func (s *UserStore) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return db.NewResourceError(err.Error())
+	}
+	matched, err := s.users.update(db.TOTPStepFilter(oid, step), bson.M{"$set": bson.M{"totp.lastStep": step}}, true)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return db.TOTPCodeUsed()
+	}
+	return nil
+}
+
+func (s *UserStore) UseRecoveryCode(ctx context.Context, id string, hash string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return db.NewResourceError(err.Error())
+	}
+	filter := bson.M{"_id": oid, "totp.recoveryCodes": hash}
+	matched, err := s.users.update(filter, bson.M{"$pull": bson.M{"totp.recoveryCodes": hash}}, true)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *UserStore) set(id string, fields map[string]any) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return db.NewResourceError(err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if email, ok := fields["email"]; ok {
+		taken, err := s.users.find(bson.M{"email": email, "_id": bson.M{"$ne": oid}}, 0, 1)
+		if err != nil {
+			return err
+		}
+		if len(taken) > 0 {
+			return db.EmailTaken(fmt.Sprint(email))
+		}
+	}
+	matched, err := s.users.update(bson.M{"_id": oid}, bson.M{"$set": fields}, true)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-faker/faker/v4"
+	"github.com/stretchr/testify/suite"
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	userfixtures "github.com/swarajroy/hotel-reservation/types/user_fixtures"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UserStoreSuite struct {
+	suite.Suite
+	userStore db.UserStore
+}
+
+func (suite *UserStoreSuite) SetupTest() {
+	suite.userStore = NewUserStore()
+}
+
+func (suite *UserStoreSuite) TestInsertUser() {
+	expected, err := userfixtures.Next()
+	if err != nil {
+		suite.T().Fatalf("error generating user")
+	}
+
+	actual, err := suite.userStore.InsertUser(context.Background(), expected)
+
+	suite.Nil(err)
+	suite.NotNil(actual)
+	suite.False(actual.ID.IsZero())
+	suite.Equal(expected, actual)
+}
+
+func (suite *UserStoreSuite) TestUpdateUserById() {
+	var (
+		ctx   = context.Background()
+		fName = faker.FirstName()
+		lName = faker.LastName()
+	)
+	user, _ := userfixtures.Next()
+	insertedUser, _ := suite.userStore.InsertUser(ctx, user)
+
+	err := suite.userStore.UpdateUserById(ctx, types.UpdateUserParams{FirstName: &fName, LastName: &lName}, insertedUser.ID.Hex())
+
+	suite.Nil(err)
+
+	retrievedUser, err := suite.userStore.GetUserById(ctx, insertedUser.ID.Hex())
+
+	suite.Nil(err)
+	suite.Equal(fName, retrievedUser.FirstName)
+	suite.Equal(lName, retrievedUser.LastName)
+}
+
+func (suite *UserStoreSuite) TestGetUserByIdReturnsCopy() {
+	var (
+		ctx = context.Background()
+	)
+	user, _ := userfixtures.Next()
+	insertedUser, _ := suite.userStore.InsertUser(ctx, user)
+
+	retrievedUser, err := suite.userStore.GetUserById(ctx, insertedUser.ID.Hex())
+	suite.Nil(err)
+	retrievedUser.FirstName = "changed"
+
+	again, err := suite.userStore.GetUserById(ctx, insertedUser.ID.Hex())
+	suite.Nil(err)
+	suite.Equal(insertedUser.FirstName, again.FirstName)
+}
+
+func (suite *UserStoreSuite) TestGetUserByEmail() {
+	var (
+		ctx = context.Background()
+	)
+	expected, _ := userfixtures.Next()
+	insertedUser, _ := suite.userStore.InsertUser(ctx, expected)
+
+	retrievedUser, err := suite.userStore.GetUserByEmail(ctx, expected.Email)
+
+	suite.Nil(err)
+	suite.Equal(insertedUser, retrievedUser)
+
+	_, err = suite.userStore.GetUserByEmail(ctx, "nobody@foo.com")
+	suite.ErrorIs(err, mongo.ErrNoDocuments)
+}
+
+func (suite *UserStoreSuite) TestEmailsIgnoreCase() {
+	var (
+		ctx = context.Background()
+	)
+	user, _ := userfixtures.Next()
+	user.Email = " James.Foo@Example.com"
+	insertedUser, err := suite.userStore.InsertUser(ctx, user)
+	suite.Nil(err)
+	suite.Equal("james.foo@example.com", insertedUser.Email)
+
+	retrievedUser, err := suite.userStore.GetUserByEmail(ctx, "JAMES.FOO@example.com ")
+	suite.Nil(err)
+	suite.Equal(insertedUser.ID, retrievedUser.ID)
+
+	other, _ := userfixtures.Next()
+	other.Email = "james.foo@EXAMPLE.com"
+	_, err = suite.userStore.InsertUser(ctx, other)
+	suite.ErrorAs(err, &db.ConflictError{})
+
+	other.Email = "someone@example.com"
+	other, err = suite.userStore.InsertUser(ctx, other)
+	suite.Nil(err)
+	email := "James.Foo@example.com"
+	err = suite.userStore.UpdateUserById(ctx, types.UpdateUserParams{Email: &email}, other.ID.Hex())
+	suite.ErrorAs(err, &db.ConflictError{})
+}
+
+func (suite *UserStoreSuite) TestDeleteUserById() {
+	var (
+		ctx = context.Background()
+	)
+	expected, _ := userfixtures.Next()
+	insertedUser, _ := suite.userStore.InsertUser(ctx, expected)
+
+	err := suite.userStore.DeleteUserById(ctx, insertedUser.ID.Hex())
+	suite.Nil(err)
+
+	users, err := suite.userStore.GetUsers(ctx)
+	suite.Nil(err)
+	suite.Empty(users)
+}
+
+func (suite *UserStoreSuite) TestTOTPCodesAreUsedOnce() {
+	var (
+		ctx = context.Background()
+	)
+	user, _ := userfixtures.Next()
+	insertedUser, _ := suite.userStore.InsertUser(ctx, user)
+	id := insertedUser.ID.Hex()
+
+	totp, codes, err := types.NewTOTP()
+	suite.Nil(err)
+	totp.Enabled = true
+	suite.Nil(suite.userStore.SetTOTP(ctx, id, totp))
+
+	suite.Nil(suite.userStore.UseTOTPStep(ctx, id, 100))
+	var conflict db.ConflictError
+	suite.ErrorAs(suite.userStore.UseTOTPStep(ctx, id, 100), &conflict)
+	suite.ErrorAs(suite.userStore.UseTOTPStep(ctx, id, 99), &conflict)
+	suite.Nil(suite.userStore.UseTOTPStep(ctx, id, 101))
+
+	hash := types.HashRecoveryCode(codes[0])
+	suite.Nil(suite.userStore.UseRecoveryCode(ctx, id, hash))
+	suite.ErrorIs(suite.userStore.UseRecoveryCode(ctx, id, hash), mongo.ErrNoDocuments)
+
+	retrieved, err := suite.userStore.GetUserById(ctx, id)
+	suite.Nil(err)
+	suite.True(retrieved.TOTPEnabled())
+	suite.Equal(int64(101), retrieved.TOTP.LastStep)
+	suite.Len(retrieved.TOTP.RecoveryCodes, types.RECOVERY_CODES-1)
+
+	suite.Nil(suite.userStore.SetTOTP(ctx, id, nil))
+	retrieved, err = suite.userStore.GetUserById(ctx, id)
+	suite.Nil(err)
+	suite.False(retrieved.TOTPEnabled())
+}
+
+func TestUserStoreSuite(t *testing.T) {
+	suite.Run(t, new(UserStoreSuite))
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/armory-io/go-commons/awaitility"
 	"github.com/docker/go-connections/nat"
+	"github.com/swarajroy/hotel-reservation/config"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -31,6 +32,11 @@ type TestMongoClient struct {
 	DbName    string
 }
 
+// Config returns the settings of the stores using the test database.
+func (c *TestMongoClient) Config() config.Mongo {
+	return config.Mongo{URI: c.Uri, Database: c.DbName}
+}
+
 func NewTestMongoClient(dbName string) (*TestMongoClient, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
 	defer cancel()
@@ -7,9 +7,24 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// notFoundError names the missing resource while still matching
+// mongo.ErrNoDocuments with errors.Is.
+type notFoundError struct {
+	msg string
+	err error
+}
+
+func (e notFoundError) Error() string {
+	return e.msg
+}
+
+func (e notFoundError) Unwrap() error {
+	return e.err
+}
+
 func ResourceNotFound(name, id string, err error) error {
 	if errors.Is(mongo.ErrNoDocuments, err) {
-		return fmt.Errorf("resource %s with id %s not found", name, id)
+		return notFoundError{msg: fmt.Sprintf("resource %s with id %s not found", name, id), err: err}
 	}
 	return err
 }
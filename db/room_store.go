@@ -2,8 +2,10 @@ package db
 
 import (
 	"context"
-	"fmt"
+	"time"
 
+	"github.com/swarajroy/hotel-reservation/config"
+	"github.com/swarajroy/hotel-reservation/logging"
 	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -14,6 +16,13 @@ type RoomStore interface {
 	Dropper
 	InsertRoom(context.Context, *types.Room) (*types.Room, error)
 	GetRooms(ctx context.Context, filter bson.M) ([]*types.Room, error)
+	GetRoomById(context.Context, string) (*types.Room, error)
+	UpdateRoomById(ctx context.Context, id string, update map[string]any) error
+	// DeleteRoomById removes the room and takes it off its hotel's rooms.
+	DeleteRoomById(context.Context, string) error
+	// GetAvailableRooms returns the rooms matching filter that have no active
+	// booking sharing a night with the stay from..till.
+	GetAvailableRooms(ctx context.Context, filter bson.M, from, till time.Time) ([]*types.Room, error)
 }
 
 const (
@@ -26,16 +35,16 @@ type MongoDbRoomStore struct {
 	hotelStore HotelStore
 }
 
-func NewMongoDbRoomStore(client *mongo.Client, dbname string, hotelStore HotelStore) *MongoDbRoomStore {
+func NewMongoDbRoomStore(client *mongo.Client, cfg config.Mongo, hotelStore HotelStore) *MongoDbRoomStore {
 	return &MongoDbRoomStore{
 		client:     client,
-		roomColl:   client.Database(dbname).Collection(ROOM_COLL),
+		roomColl:   client.Database(cfg.Database).Collection(ROOM_COLL),
 		hotelStore: hotelStore,
 	}
 }
 
 func (s *MongoDbRoomStore) Drop(ctx context.Context) error {
-	fmt.Println("--- dropping room collection ---")
+	logging.FromContext(ctx).Info("dropping collection", "collection", ROOM_COLL)
 	return s.roomColl.Drop(ctx)
 }
 
@@ -66,3 +75,78 @@ func (s *MongoDbRoomStore) GetRooms(ctx context.Context, filter bson.M) ([]*type
 	}
 	return rooms, nil
 }
+
+func (s *MongoDbRoomStore) GetRoomById(ctx context.Context, id string) (*types.Room, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, NewResourceError(err.Error())
+	}
+	var room types.Room
+	if err := s.roomColl.FindOne(ctx, bson.M{"_id": oid}).Decode(&room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (s *MongoDbRoomStore) UpdateRoomById(ctx context.Context, id string, update map[string]any) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	res, err := s.roomColl.UpdateByID(ctx, oid, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoDbRoomStore) DeleteRoomById(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	var room types.Room
+	if err := s.roomColl.FindOneAndDelete(ctx, bson.M{"_id": oid}).Decode(&room); err != nil {
+		return err
+	}
+
+	// the reverse of the $push in InsertRoom
+	filter := bson.M{"_id": room.HotelID}
+	update := bson.M{"$pull": bson.M{"rooms": room.ID}}
+	return s.hotelStore.UpdateHotel(ctx, filter, update)
+}
+
+// GetAvailableRooms joins every matching room with its overlapping bookings in
+// a single aggregation and keeps the rooms without any.
+func (s *MongoDbRoomStore) GetAvailableRooms(ctx context.Context, filter bson.M, from, till time.Time) ([]*types.Room, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	overlapping := activeStayFilter(from, till)
+	overlapping["$expr"] = bson.M{"$eq": bson.A{"$roomID", "$$roomID"}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":     BOOKING_COLL,
+			"let":      bson.M{"roomID": "$_id"},
+			"pipeline": bson.A{bson.M{"$match": overlapping}, bson.M{"$limit": 1}},
+			"as":       "overlapping",
+		}}},
+		{{Key: "$match", Value: bson.M{"overlapping": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"overlapping": 0}}},
+		{{Key: "$sort", Value: bson.D{{Key: "hotelId", Value: 1}, {Key: "price", Value: 1}}}},
+	}
+	resp, err := s.roomColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rooms []*types.Room
+	if err := resp.All(ctx, &rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
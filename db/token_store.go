@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/config"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	REFRESH_TOKEN_COLL  = "refreshTokens"
+	REVOCATION_COLL     = "revocations"
+	ONE_TIME_TOKEN_COLL = "oneTimeTokens"
+)
+
+type TokenStore interface {
+	Dropper
+	InsertRefreshToken(context.Context, *types.RefreshToken) (*types.RefreshToken, error)
+	// RotateRefreshToken replaces the active refresh token with hash by next,
+	// which joins the session and user of the replaced token and keeps its
+	// MFA flag. A token that was
+	// already replaced or revoked gives a ConflictError, an unknown or expired
+	// one mongo.ErrNoDocuments.
+	RotateRefreshToken(ctx context.Context, hash string, next *types.RefreshToken) (*types.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, hash string) (*types.RefreshToken, error)
+	// RevokeSession revokes the refresh tokens of the session and puts the
+	// session on the revocation list until the given time.
+	RevokeSession(ctx context.Context, sessionID string, until time.Time) error
+	// Revoke puts the token or session id on the revocation list until the
+	// given time, after which the token has expired anyway.
+	Revoke(ctx context.Context, id string, until time.Time) error
+	// IsRevoked reports whether any of ids is on the revocation list.
+	IsRevoked(ctx context.Context, ids ...string) (bool, error)
+	// RevokeUserSessions revokes every session of the user like
+	// RevokeSession.
+	RevokeUserSessions(ctx context.Context, userID primitive.ObjectID, until time.Time) error
+	InsertOneTimeToken(context.Context, *types.OneTimeToken) (*types.OneTimeToken, error)
+	// UseOneTimeToken marks the unused and unexpired token with hash and
+	// purpose as used and returns it. Any other token gives
+	// mongo.ErrNoDocuments.
+	UseOneTimeToken(ctx context.Context, hash string, purpose types.TokenPurpose) (*types.OneTimeToken, error)
+}
+
+// revocation is an entry of the revocation list kept in REVOCATION_COLL.
+type revocation struct {
+	ID        string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+type MongoDbTokenStore struct {
+	client          *mongo.Client
+	refreshColl     *mongo.Collection
+	revocationsColl *mongo.Collection
+	oneTimeColl     *mongo.Collection
+}
+
+func NewMongoDbTokenStore(client *mongo.Client, cfg config.Mongo) *MongoDbTokenStore {
+	return &MongoDbTokenStore{
+		client:          client,
+		refreshColl:     client.Database(cfg.Database).Collection(REFRESH_TOKEN_COLL),
+		revocationsColl: client.Database(cfg.Database).Collection(REVOCATION_COLL),
+		oneTimeColl:     client.Database(cfg.Database).Collection(ONE_TIME_TOKEN_COLL),
+	}
+}
+
+// EnsureIndexes makes refresh and one-time token hashes unique and lets
+// MongoDB remove tokens and revocations once they have expired.
+func (s *MongoDbTokenStore) EnsureIndexes(ctx context.Context) error {
+	expires := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	_, err := s.refreshColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "sessionID", Value: 1}}},
+		expires,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = s.revocationsColl.Indexes().CreateOne(ctx, expires); err != nil {
+		return err
+	}
+	_, err = s.oneTimeColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		expires,
+	})
+	return err
+}
+
+func (s *MongoDbTokenStore) Drop(ctx context.Context) error {
+	if err := s.oneTimeColl.Drop(ctx); err != nil {
+		return err
+	}
+	if err := s.revocationsColl.Drop(ctx); err != nil {
+		return err
+	}
+	return s.refreshColl.Drop(ctx)
+}
+
+func (s *MongoDbTokenStore) InsertRefreshToken(ctx context.Context, token *types.RefreshToken) (*types.RefreshToken, error) {
+	res, err := s.refreshColl.InsertOne(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	token.ID = res.InsertedID.(primitive.ObjectID)
+	return token, nil
+}
+
+func (s *MongoDbTokenStore) GetRefreshToken(ctx context.Context, hash string) (*types.RefreshToken, error) {
+	var token types.RefreshToken
+	if err := s.refreshColl.FindOne(ctx, bson.M{"hash": hash}).Decode(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *MongoDbTokenStore) RotateRefreshToken(ctx context.Context, hash string, next *types.RefreshToken) (*types.RefreshToken, error) {
+	now := time.Now()
+	filter := ActiveRefreshTokenFilter(hash, now)
+	update := bson.M{"$set": bson.M{"rotatedAt": now}}
+
+	var current types.RefreshToken
+	err := s.refreshColl.FindOneAndUpdate(ctx, filter, update).Decode(&current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, s.rotationError(ctx, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	next.UserID = current.UserID
+	next.SessionID = current.SessionID
+	next.MFA = current.MFA
+	return s.InsertRefreshToken(ctx, next)
+}
+
+// rotationError tells a refresh token that was already used apart from one
+// that never existed or has expired.
+func (s *MongoDbTokenStore) rotationError(ctx context.Context, hash string) error {
+	token, err := s.GetRefreshToken(ctx, hash)
+	if err != nil {
+		return err
+	}
+	return RefreshTokenError(token)
+}
+
+func (s *MongoDbTokenStore) RevokeSession(ctx context.Context, sessionID string, until time.Time) error {
+	filter := bson.M{
+		"sessionID": sessionID,
+		"revokedAt": bson.M{"$exists": false},
+	}
+	if _, err := s.refreshColl.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}}); err != nil {
+		return err
+	}
+	return s.Revoke(ctx, sessionID, until)
+}
+
+func (s *MongoDbTokenStore) Revoke(ctx context.Context, id string, until time.Time) error {
+	update := bson.M{"$max": bson.M{"expiresAt": until}}
+	_, err := s.revocationsColl.UpdateByID(ctx, id, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *MongoDbTokenStore) IsRevoked(ctx context.Context, ids ...string) (bool, error) {
+	filter := RevokedFilter(ids, time.Now())
+	n, err := s.revocationsColl.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *MongoDbTokenStore) RevokeUserSessions(ctx context.Context, userID primitive.ObjectID, until time.Time) error {
+	sessionIDs, err := s.refreshColl.Distinct(ctx, "sessionID", UserSessionsFilter(userID, time.Now()))
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		if sid, ok := sessionID.(string); ok {
+			if err := s.RevokeSession(ctx, sid, until); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MongoDbTokenStore) InsertOneTimeToken(ctx context.Context, token *types.OneTimeToken) (*types.OneTimeToken, error) {
+	res, err := s.oneTimeColl.InsertOne(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	token.ID = res.InsertedID.(primitive.ObjectID)
+	return token, nil
+}
+
+func (s *MongoDbTokenStore) UseOneTimeToken(ctx context.Context, hash string, purpose types.TokenPurpose) (*types.OneTimeToken, error) {
+	now := time.Now()
+	var (
+		token  types.OneTimeToken
+		update = bson.M{"$set": bson.M{"usedAt": now}}
+		opts   = options.FindOneAndUpdate().SetReturnDocument(options.After)
+	)
+	if err := s.oneTimeColl.FindOneAndUpdate(ctx, UnusedOneTimeTokenFilter(hash, purpose, now), update, opts).Decode(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ActiveRefreshTokenFilter matches the refresh token with hash when it can
+// still be exchanged at now.
+func ActiveRefreshTokenFilter(hash string, now time.Time) bson.M {
+	return bson.M{
+		"hash":      hash,
+		"rotatedAt": bson.M{"$exists": false},
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+}
+
+// UserSessionsFilter matches the refresh tokens of the sessions of the user
+// that have not been revoked or expired at now.
+func UserSessionsFilter(userID primitive.ObjectID, now time.Time) bson.M {
+	return bson.M{
+		"userID":    userID,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+}
+
+// UnusedOneTimeTokenFilter matches the one-time token with hash and purpose
+// when it can still be used at now.
+func UnusedOneTimeTokenFilter(hash string, purpose types.TokenPurpose, now time.Time) bson.M {
+	return bson.M{
+		"hash":      hash,
+		"purpose":   purpose,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+}
+
+// RevokedFilter matches the revocations of any of ids that are in force at
+// now. Expired revocations may linger until the TTL monitor removes them.
+func RevokedFilter(ids []string, now time.Time) bson.M {
+	nonEmpty := []string{}
+	for _, id := range ids {
+		if len(id) > 0 {
+			nonEmpty = append(nonEmpty, id)
+		}
+	}
+	return bson.M{
+		"_id":       bson.M{"$in": nonEmpty},
+		"expiresAt": bson.M{"$gt": now},
+	}
+}
+
+// RefreshTokenError is the error for exchanging token when it is not active.
+func RefreshTokenError(token *types.RefreshToken) error {
+	if !token.RotatedAt.IsZero() || !token.RevokedAt.IsZero() {
+		return NewConflictError(fmt.Sprintf("refresh token of session %s was already used", token.SessionID))
+	}
+	return mongo.ErrNoDocuments
+}
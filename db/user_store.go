@@ -2,12 +2,18 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/swarajroy/hotel-reservation/config"
 	"github.com/swarajroy/hotel-reservation/db/mongo/utils"
+	"github.com/swarajroy/hotel-reservation/logging"
 	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
@@ -22,10 +28,31 @@ type UserStore interface {
 	Dropper
 	GetUserById(context.Context, string) (*types.User, error)
 	GetUsers(context.Context) ([]*types.User, error)
+	// InsertUser returns a ConflictError when the email is already taken.
 	InsertUser(context.Context, *types.User) (*types.User, error)
 	DeleteUserById(context.Context, string) error
+	// UpdateUserById changes the fields set in params. Changing the email
+	// to one that is taken gives a ConflictError.
 	UpdateUserById(ctx context.Context, params types.UpdateUserParams, id string) error
 	GetUserByEmail(context.Context, string) (*types.User, error)
+	// SetUserRole gives the user role for the hotels, which only matter for
+	// scoped roles.
+	SetUserRole(ctx context.Context, id string, role types.Role, hotelIDs []primitive.ObjectID) error
+	SetEmailVerified(ctx context.Context, id string, verified bool) error
+	// VerifyEmail marks the email of the user as verified if it is still
+	// email, and otherwise gives mongo.ErrNoDocuments.
+	VerifyEmail(ctx context.Context, id string, email string) error
+	// SetPassword replaces the password of the user and stops accepting
+	// the access tokens issued before.
+	SetPassword(ctx context.Context, id string, encryptedPassword string) error
+	// SetTOTP replaces the second factor of the user, nil removes it.
+	SetTOTP(ctx context.Context, id string, totp *types.TOTP) error
+	// UseTOTPStep records that the code of step was used. A step that is not
+	// after the last used one gives a ConflictError.
+	UseTOTPStep(ctx context.Context, id string, step int64) error
+	// UseRecoveryCode removes the recovery code with hash. An unknown or
+	// used code gives mongo.ErrNoDocuments.
+	UseRecoveryCode(ctx context.Context, id string, hash string) error
 }
 
 type MongoDbUserStore struct {
@@ -37,10 +64,10 @@ func (s *MongoDbUserStore) Drop(ctx context.Context) error {
 	return s.userColl.Drop(ctx)
 }
 
-func NewMongoDbUserStore(client *mongo.Client, dbname string) *MongoDbUserStore {
+func NewMongoDbUserStore(client *mongo.Client, cfg config.Mongo) *MongoDbUserStore {
 	return &MongoDbUserStore{
 		client:   client,
-		userColl: client.Database(dbname).Collection(USER_COLL),
+		userColl: client.Database(cfg.Database).Collection(USER_COLL),
 	}
 }
 
@@ -58,8 +85,67 @@ func (s *MongoDbUserStore) DeleteUserById(ctx context.Context, id string) error
 	return nil
 }
 
+// EnsureIndexes makes user emails unique.
+func (s *MongoDbUserStore) EnsureIndexes(ctx context.Context) error {
+	if err := s.normalizeEmails(ctx); err != nil {
+		return err
+	}
+	_, err := s.userColl.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// normalizeEmails lower-cases the emails stored before lookups ignored their
+// case. Emails that only differ in case belong to accounts that have to be
+// merged by hand, so they fail the migration instead of locking one out.
+func (s *MongoDbUserStore) normalizeEmails(ctx context.Context) error {
+	cur, err := s.userColl.Find(ctx, bson.M{
+		"$expr": bson.M{"$ne": bson.A{"$email", bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}}}},
+	}, options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return err
+	}
+	var users []*types.User
+	if err := cur.All(ctx, &users); err != nil {
+		return err
+	}
+
+	owners := map[string]primitive.ObjectID{}
+	for _, user := range users {
+		email := types.NormalizeEmail(user.Email)
+		if owner, ok := owners[email]; ok {
+			return fmt.Errorf("users %s and %s both have the email %s", owner.Hex(), user.ID.Hex(), email)
+		}
+		var taken types.User
+		err := s.userColl.FindOne(ctx, bson.M{"email": email}).Decode(&taken)
+		if err == nil {
+			return fmt.Errorf("users %s and %s both have the email %s", taken.ID.Hex(), user.ID.Hex(), email)
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		owners[email] = user.ID
+	}
+	for _, user := range users {
+		email := types.NormalizeEmail(user.Email)
+		if _, err := s.userColl.UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"email": email}}); err != nil {
+			return err
+		}
+	}
+	if len(users) > 0 {
+		logging.FromContext(ctx).Info("lower-cased stored emails", "users", len(users))
+	}
+	return nil
+}
+
 func (s *MongoDbUserStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	user.Email = types.NormalizeEmail(user.Email)
 	res, err := s.userColl.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, EmailTaken(user.Email)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -93,35 +179,151 @@ func (s *MongoDbUserStore) GetUserById(ctx context.Context, id string) (*types.U
 }
 
 func (s *MongoDbUserStore) UpdateUserById(ctx context.Context, params types.UpdateUserParams, id string) error {
+	update := params.ToUpdate()
+	if len(update) == 0 {
+		return nil
+	}
+	return s.set(ctx, id, update)
+}
+
+func (s *MongoDbUserStore) GetUserByEmail(c context.Context, email string) (*types.User, error) {
+	filter := bson.M{
+		"email": types.NormalizeEmail(email),
+	}
+	result := s.userColl.FindOne(c, filter)
+	var user *types.User
+	if err := result.Decode(&user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *MongoDbUserStore) SetUserRole(ctx context.Context, id string, role types.Role, hotelIDs []primitive.ObjectID) error {
+	return s.set(ctx, id, RoleUpdate(role, hotelIDs))
+}
+
+func (s *MongoDbUserStore) SetEmailVerified(ctx context.Context, id string, verified bool) error {
+	return s.set(ctx, id, bson.M{"emailVerified": verified})
+}
+
+func (s *MongoDbUserStore) SetPassword(ctx context.Context, id string, encryptedPassword string) error {
+	return s.set(ctx, id, PasswordUpdate(encryptedPassword, time.Now()))
+}
+
+func (s *MongoDbUserStore) SetTOTP(ctx context.Context, id string, totp *types.TOTP) error {
+	return s.set(ctx, id, bson.M{"totp": totp})
+}
+
+func (s *MongoDbUserStore) VerifyEmail(ctx context.Context, id string, email string) error {
 	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	res, err := s.userColl.UpdateOne(ctx, VerifyEmailFilter(oid, email), bson.M{"$set": bson.M{"emailVerified": true}})
 	if err != nil {
 		return err
 	}
-	filter := bson.M{
-		"_id": oid,
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *MongoDbUserStore) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	res, err := s.userColl.UpdateOne(ctx, TOTPStepFilter(oid, step), bson.M{"$set": bson.M{"totp.lastStep": step}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return TOTPCodeUsed()
 	}
+	return nil
+}
 
-	update := bson.M{
-		"$set": bson.M{
-			"firstName": params.FirstName,
-			"lastName":  params.LastName,
-		},
+func (s *MongoDbUserStore) UseRecoveryCode(ctx context.Context, id string, hash string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	filter := bson.M{"_id": oid, "totp.recoveryCodes": hash}
+	res, err := s.userColl.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"totp.recoveryCodes": hash}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
 	}
+	return nil
+}
 
-	if _, err := s.userColl.UpdateOne(ctx, filter, update); err != nil {
-		return utils.ResourceNotFound("user", id, err)
+// set sets fields of the user with id. An invalid id gives a DBError, an
+// unknown one mongo.ErrNoDocuments.
+func (s *MongoDbUserStore) set(ctx context.Context, id string, fields map[string]any) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return NewResourceError(err.Error())
+	}
+	res, err := s.userColl.UpdateByID(ctx, oid, bson.M{"$set": fields})
+	if mongo.IsDuplicateKeyError(err) {
+		return EmailTaken(fmt.Sprint(fields["email"]))
+	}
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
 	}
 	return nil
 }
 
-func (s *MongoDbUserStore) GetUserByEmail(c context.Context, email string) (*types.User, error) {
-	filter := bson.M{
-		"email": email,
+// RoleUpdate returns the user fields that record role. IsAdmin is kept in
+// step for code that still reads it.
+func RoleUpdate(role types.Role, hotelIDs []primitive.ObjectID) map[string]any {
+	return map[string]any{
+		"role":     role,
+		"hotelIds": hotelIDs,
+		"isAdmin":  role == types.ADMIN,
 	}
-	result := s.userColl.FindOne(c, filter)
-	var user *types.User
-	if err := result.Decode(&user); err != nil {
-		return nil, err
+}
+
+// EmailTaken is the ConflictError for registering an email twice.
+func EmailTaken(email string) error {
+	return NewConflictError(fmt.Sprintf("email %s is already registered", email))
+}
+
+// PasswordUpdate returns the user fields that record a new password set at
+// now.
+func PasswordUpdate(encryptedPassword string, now time.Time) map[string]any {
+	return map[string]any{
+		"encryptedPassword": encryptedPassword,
+		"tokensValidAfter":  now,
 	}
-	return user, nil
+}
+
+// VerifyEmailFilter matches the user with id while their email is email, so
+// a verification mailed to an earlier address can't verify a later one.
+func VerifyEmailFilter(id primitive.ObjectID, email string) bson.M {
+	return bson.M{
+		"_id":   id,
+		"email": types.NormalizeEmail(email),
+	}
+}
+
+// TOTPStepFilter matches the user with id when the TOTP code of step has not
+// been used yet.
+func TOTPStepFilter(id primitive.ObjectID, step int64) bson.M {
+	return bson.M{
+		"_id":           id,
+		"totp.enabled":  bson.M{"$exists": true},
+		"totp.lastStep": bson.M{"$lt": step},
+	}
+}
+
+// TOTPCodeUsed is the ConflictError for using a TOTP code twice.
+func TOTPCodeUsed() error {
+	return NewConflictError("the two-factor code was already used")
 }
@@ -27,7 +27,7 @@ func (suite *UserStoreSuite) SetupSuite() {
 	}
 
 	suite.testMongoClient = client
-	suite.userStore = NewMongoDbUserStore(suite.testMongoClient.Client, DB_NAME)
+	suite.userStore = NewMongoDbUserStore(suite.testMongoClient.Client, suite.testMongoClient.Config())
 
 }
 
@@ -63,7 +63,7 @@ func (suite *UserStoreSuite) TestUpdateUserById() {
 	user, _ := userfixtures.Next()
 	insertedUser, _ := suite.userStore.InsertUser(ctx, user)
 
-	err := suite.userStore.UpdateUserById(ctx, types.UpdateUserParams{FirstName: fName, LastName: lName}, insertedUser.ID.Hex())
+	err := suite.userStore.UpdateUserById(ctx, types.UpdateUserParams{FirstName: &fName, LastName: &lName}, insertedUser.ID.Hex())
 
 	suite.Nil(err)
 
@@ -131,6 +131,71 @@ func (suite *UserStoreSuite) TestGetUserByEmail() {
 	suite.Equal(insertedUser, retrievedUser)
 }
 
+func (suite *UserStoreSuite) TestEmailsIgnoreCase() {
+	var (
+		ctx = context.Background()
+	)
+	if err := suite.userStore.(*MongoDbUserStore).EnsureIndexes(ctx); err != nil {
+		suite.T().Fatal(err)
+	}
+	user, _ := userfixtures.Next()
+	user.Email = " James.Foo@Example.com"
+	insertedUser, err := suite.userStore.InsertUser(ctx, user)
+	suite.Nil(err)
+	suite.Equal("james.foo@example.com", insertedUser.Email)
+
+	retrievedUser, err := suite.userStore.GetUserByEmail(ctx, "JAMES.FOO@example.com ")
+	suite.Nil(err)
+	suite.Equal(insertedUser.ID, retrievedUser.ID)
+
+	other, _ := userfixtures.Next()
+	other.Email = "james.foo@EXAMPLE.com"
+	_, err = suite.userStore.InsertUser(ctx, other)
+	suite.ErrorAs(err, &ConflictError{})
+}
+
+func (suite *UserStoreSuite) TestEnsureIndexesLowerCasesStoredEmails() {
+	var (
+		ctx   = context.Background()
+		store = suite.userStore.(*MongoDbUserStore)
+	)
+	// users of other tests are kept, so start from an empty collection
+	suite.Nil(store.Drop(ctx))
+	defer store.Drop(ctx)
+	user, _ := userfixtures.Next()
+	user.Email = "James.Foo@Example.com"
+	if _, err := store.userColl.InsertOne(ctx, user); err != nil {
+		suite.T().Fatal(err)
+	}
+
+	suite.Nil(store.EnsureIndexes(ctx))
+	retrievedUser, err := store.GetUserByEmail(ctx, "james.foo@example.com")
+	suite.Nil(err)
+	suite.Equal("james.foo@example.com", retrievedUser.Email)
+}
+
+func (suite *UserStoreSuite) TestEnsureIndexesRefusesEmailsOnlyDifferingInCase() {
+	var (
+		ctx   = context.Background()
+		store = suite.userStore.(*MongoDbUserStore)
+	)
+	// users of other tests are kept, so start from an empty collection
+	suite.Nil(store.Drop(ctx))
+	defer store.Drop(ctx)
+	for _, email := range []string{"james.foo@example.com", "James.Foo@example.com"} {
+		user, _ := userfixtures.Next()
+		user.Email = email
+		if _, err := store.userColl.InsertOne(ctx, user); err != nil {
+			suite.T().Fatal(err)
+		}
+	}
+
+	err := store.EnsureIndexes(ctx)
+	suite.ErrorContains(err, "james.foo@example.com")
+	_, err = store.GetUserByEmail(ctx, "james.foo@example.com")
+	suite.Nil(err)
+}
+
 func (suite *UserStoreSuite) TestDeleteUserById() {
 	var (
 		ctx = context.Background()
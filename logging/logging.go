@@ -0,0 +1,48 @@
+// Package logging builds the structured logger of the API. Its records never
+// carry secrets: tokens, passwords and keys are redacted and email addresses
+// are masked, whatever attribute they are logged under.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/swarajroy/hotel-reservation/config"
+)
+
+// CONTEXT_KEY is the key the logger of a request is kept under in its
+// context, which for handlers is the user values of the fasthttp.RequestCtx.
+const CONTEXT_KEY = "logger"
+
+// New returns a logger writing records of cfg's level and up to w as JSON,
+// or as text when cfg asks for it.
+func New(w io.Writer, cfg config.Log) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       level(cfg.Level),
+		ReplaceAttr: Redact,
+	}
+	if cfg.Format == config.LogFormatText {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+func level(name string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// FromContext returns the logger of the request ctx belongs to, which is
+// tagged with its request id, or the default logger outside of requests.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(CONTEXT_KEY).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const REDACTED = "[REDACTED]"
+
+var (
+	// secretKeys are attributes whose values are always redacted, compared
+	// in lower case without separators
+	secretKeys = map[string]bool{
+		"key":           true,
+		"apikey":        true,
+		"xapikey":       true,
+		"code":          true,
+		"recoverycodes": true,
+		"challenge":     true,
+		"hash":          true,
+		"secret":        true,
+	}
+	// secretKeyParts redact any attribute whose key contains them
+	secretKeyParts = []string{"password", "token", "secret", "authorization", "cookie"}
+
+	emailPattern = regexp.MustCompile(`([a-zA-Z0-9.!#$%&'*+/=?^_{|}~-])[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]*@([a-zA-Z0-9.-]+)`)
+	// jwtPattern matches signed tokens and apiKeyPattern the keys of
+	// api.API_KEY_PREFIX, wherever they end up in a message
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`)
+	apiKeyPattern = regexp.MustCompile(`hrk_[A-Za-z0-9_-]+`)
+)
+
+// Redact is a slog ReplaceAttr function that hides the values of secret
+// attributes and scrubs the other strings and errors with Scrub.
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	if isSecretKey(a.Key) {
+		return slog.String(a.Key, REDACTED)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Scrub(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Scrub(err.Error()))
+		}
+	}
+	return a
+}
+
+func isSecretKey(key string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", "_", "", ".", "").Replace(key))
+	if secretKeys[normalized] {
+		return true
+	}
+	for _, part := range secretKeyParts {
+		if strings.Contains(normalized, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scrub masks the email addresses in s and removes the tokens and API keys.
+func Scrub(s string) string {
+	s = jwtPattern.ReplaceAllString(s, REDACTED)
+	s = apiKeyPattern.ReplaceAllString(s, REDACTED)
+	return emailPattern.ReplaceAllString(s, "$1***@$2")
+}
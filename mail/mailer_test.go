@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogMailer(t *testing.T) {
+	var b bytes.Buffer
+	mailer := NewLogMailer(&b)
+
+	err := mailer.Send(context.Background(), Message{To: "james@foo.com", Subject: "Hello", Body: "hi james"})
+	assert.Nil(t, err)
+	assert.Equal(t, "To: james@foo.com\nSubject: Hello\n\nhi james\n---\n", b.String())
+}
+
+func TestSMTPMailerRefusesHeaderInjection(t *testing.T) {
+	mailer, err := NewSMTPMailer("localhost:25", "", "", "hotel@foo.com")
+	assert.Nil(t, err)
+
+	err = mailer.Send(context.Background(), Message{To: "james@foo.com\r\nBcc: alice@foo.com", Subject: "Hello"})
+	assert.NotNil(t, err)
+}
+
+func TestSMTPMailerGivesUpWithContext(t *testing.T) {
+	// a server that accepts connections but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	mailer, err := NewSMTPMailer(ln.Addr().String(), "", "", "hotel@foo.com")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = mailer.Send(ctx, Message{To: "james@foo.com", Subject: "Hello", Body: "hi james"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -2,86 +2,258 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/swarajroy/hotel-reservation/api"
+	"github.com/swarajroy/hotel-reservation/config"
 	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/logging"
+	"github.com/swarajroy/hotel-reservation/mail"
+	"github.com/swarajroy/hotel-reservation/metrics"
+	"github.com/swarajroy/hotel-reservation/server"
+	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-var config = fiber.Config{
-	ErrorHandler: func(c *fiber.Ctx, err error) error {
-		if apiError, ok := err.(api.Error); ok {
-			return c.Status(apiError.Code).JSON(apiError)
-		}
-		apiError := api.NewError(http.StatusInternalServerError, err.Error())
-		return c.Status(apiError.Code).JSON(apiError)
-	},
-}
-
 func main() {
 
 	ctx := context.Background()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(db.DB_URI))
+	// "healthcheck" probes the readiness of a running server, for container
+	// healthchecks
+	args := os.Args[1:]
+	healthcheck := len(args) > 0 && args[0] == "healthcheck"
+	if healthcheck {
+		args = args[1:]
+	}
+
+	cfg, err := config.Load(args, os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatal("loading the config failed", err)
 	}
 
-	fmt.Println("Client connected successfully")
+	logger := logging.New(os.Stdout, cfg.Log)
+	slog.SetDefault(logger)
+
+	if healthcheck {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := server.Probe(ctx, cfg.Server.ListenAddr, "/readyz"); err != nil {
+			fatal("server is not ready", err)
+		}
+		return
+	}
+
+	client, err := db.Connect(ctx, cfg.Mongo)
+	if err != nil {
+		fatal("connecting to mongo failed", err)
+	}
+
+	logger.Info("connected to mongo", "database", cfg.Mongo.Database)
+
+	signer, err := api.NewTokenSignerFromConfig(cfg.JWT)
+	if err != nil {
+		fatal("loading the token signer failed", err)
+	}
+
+	mailer, err := mail.NewMailer(cfg.Mail)
+	if err != nil {
+		fatal("creating the mailer failed", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := metrics.Register(registry); err != nil {
+		fatal("registering the metrics failed", err)
+	}
 
-	listenAddr := flag.String("listenAddr", ":3000", "The API Servers port")
-	flag.Parse()
+	// the request id, metrics and access log come first so that every
+	// route, including the group middleware, is measured and runs with the
+	// request logger
+	app := fiber.New(api.AppConfig(cfg.Server))
+	app.Use(api.RequestID(), api.RequestMetrics(), api.AccessLog(logger))
 
 	var (
-		userStore    = db.NewMongoDbUserStore(client, db.DBNAME)
-		hotelStore   = db.NewMongoDbHotelStore(client, db.DBNAME)
-		roomStore    = db.NewMongoDbRoomStore(client, db.DBNAME, hotelStore)
-		bookingStore = db.NewMongoDbBookingStore(client, db.DBNAME)
-		store        = &db.HotelReservationStore{
+		userStore    = db.NewMongoDbUserStore(client, cfg.Mongo)
+		hotelStore   = db.NewMongoDbHotelStore(client, cfg.Mongo)
+		roomStore    = db.NewMongoDbRoomStore(client, cfg.Mongo, hotelStore)
+		bookingStore = db.NewMongoDbBookingStore(client, cfg.Mongo)
+		tokenStore   = db.NewMongoDbTokenStore(client, cfg.Mongo)
+		lockoutStore = db.NewMongoDbLockoutStore(client, cfg.Mongo)
+		apiKeyStore  = db.NewMongoDbAPIKeyStore(client, cfg.Mongo)
+		store        = metrics.InstrumentStore(&db.HotelReservationStore{
 			User:    userStore,
 			Hotel:   hotelStore,
 			Room:    roomStore,
 			Booking: bookingStore,
-		}
-		userHandler    = api.NewUserHandler(store)
+			Token:   tokenStore,
+			Lockout: lockoutStore,
+			APIKey:  apiKeyStore,
+		})
+		userHandler    = api.NewUserHandler(store, mailer)
 		hotelHandler   = api.NewHotelHandler(store)
 		roomHandler    = api.NewRoomHandler(store)
-		authHandler    = api.NewAuthHandler(store)
-		bookingHandler = api.NewBookingHandler(store)
-		app            = fiber.New(config)
+		authHandler    = api.NewAuthHandler(store, signer, mailer)
+		bookingHandler = api.NewBookingHandler(store, cfg.Cancellation.Policy())
+		availHandler   = api.NewAvailabilityHandler(store)
+		apiKeyHandler  = api.NewAPIKeyHandler(store)
+		healthHandler  = api.NewHealthHandler(map[string]api.HealthCheck{"mongo": pingMongo(client)})
 		auth           = app.Group("/api")
-		apiv1          = app.Group("/api/v1", api.JWTAuthentication(store))
+		apiv1          = app.Group("/api/v1", api.JWTAuthentication(store, signer))
 		admin          = apiv1.Group("/admin", api.AdminAuth)
 	)
 
+	if err := userStore.EnsureIndexes(ctx); err != nil {
+		fatal("creating the user indexes failed", err)
+	}
+	if err := tokenStore.EnsureIndexes(ctx); err != nil {
+		fatal("creating the token indexes failed", err)
+	}
+	if err := lockoutStore.EnsureIndexes(ctx); err != nil {
+		fatal("creating the lockout indexes failed", err)
+	}
+	if err := apiKeyStore.EnsureIndexes(ctx); err != nil {
+		fatal("creating the api key indexes failed", err)
+	}
+	if err := bookingStore.BackfillReservations(ctx); err != nil {
+		fatal("backfilling the room reservations failed", err)
+	}
+
+	// health handlers
+	app.Get("/healthz", healthHandler.HandleLiveness)
+	app.Get("/readyz", healthHandler.HandleReadiness)
+
 	// auth handlers
+	app.Get("/.well-known/jwks.json", signer.HandleJWKS)
 	auth.Post("/auth", authHandler.HandleAuth)
+	auth.Post("/auth/totp", authHandler.HandleTOTPLogin)
+	auth.Post("/auth/register", authHandler.HandleRegister)
+	auth.Post("/auth/verify", authHandler.HandleVerifyEmail)
+	auth.Post("/auth/forgot-password", authHandler.HandleForgotPassword)
+	auth.Post("/auth/reset-password", authHandler.HandleResetPassword)
+	auth.Post("/auth/refresh", authHandler.HandleRefresh)
+	auth.Post("/auth/logout", authHandler.HandleLogout)
 	// user handlers
-	apiv1.Get("/users", userHandler.HandleGetUsers)
 	apiv1.Get("/users/:id", userHandler.HandleGetUser)
-	apiv1.Post("/users", userHandler.HandlePostUser)
-	apiv1.Delete("/users/:id", userHandler.HandleDeleteUser)
-	apiv1.Put("/users/:id", userHandler.HandlePutUser)
+	apiv1.Patch("/users/:id", userHandler.HandlePatchUser)
+	// PUT is kept for existing clients and also only changes the given fields
+	apiv1.Put("/users/:id", userHandler.HandlePatchUser)
+	apiv1.Post("/users/me/password", authHandler.HandleChangePassword)
+	apiv1.Post("/users/me/totp", authHandler.HandleEnrollTOTP)
+	apiv1.Post("/users/me/totp/confirm", authHandler.HandleConfirmTOTP)
+	apiv1.Delete("/users/me/totp", authHandler.HandleDisableTOTP)
 
 	// hotel handler
 	apiv1.Get("/hotels", hotelHandler.HandleGetHotels)
 	apiv1.Get("/hotels/:id", hotelHandler.HandleGetHotelById)
 	apiv1.Get("/hotels/:id/rooms", hotelHandler.HandleGetRooms)
+	apiv1.Get("/hotels/:id/availability", availHandler.HandleGetHotelAvailability)
+	apiv1.Get("/hotels/:id/bookings", api.RequirePermission(types.READ_BOOKINGS, "id"), bookingHandler.HandleGetHotelBookings)
+
+	// availability handler
+	apiv1.Get("/availability", availHandler.HandleSearchAvailability)
 
 	// room handler
 	apiv1.Post("/room/:id/book", roomHandler.HandleBookRoom)
 
+	// inventory handlers - admin routes
+	admin.Post("/hotels", hotelHandler.HandlePostHotel)
+	admin.Put("/hotels/:id", hotelHandler.HandlePutHotel)
+	admin.Delete("/hotels/:id", hotelHandler.HandleDeleteHotel)
+	admin.Put("/hotels/:id/rateplan", hotelHandler.HandlePutRatePlan)
+	admin.Post("/hotels/:id/rooms", roomHandler.HandlePostRoom)
+	admin.Put("/hotels/:id/rooms/:roomID", roomHandler.HandlePutRoom)
+	admin.Delete("/hotels/:id/rooms/:roomID", roomHandler.HandleDeleteRoom)
+	// inventory handlers - hotel manager routes, the same as the admin ones
+	// above for the hotels a manager is assigned to
+	manageRooms := api.RequirePermission(types.MANAGE_ROOMS, "id")
+	apiv1.Put("/hotels/:id/rateplan", manageRooms, hotelHandler.HandlePutRatePlan)
+	apiv1.Post("/hotels/:id/rooms", manageRooms, roomHandler.HandlePostRoom)
+	apiv1.Put("/hotels/:id/rooms/:roomID", manageRooms, roomHandler.HandlePutRoom)
+	apiv1.Delete("/hotels/:id/rooms/:roomID", manageRooms, roomHandler.HandleDeleteRoom)
+
+	// user handlers - admin routes
+	admin.Get("/users", userHandler.HandleGetUsers)
+	admin.Post("/users", userHandler.HandlePostUser)
+	admin.Delete("/users/:id", userHandler.HandleDeleteUser)
+	admin.Put("/users/:id/role", userHandler.HandlePutUserRole)
+	admin.Post("/users/:id/unlock", userHandler.HandleUnlockUser)
+
+	// api key handlers - admin routes
+	admin.Post("/apikeys", apiKeyHandler.HandlePostAPIKey)
+	admin.Get("/apikeys", apiKeyHandler.HandleGetAPIKeys)
+	admin.Delete("/apikeys/:id", apiKeyHandler.HandleDeleteAPIKey)
+
 	// bookings handler - admin route
 	admin.Get("/bookings", bookingHandler.HandleGetBookings)
+	// kept for existing admin clients, admins cancel any booking free of charge
 	admin.Delete("/bookings/:id", bookingHandler.HandleDeleteBooking)
 	// bookings handler - user route
+	apiv1.Get("/bookings", bookingHandler.HandleGetUserBookings)
 	apiv1.Get("/bookings/:id", bookingHandler.HandleGetBooking)
+	apiv1.Patch("/bookings/:id", bookingHandler.HandlePatchBooking)
+	apiv1.Delete("/bookings/:id", bookingHandler.HandleDeleteBooking)
+
+	srv := server.New(app, cfg.Server)
+	srv.OnStart(func(context.Context) error {
+		logger.Info("server listening", "addr", srv.Addr())
+		return nil
+	})
+	srv.OnShutdown(client.Disconnect)
+	// shutdown hooks run last to first, so reset mails finish before the
+	// database is closed
+	srv.OnShutdown(authHandler.Drain)
+
+	// metrics are served on their own address so that publishing the API
+	// doesn't publish them
+	metricsApp := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler, DisableStartupMessage: true})
+	metricsApp.Get("/metrics", adaptor.HTTPHandler(metrics.Handler(registry)))
+	srv.OnStart(func(context.Context) error {
+		ln, err := net.Listen("tcp", cfg.Server.MetricsAddr)
+		if err != nil {
+			return fmt.Errorf("listening for metrics: %w", err)
+		}
+		go func() {
+			if err := metricsApp.Listener(ln); err != nil {
+				logger.Error("metrics server failed", "error", err)
+			}
+		}()
+		logger.Info("metrics listening", "addr", ln.Addr())
+		return nil
+	})
+	srv.OnShutdown(metricsApp.ShutdownWithContext)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := srv.Run(ctx); err != nil {
+		fatal("server failed", err)
+	}
+	logger.Info("server stopped")
+}
 
-	app.Listen(*listenAddr)
+// fatal logs err with the default logger and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// pingMongo checks that the primary of the MongoDB deployment answers.
+func pingMongo(client *mongo.Client) api.HealthCheck {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	}
 }
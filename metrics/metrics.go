@@ -0,0 +1,91 @@
+// Package metrics defines the Prometheus metrics of the API: request
+// latencies, booking and login counters, and the timings of the stores,
+// which are collected by wrapping them with InstrumentStore.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const NAMESPACE = "hotel_reservation"
+
+// Reasons a login failed, the values of the reason label of FailedLogins.
+const (
+	LOGIN_INVALID_CREDENTIALS   = "invalid_credentials"
+	LOGIN_INVALID_SECOND_FACTOR = "invalid_second_factor"
+	LOGIN_LOCKED_OUT            = "locked_out"
+)
+
+var (
+	// RequestDuration is labelled with the route pattern rather than the
+	// path, so ids in paths don't each get a series.
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	BookingsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "bookings_created_total",
+		Help:      "Bookings made.",
+	})
+	// BookingConflicts counts bookings and booking changes refused because
+	// the room was taken, by operation: book or modify.
+	BookingConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "booking_conflicts_total",
+		Help:      "Bookings and booking changes refused because the room was already booked.",
+	}, []string{"operation"})
+	// BookingsCancelled counts cancellations by who cancelled: guest or
+	// staff.
+	BookingsCancelled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "bookings_cancelled_total",
+		Help:      "Bookings cancelled.",
+	}, []string{"by"})
+	FailedLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "failed_logins_total",
+		Help:      "Logins refused, by reason.",
+	}, []string{"reason"})
+
+	StoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "store",
+		Name:      "operation_duration_seconds",
+		Help:      "Time taken by store operations, by store, operation and outcome.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"store", "operation", "outcome"})
+)
+
+// Register registers the metrics of the API with reg, along with the Go
+// runtime and process metrics.
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestDuration,
+		BookingsCreated,
+		BookingConflicts,
+		BookingsCancelled,
+		FailedLogins,
+		StoreDuration,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the metrics gathered by reg in the Prometheus text format.
+func Handler(reg prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
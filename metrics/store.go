@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InstrumentStore returns a copy of store whose user, hotel, room and booking
+// stores record the duration and outcome of every call in StoreDuration.
+func InstrumentStore(store *db.HotelReservationStore) *db.HotelReservationStore {
+	instrumented := *store
+	instrumented.User = &userStore{next: store.User}
+	instrumented.Hotel = &hotelStore{next: store.Hotel}
+	instrumented.Room = &roomStore{next: store.Room}
+	instrumented.Booking = &bookingStore{next: store.Booking}
+	return &instrumented
+}
+
+// observe records a store call that started at start and ended with *err.
+// It is deferred with a pointer to the named error result of the call.
+func observe(store, operation string, start time.Time, err *error) {
+	StoreDuration.WithLabelValues(store, operation, outcome(*err)).Observe(time.Since(start).Seconds())
+}
+
+func outcome(err error) string {
+	var conflict db.ConflictError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return "not_found"
+	case errors.As(err, &conflict):
+		return "conflict"
+	default:
+		return "error"
+	}
+}
+
+type userStore struct {
+	next db.UserStore
+}
+
+var _ db.UserStore = (*userStore)(nil)
+
+func (s *userStore) Drop(ctx context.Context) (err error) {
+	defer observe("user", "Drop", time.Now(), &err)
+	return s.next.Drop(ctx)
+}
+
+func (s *userStore) GetUserById(ctx context.Context, id string) (_ *types.User, err error) {
+	defer observe("user", "GetUserById", time.Now(), &err)
+	return s.next.GetUserById(ctx, id)
+}
+
+func (s *userStore) GetUsers(ctx context.Context) (_ []*types.User, err error) {
+	defer observe("user", "GetUsers", time.Now(), &err)
+	return s.next.GetUsers(ctx)
+}
+
+func (s *userStore) InsertUser(ctx context.Context, user *types.User) (_ *types.User, err error) {
+	defer observe("user", "InsertUser", time.Now(), &err)
+	return s.next.InsertUser(ctx, user)
+}
+
+func (s *userStore) DeleteUserById(ctx context.Context, id string) (err error) {
+	defer observe("user", "DeleteUserById", time.Now(), &err)
+	return s.next.DeleteUserById(ctx, id)
+}
+
+func (s *userStore) UpdateUserById(ctx context.Context, params types.UpdateUserParams, id string) (err error) {
+	defer observe("user", "UpdateUserById", time.Now(), &err)
+	return s.next.UpdateUserById(ctx, params, id)
+}
+
+func (s *userStore) GetUserByEmail(ctx context.Context, email string) (_ *types.User, err error) {
+	defer observe("user", "GetUserByEmail", time.Now(), &err)
+	return s.next.GetUserByEmail(ctx, email)
+}
+
+func (s *userStore) SetUserRole(ctx context.Context, id string, role types.Role, hotelIDs []primitive.ObjectID) (err error) {
+	defer observe("user", "SetUserRole", time.Now(), &err)
+	return s.next.SetUserRole(ctx, id, role, hotelIDs)
+}
+
+func (s *userStore) SetEmailVerified(ctx context.Context, id string, verified bool) (err error) {
+	defer observe("user", "SetEmailVerified", time.Now(), &err)
+	return s.next.SetEmailVerified(ctx, id, verified)
+}
+
+func (s *userStore) VerifyEmail(ctx context.Context, id string, email string) (err error) {
+	defer observe("user", "VerifyEmail", time.Now(), &err)
+	return s.next.VerifyEmail(ctx, id, email)
+}
+
+func (s *userStore) SetPassword(ctx context.Context, id string, encryptedPassword string) (err error) {
+	defer observe("user", "SetPassword", time.Now(), &err)
+	return s.next.SetPassword(ctx, id, encryptedPassword)
+}
+
+func (s *userStore) SetTOTP(ctx context.Context, id string, totp *types.TOTP) (err error) {
+	defer observe("user", "SetTOTP", time.Now(), &err)
+	return s.next.SetTOTP(ctx, id, totp)
+}
+
+func (s *userStore) UseTOTPStep(ctx context.Context, id string, step int64) (err error) {
+	defer observe("user", "UseTOTPStep", time.Now(), &err)
+	return s.next.UseTOTPStep(ctx, id, step)
+}
+
+func (s *userStore) UseRecoveryCode(ctx context.Context, id string, hash string) (err error) {
+	defer observe("user", "UseRecoveryCode", time.Now(), &err)
+	return s.next.UseRecoveryCode(ctx, id, hash)
+}
+
+type hotelStore struct {
+	next db.HotelStore
+}
+
+var _ db.HotelStore = (*hotelStore)(nil)
+
+func (s *hotelStore) Drop(ctx context.Context) (err error) {
+	defer observe("hotel", "Drop", time.Now(), &err)
+	return s.next.Drop(ctx)
+}
+
+func (s *hotelStore) InsertHotel(ctx context.Context, hotel *types.Hotel) (_ *types.Hotel, err error) {
+	defer observe("hotel", "InsertHotel", time.Now(), &err)
+	return s.next.InsertHotel(ctx, hotel)
+}
+
+func (s *hotelStore) UpdateHotel(ctx context.Context, filter map[string]any, update map[string]any) (err error) {
+	defer observe("hotel", "UpdateHotel", time.Now(), &err)
+	return s.next.UpdateHotel(ctx, filter, update)
+}
+
+func (s *hotelStore) GetHotels(ctx context.Context, filter map[string]any, pagination *db.Pagination) (_ []*types.Hotel, err error) {
+	defer observe("hotel", "GetHotels", time.Now(), &err)
+	return s.next.GetHotels(ctx, filter, pagination)
+}
+
+func (s *hotelStore) GetHotelById(ctx context.Context, id string) (_ *types.Hotel, err error) {
+	defer observe("hotel", "GetHotelById", time.Now(), &err)
+	return s.next.GetHotelById(ctx, id)
+}
+
+func (s *hotelStore) UpdateHotelById(ctx context.Context, id string, update map[string]any) (err error) {
+	defer observe("hotel", "UpdateHotelById", time.Now(), &err)
+	return s.next.UpdateHotelById(ctx, id, update)
+}
+
+func (s *hotelStore) DeleteHotelById(ctx context.Context, id string) (err error) {
+	defer observe("hotel", "DeleteHotelById", time.Now(), &err)
+	return s.next.DeleteHotelById(ctx, id)
+}
+
+type roomStore struct {
+	next db.RoomStore
+}
+
+var _ db.RoomStore = (*roomStore)(nil)
+
+func (s *roomStore) Drop(ctx context.Context) (err error) {
+	defer observe("room", "Drop", time.Now(), &err)
+	return s.next.Drop(ctx)
+}
+
+func (s *roomStore) InsertRoom(ctx context.Context, room *types.Room) (_ *types.Room, err error) {
+	defer observe("room", "InsertRoom", time.Now(), &err)
+	return s.next.InsertRoom(ctx, room)
+}
+
+func (s *roomStore) GetRooms(ctx context.Context, filter bson.M) (_ []*types.Room, err error) {
+	defer observe("room", "GetRooms", time.Now(), &err)
+	return s.next.GetRooms(ctx, filter)
+}
+
+func (s *roomStore) GetRoomById(ctx context.Context, id string) (_ *types.Room, err error) {
+	defer observe("room", "GetRoomById", time.Now(), &err)
+	return s.next.GetRoomById(ctx, id)
+}
+
+func (s *roomStore) UpdateRoomById(ctx context.Context, id string, update map[string]any) (err error) {
+	defer observe("room", "UpdateRoomById", time.Now(), &err)
+	return s.next.UpdateRoomById(ctx, id, update)
+}
+
+func (s *roomStore) DeleteRoomById(ctx context.Context, id string) (err error) {
+	defer observe("room", "DeleteRoomById", time.Now(), &err)
+	return s.next.DeleteRoomById(ctx, id)
+}
+
+func (s *roomStore) GetAvailableRooms(ctx context.Context, filter bson.M, from, till time.Time) (_ []*types.Room, err error) {
+	defer observe("room", "GetAvailableRooms", time.Now(), &err)
+	return s.next.GetAvailableRooms(ctx, filter, from, till)
+}
+
+type bookingStore struct {
+	next db.BookingStore
+}
+
+var _ db.BookingStore = (*bookingStore)(nil)
+
+func (s *bookingStore) Drop(ctx context.Context) (err error) {
+	defer observe("booking", "Drop", time.Now(), &err)
+	return s.next.Drop(ctx)
+}
+
+func (s *bookingStore) InsertBooking(ctx context.Context, booking *types.Booking) (_ *types.Booking, err error) {
+	defer observe("booking", "InsertBooking", time.Now(), &err)
+	return s.next.InsertBooking(ctx, booking)
+}
+
+func (s *bookingStore) BookRoom(ctx context.Context, booking *types.Booking) (_ *types.Booking, err error) {
+	defer observe("booking", "BookRoom", time.Now(), &err)
+	return s.next.BookRoom(ctx, booking)
+}
+
+func (s *bookingStore) ModifyBooking(ctx context.Context, booking *types.Booking) (err error) {
+	defer observe("booking", "ModifyBooking", time.Now(), &err)
+	return s.next.ModifyBooking(ctx, booking)
+}
+
+func (s *bookingStore) CancelBooking(ctx context.Context, id string, cancellation types.Cancellation) (err error) {
+	defer observe("booking", "CancelBooking", time.Now(), &err)
+	return s.next.CancelBooking(ctx, id, cancellation)
+}
+
+func (s *bookingStore) FindOverlapping(ctx context.Context, roomID primitive.ObjectID, from, till time.Time) (_ []*types.Booking, err error) {
+	defer observe("booking", "FindOverlapping", time.Now(), &err)
+	return s.next.FindOverlapping(ctx, roomID, from, till)
+}
+
+func (s *bookingStore) GetBookings(ctx context.Context, filter map[string]any, pagination *db.Pagination) (_ []*types.Booking, err error) {
+	defer observe("booking", "GetBookings", time.Now(), &err)
+	return s.next.GetBookings(ctx, filter, pagination)
+}
+
+func (s *bookingStore) GetBooking(ctx context.Context, id string) (_ *types.Booking, err error) {
+	defer observe("booking", "GetBooking", time.Now(), &err)
+	return s.next.GetBooking(ctx, id)
+}
+
+func (s *bookingStore) UpdateBookingById(ctx context.Context, id string, update map[string]any) (err error) {
+	defer observe("booking", "UpdateBookingById", time.Now(), &err)
+	return s.next.UpdateBookingById(ctx, id, update)
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/db"
+	"github.com/swarajroy/hotel-reservation/db/memory"
+	"github.com/swarajroy/hotel-reservation/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// observations returns how many store calls were recorded with the labels.
+func observations(t *testing.T, store, operation, outcome string) uint64 {
+	var m dto.Metric
+	if err := StoreDuration.WithLabelValues(store, operation, outcome).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentStore(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		original = memory.NewHotelReservationStore()
+		store    = InstrumentStore(original)
+		from     = time.Date(2030, time.March, 10, 15, 0, 0, 0, time.UTC)
+		booking  = &types.Booking{
+			UserID:     primitive.NewObjectID(),
+			RoomID:     primitive.NewObjectID(),
+			NumPersons: 1,
+			FromDate:   from,
+			TillDate:   from.AddDate(0, 0, 3),
+		}
+		booked     = observations(t, "booking", "BookRoom", "ok")
+		conflicts  = observations(t, "booking", "BookRoom", "conflict")
+		notFound   = observations(t, "user", "GetUserById", "not_found")
+		hotelsRead = observations(t, "hotel", "GetHotels", "ok")
+	)
+
+	// the stores not timed are passed through
+	assert.Same(t, original.Token, store.Token)
+	assert.Same(t, original.Lockout, store.Lockout)
+	assert.Same(t, original.APIKey, store.APIKey)
+
+	_, err := store.Booking.BookRoom(ctx, booking)
+	assert.Nil(t, err)
+	_, err = store.Booking.BookRoom(ctx, &types.Booking{RoomID: booking.RoomID, FromDate: from, TillDate: from.AddDate(0, 0, 1)})
+	var conflict db.ConflictError
+	assert.True(t, errors.As(err, &conflict))
+
+	_, err = store.User.GetUserById(ctx, primitive.NewObjectID().Hex())
+	assert.True(t, errors.Is(err, mongo.ErrNoDocuments))
+
+	_, err = store.Hotel.GetHotels(ctx, map[string]any{}, &db.Pagination{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, booked+1, observations(t, "booking", "BookRoom", "ok"))
+	assert.Equal(t, conflicts+1, observations(t, "booking", "BookRoom", "conflict"))
+	assert.Equal(t, notFound+1, observations(t, "user", "GetUserById", "not_found"))
+	assert.Equal(t, hotelsRead+1, observations(t, "hotel", "GetHotels", "ok"))
+}
+
+func TestOutcome(t *testing.T) {
+	assert.Equal(t, "ok", outcome(nil))
+	assert.Equal(t, "not_found", outcome(mongo.ErrNoDocuments))
+	assert.Equal(t, "conflict", outcome(db.NewConflictError("room is taken")))
+	assert.Equal(t, "error", outcome(errors.New("connection reset")))
+}
@@ -4,14 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/swarajroy/hotel-reservation/api"
+	"github.com/swarajroy/hotel-reservation/config"
 	"github.com/swarajroy/hotel-reservation/db"
 	"github.com/swarajroy/hotel-reservation/db/fixtures"
 	"github.com/swarajroy/hotel-reservation/types"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -20,32 +21,55 @@ var (
 	hotelStore   db.HotelStore
 	roomStore    db.RoomStore
 	bookingStore db.BookingStore
+	tokenStore   db.TokenStore
+	lockoutStore db.LockoutStore
+	apiKeyStore  db.APIKeyStore
 	store        *db.HotelReservationStore
+	cfg          *config.Config
 	ctx          = context.Background()
 )
 
 func init() {
 	var err error
-	client, err = mongo.Connect(ctx, options.Client().ApplyURI(db.DB_URI))
+	cfg, err = config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err = db.Connect(ctx, cfg.Mongo)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := client.Database(db.DBNAME).Drop(ctx); err != nil {
+	if err := client.Database(cfg.Mongo.Database).Drop(ctx); err != nil {
 		log.Fatal(err)
 	}
-	userStore = db.NewMongoDbUserStore(client, db.DBNAME)
-	hotelStore = db.NewMongoDbHotelStore(client, db.DBNAME)
-	roomStore = db.NewMongoDbRoomStore(client, db.DBNAME, hotelStore)
-	bookingStore = db.NewMongoDbBookingStore(client, db.DBNAME)
-	store = db.NewHotelReservationStore(userStore, hotelStore, roomStore, bookingStore)
+	userStore = db.NewMongoDbUserStore(client, cfg.Mongo)
+	hotelStore = db.NewMongoDbHotelStore(client, cfg.Mongo)
+	roomStore = db.NewMongoDbRoomStore(client, cfg.Mongo, hotelStore)
+	bookingStore = db.NewMongoDbBookingStore(client, cfg.Mongo)
+	tokenStore = db.NewMongoDbTokenStore(client, cfg.Mongo)
+	lockoutStore = db.NewMongoDbLockoutStore(client, cfg.Mongo)
+	apiKeyStore = db.NewMongoDbAPIKeyStore(client, cfg.Mongo)
+	store = db.NewHotelReservationStore(userStore, hotelStore, roomStore, bookingStore, tokenStore, lockoutStore, apiKeyStore)
 }
 
 func main() {
+	signer, err := api.NewTokenSignerFromConfig(cfg.JWT)
+	if err != nil {
+		log.Fatal(err)
+	}
 	user := fixtures.AddUser(store, "James", "Foo", false)
-	fmt.Println("user -> ", api.CreateTokenFromUser(user))
+	userToken, err := api.CreateTokenFromUser(signer, user)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("user -> ", userToken)
 	admin := fixtures.AddUser(store, "Alice", "Mclain", true)
-	fmt.Println("admin -> ", api.CreateTokenFromUser(admin))
+	adminToken, err := api.CreateTokenFromUser(signer, admin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("admin -> ", adminToken)
 
 	hotel := fixtures.AddHotel(store, "Bellucia", "France", nil)
 	fmt.Println(hotel)
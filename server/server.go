@@ -0,0 +1,119 @@
+// Package server runs the API server until it is asked to stop, then lets
+// the requests in flight finish before shutting down.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/swarajroy/hotel-reservation/config"
+)
+
+// Hook runs when the server starts or shuts down, such as starting a
+// background worker or closing a database client.
+type Hook func(ctx context.Context) error
+
+type Server struct {
+	app             *fiber.App
+	addr            string
+	shutdownTimeout time.Duration
+
+	mu         sync.Mutex
+	ln         net.Listener
+	onStart    []Hook
+	onShutdown []Hook
+}
+
+func New(app *fiber.App, cfg config.Server) *Server {
+	return &Server{
+		app:             app,
+		addr:            cfg.ListenAddr,
+		shutdownTimeout: cfg.ShutdownTimeout,
+	}
+}
+
+// OnStart adds a hook that runs after the listen address is bound and before
+// requests are served. An error stops the server from starting.
+func (s *Server) OnStart(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onStart = append(s.onStart, hook)
+}
+
+// OnShutdown adds a hook that runs once requests are drained. Hooks run in
+// the reverse order they were added in.
+func (s *Server) OnShutdown(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onShutdown = append(s.onShutdown, hook)
+}
+
+// Addr returns the address the server listens on, or nil before it started.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Run serves requests until ctx is done or the listener fails. It then waits
+// up to the shutdown timeout for requests in flight and runs the shutdown
+// hooks, which get the same amount of time.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ln = ln
+	onStart := append([]Hook{}, s.onStart...)
+	s.mu.Unlock()
+
+	for _, hook := range onStart {
+		if err := hook(ctx); err != nil {
+			ln.Close()
+			return errors.Join(fmt.Errorf("starting server: %w", err), s.shutdown())
+		}
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.app.Listener(ln)
+	}()
+
+	select {
+	case err := <-served:
+		return errors.Join(err, s.shutdown())
+	case <-ctx.Done():
+	}
+	drainErr := s.app.ShutdownWithTimeout(s.shutdownTimeout)
+	if drainErr != nil {
+		drainErr = fmt.Errorf("draining requests: %w", drainErr)
+	}
+	return errors.Join(drainErr, <-served, s.shutdown())
+}
+
+// shutdown runs the shutdown hooks, all of them even when some fail.
+func (s *Server) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	s.mu.Lock()
+	onShutdown := append([]Hook{}, s.onShutdown...)
+	s.mu.Unlock()
+
+	var errs []error
+	for i := len(onShutdown) - 1; i >= 0; i-- {
+		if err := onShutdown[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/swarajroy/hotel-reservation/config"
+)
+
+func newTestServer() (*Server, chan struct{}) {
+	started := make(chan struct{})
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return c.SendString("booked")
+	})
+	return New(app, config.Server{ListenAddr: "127.0.0.1:0", ShutdownTimeout: 2 * time.Second}), started
+}
+
+func TestRunDrainsRequestsBeforeShutdownHooks(t *testing.T) {
+	var (
+		srv, started = newTestServer()
+		ready        = make(chan struct{})
+		stopped      = make(chan error, 1)
+		hooks        []string
+		ctx, cancel  = context.WithCancel(context.Background())
+	)
+	defer cancel()
+	srv.OnStart(func(ctx context.Context) error {
+		close(ready)
+		return nil
+	})
+	srv.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "disconnect database")
+		return nil
+	})
+	srv.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "stop worker")
+		return nil
+	})
+	go func() {
+		stopped <- srv.Run(ctx)
+	}()
+	<-ready
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://%s/slow", srv.Addr()))
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		responses <- string(body)
+	}()
+	<-started
+	cancel()
+
+	assert.Equal(t, "booked", <-responses)
+	assert.Nil(t, <-stopped)
+	assert.Equal(t, []string{"stop worker", "disconnect database"}, hooks)
+}
+
+func TestRunShutsDownWhenAStartHookFails(t *testing.T) {
+	var (
+		srv, _   = newTestServer()
+		shutdown = false
+	)
+	srv.OnShutdown(func(ctx context.Context) error {
+		shutdown = true
+		return nil
+	})
+	srv.OnStart(func(ctx context.Context) error {
+		return errors.New("worker failed")
+	})
+
+	err := srv.Run(context.Background())
+
+	assert.ErrorContains(t, err, "worker failed")
+	assert.True(t, shutdown)
+}
+
+func TestProbe(t *testing.T) {
+	ready := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+
+	assert.Nil(t, Probe(context.Background(), addr, "/readyz"))
+	ready = false
+	assert.ErrorContains(t, Probe(context.Background(), addr, "/readyz"), "503")
+}
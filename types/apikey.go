@@ -0,0 +1,107 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey is the server side record of a long-lived key of an integration,
+// such as a channel manager or a batch job. Only the hash of the key is kept.
+// The key acts with its scopes instead of the role of a user.
+type APIKey struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name string             `bson:"name" json:"name"`
+	// Prefix is the start of the key, which lets admins tell keys apart
+	Prefix string       `bson:"prefix" json:"prefix"`
+	Hash   string       `bson:"hash" json:"-"`
+	Scopes []Permission `bson:"scopes" json:"scopes"`
+	// HotelIDs limits the scopes to these hotels, none means all hotels.
+	HotelIDs   []primitive.ObjectID `bson:"hotelIds,omitempty" json:"hotelIds,omitempty"`
+	CreatedBy  primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
+	CreatedAt  time.Time            `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time            `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt time.Time            `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	UseCount   int64                `bson:"useCount" json:"useCount"`
+	RevokedAt  time.Time            `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// Can reports whether the key has permission for the hotel. A zero hotelID
+// asks for the permission across all hotels, which only keys that are not
+// limited to hotels have.
+func (k *APIKey) Can(permission Permission, hotelID primitive.ObjectID) bool {
+	granted := false
+	for _, p := range k.Scopes {
+		if p == permission {
+			granted = true
+		}
+	}
+	if !granted {
+		return false
+	}
+	if len(k.HotelIDs) == 0 {
+		return true
+	}
+	for _, id := range k.HotelIDs {
+		if !hotelID.IsZero() && id == hotelID {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal is who a request acts for: a signed in *User or an *APIKey.
+type Principal interface {
+	Can(permission Permission, hotelID primitive.ObjectID) bool
+}
+
+type CreateAPIKeyParams struct {
+	Name     string       `json:"name"`
+	Scopes   []Permission `json:"scopes"`
+	HotelIDs []string     `json:"hotelIds"`
+	// ExpiresAt ends the validity of the key, keys without it don't expire
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Validate checks the params of a key created at now.
+func (params CreateAPIKeyParams) Validate(now time.Time) map[string]string {
+	errors := map[string]string{}
+	if len(params.Name) == 0 {
+		errors["name"] = "name is required"
+	}
+	if len(params.Scopes) == 0 {
+		errors["scopes"] = "a key needs at least one scope"
+	}
+	for _, scope := range params.Scopes {
+		if !ADMIN.Has(scope) {
+			errors["scopes"] = fmt.Sprintf("unknown scope %q", scope)
+		}
+	}
+	for _, id := range params.HotelIDs {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			errors["hotelIds"] = fmt.Sprintf("invalid hotel id %s", id)
+		}
+	}
+	if !params.ExpiresAt.IsZero() && !params.ExpiresAt.After(now) {
+		errors["expiresAt"] = "expiresAt must be in the future"
+	}
+	return errors
+}
+
+// NewAPIKey returns the key of the params created by the admin at now, which
+// must be valid. The prefix and hash of the key are left to the caller.
+func (params CreateAPIKeyParams) NewAPIKey(createdBy primitive.ObjectID, now time.Time) *APIKey {
+	key := &APIKey{
+		Name:      params.Name,
+		Scopes:    params.Scopes,
+		HotelIDs:  UpdateRoleParams{HotelIDs: params.HotelIDs}.ObjectHotelIDs(),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: params.ExpiresAt,
+	}
+	if len(key.HotelIDs) == 0 {
+		key.HotelIDs = nil
+	}
+	return key
+}
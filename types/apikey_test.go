@@ -0,0 +1,51 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAPIKeyCan(t *testing.T) {
+	var (
+		hotel   = primitive.NewObjectID()
+		other   = primitive.NewObjectID()
+		channel = &APIKey{Scopes: []Permission{MANAGE_ROOMS, READ_BOOKINGS}, HotelIDs: []primitive.ObjectID{hotel}}
+		batch   = &APIKey{Scopes: []Permission{READ_BOOKINGS}}
+	)
+
+	assert.True(t, channel.Can(MANAGE_ROOMS, hotel))
+	assert.False(t, channel.Can(MANAGE_ROOMS, other))
+	assert.False(t, channel.Can(READ_BOOKINGS, primitive.NilObjectID))
+	assert.False(t, channel.Can(MANAGE_BOOKINGS, hotel))
+	assert.True(t, batch.Can(READ_BOOKINGS, primitive.NilObjectID))
+	assert.True(t, batch.Can(READ_BOOKINGS, other))
+	assert.False(t, batch.Can(MANAGE_ROOMS, other))
+}
+
+func TestCreateAPIKeyParams(t *testing.T) {
+	var (
+		now    = time.Now()
+		admin  = primitive.NewObjectID()
+		hotel  = primitive.NewObjectID()
+		params = CreateAPIKeyParams{Name: "channel manager", Scopes: []Permission{MANAGE_ROOMS}}
+	)
+	assert.Empty(t, params.Validate(now))
+	assert.Contains(t, CreateAPIKeyParams{Scopes: []Permission{MANAGE_ROOMS}}.Validate(now), "name")
+	assert.Contains(t, CreateAPIKeyParams{Name: "job"}.Validate(now), "scopes")
+	assert.Contains(t, CreateAPIKeyParams{Name: "job", Scopes: []Permission{"rooms:delete"}}.Validate(now), "scopes")
+	assert.Contains(t, CreateAPIKeyParams{Name: "job", Scopes: []Permission{MANAGE_ROOMS}, ExpiresAt: now}.Validate(now), "expiresAt")
+
+	key := params.NewAPIKey(admin, now)
+	assert.Nil(t, key.HotelIDs)
+	assert.True(t, key.ExpiresAt.IsZero())
+
+	params.HotelIDs = []string{hotel.Hex()}
+	params.ExpiresAt = now.Add(time.Hour)
+	key = params.NewAPIKey(admin, now)
+	assert.Equal(t, []primitive.ObjectID{hotel}, key.HotelIDs)
+	assert.Equal(t, admin, key.CreatedBy)
+	assert.Equal(t, now.Add(time.Hour), key.ExpiresAt)
+}
@@ -8,19 +8,31 @@ import (
 )
 
 type Booking struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	UserID      primitive.ObjectID `bson:"userID,omitempty" json:"userID,omitempty"`
-	RoomID      primitive.ObjectID `bson:"roomID,omitempty" json:"roomID,omitempty"`
-	NumPersons  int                `bson:"numPersons" json:"numPersons"`
-	FromDate    time.Time          `bson:"fromDate,omitempty" json:"fromDate,omitempty"`
-	TillDate    time.Time          `bson:"tillDate,omitempty" json:"tillDate,omitempty"`
-	CancelledAt time.Time          `bson:"cancelledAt,omitempty" json:"cancelledAt,omitempty"`
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID             primitive.ObjectID `bson:"userID,omitempty" json:"userID,omitempty"`
+	RoomID             primitive.ObjectID `bson:"roomID,omitempty" json:"roomID,omitempty"`
+	NumPersons         int                `bson:"numPersons" json:"numPersons"`
+	NumAdults          int                `bson:"numAdults,omitempty" json:"numAdults,omitempty"`
+	NumChildren        int                `bson:"numChildren,omitempty" json:"numChildren,omitempty"`
+	FromDate           time.Time          `bson:"fromDate,omitempty" json:"fromDate,omitempty"`
+	TillDate           time.Time          `bson:"tillDate,omitempty" json:"tillDate,omitempty"`
+	CancelledAt        time.Time          `bson:"cancelledAt,omitempty" json:"cancelledAt,omitempty"`
+	CancelledBy        primitive.ObjectID `bson:"cancelledBy,omitempty" json:"cancelledBy,omitempty"`
+	CancellationReason string             `bson:"cancellationReason,omitempty" json:"cancellationReason,omitempty"`
+	CancellationFee    float64            `bson:"cancellationFee,omitempty" json:"cancellationFee,omitempty"`
+	// Price is quoted when the booking is made, so later changes to the
+	// room's price or the hotel's rate plan don't change it.
+	Price *PriceBreakdown `bson:"price,omitempty" json:"price,omitempty"`
 }
 
+// BookRoomParams books a room for NumAdults and NumChildren. Clients that
+// only send NumPersons book for that many adults.
 type BookRoomParams struct {
-	FromDate   time.Time `json:"fromDate"`
-	TillDate   time.Time `json:"tillDate"`
-	NumPersons int       `json:"numPersons"`
+	FromDate    time.Time `json:"fromDate"`
+	TillDate    time.Time `json:"tillDate"`
+	NumPersons  int       `json:"numPersons"`
+	NumAdults   int       `json:"numAdults"`
+	NumChildren int       `json:"numChildren"`
 }
 
 type BookingErrorResponse struct {
@@ -28,10 +40,114 @@ type BookingErrorResponse struct {
 	Msg  string
 }
 
-func (bkp BookRoomParams) Validate() error {
-	now := time.Now()
-	if now.After(bkp.FromDate) || now.After(bkp.TillDate) {
-		return fmt.Errorf("cannot book a room in the past")
+// Occupancy returns the number of adults and children of the booking.
+func (bkp BookRoomParams) Occupancy() (adults, children int) {
+	if bkp.NumAdults == 0 && bkp.NumChildren == 0 {
+		return bkp.NumPersons, 0
 	}
-	return nil
+	return bkp.NumAdults, bkp.NumChildren
+}
+
+// Validate checks the stay and the guests against room.
+func (bkp BookRoomParams) Validate(room *Room) map[string]string {
+	var (
+		errors             = map[string]string{}
+		now                = time.Now()
+		adults, children   = bkp.Occupancy()
+		maxAdults, maxKids = room.Occupancy()
+	)
+	if now.After(bkp.FromDate) {
+		errors["fromDate"] = "cannot book a room in the past"
+	}
+	if now.After(bkp.TillDate) {
+		errors["tillDate"] = "cannot book a room in the past"
+	} else if nights := Nights(bkp.FromDate, bkp.TillDate); nights < 1 {
+		errors["tillDate"] = "tillDate must be at least one night after fromDate"
+	} else if room.MinStay > 0 && nights < room.MinStay {
+		errors["tillDate"] = fmt.Sprintf("the room can only be booked for at least %d nights", room.MinStay)
+	} else if room.MaxStay > 0 && nights > room.MaxStay {
+		errors["tillDate"] = fmt.Sprintf("the room can only be booked for at most %d nights", room.MaxStay)
+	}
+	if adults < 1 {
+		errors["numAdults"] = "at least one adult is required"
+	} else if adults > maxAdults {
+		errors["numAdults"] = fmt.Sprintf("the room sleeps at most %d adults", maxAdults)
+	}
+	if children < 0 {
+		errors["numChildren"] = "numChildren should not be negative"
+	} else if adults+children > maxAdults+maxKids {
+		errors["numChildren"] = fmt.Sprintf("the room sleeps at most %d guests", maxAdults+maxKids)
+	}
+	return errors
+}
+
+// NewBookingFromParams returns the booking of roomID by userID described by
+// params.
+func NewBookingFromParams(params BookRoomParams, userID, roomID primitive.ObjectID) *Booking {
+	adults, children := params.Occupancy()
+	return &Booking{
+		UserID:      userID,
+		RoomID:      roomID,
+		FromDate:    params.FromDate,
+		TillDate:    params.TillDate,
+		NumPersons:  adults + children,
+		NumAdults:   adults,
+		NumChildren: children,
+	}
+}
+
+// Nights returns the number of nights of the stay from..till.
+func Nights(from, till time.Time) int {
+	return int(StayDay(till).Sub(StayDay(from)).Hours() / 24)
+}
+
+// StayDay truncates t to the start of its calendar day in UTC. Rooms are
+// booked by the night, so only the day of check-in and check-out matter and a
+// guest checking out frees the room for a check-in on the same day.
+func StayDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// UpdateBookingParams changes an existing booking. Fields left at their zero
+// value keep the booking's current value.
+type UpdateBookingParams struct {
+	FromDate    time.Time `json:"fromDate"`
+	TillDate    time.Time `json:"tillDate"`
+	NumPersons  int       `json:"numPersons"`
+	NumAdults   int       `json:"numAdults"`
+	NumChildren int       `json:"numChildren"`
+	RoomID      string    `json:"roomID"`
+}
+
+// Apply returns the params for booking the room of booking again with the
+// changes of params applied, together with the room to book.
+func (params UpdateBookingParams) Apply(booking Booking) (BookRoomParams, primitive.ObjectID, error) {
+	stay := BookRoomParams{
+		FromDate:    booking.FromDate,
+		TillDate:    booking.TillDate,
+		NumPersons:  booking.NumPersons,
+		NumAdults:   booking.NumAdults,
+		NumChildren: booking.NumChildren,
+	}
+	if !params.FromDate.IsZero() {
+		stay.FromDate = params.FromDate
+	}
+	if !params.TillDate.IsZero() {
+		stay.TillDate = params.TillDate
+	}
+	if params.NumPersons > 0 || params.NumAdults > 0 || params.NumChildren > 0 {
+		stay.NumPersons = params.NumPersons
+		stay.NumAdults = params.NumAdults
+		stay.NumChildren = params.NumChildren
+	}
+	roomID := booking.RoomID
+	if len(params.RoomID) > 0 {
+		oid, err := primitive.ObjectIDFromHex(params.RoomID)
+		if err != nil {
+			return stay, roomID, fmt.Errorf("invalid roomID %s", params.RoomID)
+		}
+		roomID = oid
+	}
+	return stay, roomID, nil
 }
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookRoomParamsValidate(t *testing.T) {
+	var (
+		from = time.Now().AddDate(0, 0, 10)
+		room = &Room{Type: DOUBLE, MaxAdults: 2, MaxChildren: 1, MinStay: 2, MaxStay: 7}
+	)
+	tests := []struct {
+		name   string
+		params BookRoomParams
+		field  string
+	}{
+		{"fits", BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 3), NumAdults: 2, NumChildren: 1}, ""},
+		{"persons are adults", BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 3), NumPersons: 2}, ""},
+		{"too many adults", BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 3), NumPersons: 3}, "numAdults"},
+		{"too many guests", BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 3), NumAdults: 1, NumChildren: 3}, "numChildren"},
+		{"no adult", BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 3), NumChildren: 1}, "numAdults"},
+		{"too short", BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 1), NumAdults: 1}, "tillDate"},
+		{"too long", BookRoomParams{FromDate: from, TillDate: from.AddDate(0, 0, 8), NumAdults: 1}, "tillDate"},
+		{"in the past", BookRoomParams{FromDate: from.AddDate(0, 0, -20), TillDate: from.AddDate(0, 0, 3), NumAdults: 1}, "fromDate"},
+	}
+	for _, tt := range tests {
+		errors := tt.params.Validate(room)
+		if tt.field == "" {
+			assert.Empty(t, errors, tt.name)
+		} else {
+			assert.Contains(t, errors, tt.field, tt.name)
+		}
+	}
+}
+
+func TestRoomOccupancyDefaultsToType(t *testing.T) {
+	adults, children := (&Room{Type: DELUXE}).Occupancy()
+
+	assert.Equal(t, 4, adults)
+	assert.Equal(t, 0, children)
+}
@@ -0,0 +1,62 @@
+package types
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CancellationPolicy decides whether a guest may cancel their own booking and
+// what it costs them. Cancelling is free until FreeUntil before the check-in;
+// after that it costs LateFee (a fraction of the stay price) when AllowLate
+// is set and is refused otherwise.
+type CancellationPolicy struct {
+	FreeUntil time.Duration
+	LateFee   float64
+	AllowLate bool
+}
+
+func DefaultCancellationPolicy() CancellationPolicy {
+	return CancellationPolicy{
+		FreeUntil: 48 * time.Hour,
+		LateFee:   0.5,
+		AllowLate: true,
+	}
+}
+
+// Fee returns the fee for cancelling booking at now, given the price of the
+// whole stay, or an error when the policy does not allow the cancellation.
+func (p CancellationPolicy) Fee(booking *Booking, stayPrice float64, now time.Time) (float64, error) {
+	if !booking.CancelledAt.IsZero() {
+		return 0, fmt.Errorf("booking is already cancelled")
+	}
+	if !now.Before(booking.FromDate) {
+		return 0, fmt.Errorf("booking has already started")
+	}
+	if !p.Late(booking, now) {
+		return 0, nil
+	}
+	if !p.AllowLate {
+		return 0, fmt.Errorf("bookings can only be cancelled until %s before check-in", p.FreeUntil)
+	}
+	return stayPrice * p.LateFee, nil
+}
+
+// Late reports whether now is past the free cancellation of booking. Guests
+// can't then change the stay in ways that would lower the fee.
+func (p CancellationPolicy) Late(booking *Booking, now time.Time) bool {
+	return !now.Before(booking.FromDate.Add(-p.FreeUntil))
+}
+
+// Cancellation records who cancelled a booking, when, why and at which fee.
+type Cancellation struct {
+	At     time.Time
+	By     primitive.ObjectID
+	Reason string
+	Fee    float64
+}
+
+type CancelBookingParams struct {
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,36 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancellationPolicyFee(t *testing.T) {
+	var (
+		now     = time.Date(2030, time.March, 1, 12, 0, 0, 0, time.UTC)
+		policy  = CancellationPolicy{FreeUntil: 48 * time.Hour, LateFee: 0.5, AllowLate: true}
+		booking = func(from time.Time) *Booking {
+			return &Booking{FromDate: from, TillDate: from.AddDate(0, 0, 2)}
+		}
+	)
+
+	fee, err := policy.Fee(booking(now.Add(72*time.Hour)), 200, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, fee)
+
+	fee, err = policy.Fee(booking(now.Add(24*time.Hour)), 200, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 100.0, fee)
+
+	assert.False(t, policy.Late(booking(now.Add(72*time.Hour)), now))
+	assert.True(t, policy.Late(booking(now.Add(24*time.Hour)), now))
+
+	_, err = policy.Fee(booking(now.Add(-time.Hour)), 200, now)
+	assert.NotNil(t, err)
+
+	policy.AllowLate = false
+	_, err = policy.Fee(booking(now.Add(24*time.Hour)), 200, now)
+	assert.NotNil(t, err)
+}
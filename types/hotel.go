@@ -1,6 +1,11 @@
 package types
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Hotel struct {
 	ID       primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
@@ -8,6 +13,17 @@ type Hotel struct {
 	Location string               `bson:"location" json:"location"`
 	Rating   int                  `bson:"rating" json:"rating"`
 	Rooms    []primitive.ObjectID `bson:"rooms" json:"rooms"`
+	RatePlan *RatePlan            `bson:"ratePlan,omitempty" json:"ratePlan,omitempty"`
+}
+
+// Quote prices a stay in room with the hotel's rate plan. Hotels without a
+// rate plan charge the room's Price for every night.
+func (h *Hotel) Quote(room *Room, from, till time.Time, guests int) *PriceBreakdown {
+	var plan RatePlan
+	if h.RatePlan != nil {
+		plan = *h.RatePlan
+	}
+	return plan.Quote(room, from, till, guests)
 }
 
 type RoomType int
@@ -19,10 +35,199 @@ const (
 	DELUXE
 )
 
+// Capacity is the number of guests a room of this type sleeps. It is the
+// default number of adults of a room that does not set MaxAdults.
+func (t RoomType) Capacity() int {
+	switch t {
+	case SINGLE:
+		return 1
+	case DOUBLE:
+		return 2
+	case DELUXE:
+		return 4
+	}
+	return 0
+}
+
+// RoomTypesFor returns the room types that can sleep the given number of
+// guests. It is never nil, so it can be used as the array of an $in filter.
+func RoomTypesFor(guests int) []RoomType {
+	res := []RoomType{}
+	for _, t := range []RoomType{SINGLE, DOUBLE, DELUXE} {
+		if t.Capacity() >= guests {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+type BedType string
+
+const (
+	SINGLE_BED BedType = "single"
+	DOUBLE_BED BedType = "double"
+	KING_BED   BedType = "king"
+	SOFA_BED   BedType = "sofa"
+)
+
+func (t BedType) valid() bool {
+	switch t {
+	case SINGLE_BED, DOUBLE_BED, KING_BED, SOFA_BED:
+		return true
+	}
+	return false
+}
+
+type Bed struct {
+	Type  BedType `bson:"type" json:"type"`
+	Count int     `bson:"count" json:"count"`
+}
+
 type Room struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Type      RoomType           `bson:"type" json:"type"`
-	BasePrice float64            `bson:"basePrice" json:"basePrice"`
-	Price     float64            `bson:"price" json:"price"`
-	HotelID   primitive.ObjectID `bson:"hotelId" json:"hotelId"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Type        RoomType           `bson:"type" json:"type"`
+	BasePrice   float64            `bson:"basePrice" json:"basePrice"`
+	Price       float64            `bson:"price" json:"price"`
+	HotelID     primitive.ObjectID `bson:"hotelId" json:"hotelId"`
+	MaxAdults   int                `bson:"maxAdults,omitempty" json:"maxAdults,omitempty"`
+	MaxChildren int                `bson:"maxChildren,omitempty" json:"maxChildren,omitempty"`
+	Beds        []Bed              `bson:"beds,omitempty" json:"beds,omitempty"`
+	// MinStay and MaxStay bound the number of nights of a booking, 0 means no
+	// bound.
+	MinStay int `bson:"minStay,omitempty" json:"minStay,omitempty"`
+	MaxStay int `bson:"maxStay,omitempty" json:"maxStay,omitempty"`
+}
+
+// Occupancy returns the number of adults and children the room sleeps.
+// Children may also take the place of an adult.
+func (r *Room) Occupancy() (adults, children int) {
+	adults = r.MaxAdults
+	if adults == 0 {
+		adults = r.Type.Capacity()
+	}
+	return adults, r.MaxChildren
+}
+
+const (
+	minLenHotelName = 2
+	minRating       = 1
+	maxRating       = 5
+)
+
+type HotelParams struct {
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Rating   int    `json:"rating"`
+}
+
+func (params HotelParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(params.Name) < minLenHotelName {
+		errors["name"] = fmt.Sprintf("name should be atleast %d characters", minLenHotelName)
+	}
+	if len(params.Location) == 0 {
+		errors["location"] = "location is required"
+	}
+	if params.Rating < minRating || params.Rating > maxRating {
+		errors["rating"] = fmt.Sprintf("rating should be between %d and %d", minRating, maxRating)
+	}
+	return errors
+}
+
+func NewHotelFromParams(params HotelParams) *Hotel {
+	return &Hotel{
+		Name:     params.Name,
+		Location: params.Location,
+		Rating:   params.Rating,
+		Rooms:    []primitive.ObjectID{},
+	}
+}
+
+// ToUpdate returns the fields of a hotel document the params replace.
+func (params HotelParams) ToUpdate() map[string]any {
+	return map[string]any{
+		"name":     params.Name,
+		"location": params.Location,
+		"rating":   params.Rating,
+	}
+}
+
+type RoomParams struct {
+	Type        RoomType `json:"type"`
+	BasePrice   float64  `json:"basePrice"`
+	Price       float64  `json:"price"`
+	MaxAdults   int      `json:"maxAdults"`
+	MaxChildren int      `json:"maxChildren"`
+	Beds        []Bed    `json:"beds"`
+	MinStay     int      `json:"minStay"`
+	MaxStay     int      `json:"maxStay"`
+}
+
+func (params RoomParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if params.Type.Capacity() == 0 {
+		errors["type"] = fmt.Sprintf("type %d is not a known room type", params.Type)
+	}
+	if params.BasePrice <= 0 {
+		errors["basePrice"] = "basePrice should be greater than 0"
+	}
+	if params.Price <= 0 {
+		errors["price"] = "price should be greater than 0"
+	}
+	if params.MaxAdults < 0 {
+		errors["maxAdults"] = "maxAdults should not be negative"
+	}
+	if params.MaxChildren < 0 {
+		errors["maxChildren"] = "maxChildren should not be negative"
+	}
+	for _, bed := range params.Beds {
+		if !bed.Type.valid() {
+			errors["beds"] = fmt.Sprintf("bed type %q is not a known bed type", bed.Type)
+		} else if bed.Count <= 0 {
+			errors["beds"] = "bed count should be greater than 0"
+		}
+	}
+	if params.MinStay < 0 {
+		errors["minStay"] = "minStay should not be negative"
+	}
+	if params.MaxStay < 0 {
+		errors["maxStay"] = "maxStay should not be negative"
+	}
+	if params.MaxStay > 0 && params.MaxStay < params.MinStay {
+		errors["maxStay"] = "maxStay should not be less than minStay"
+	}
+	return errors
+}
+
+func NewRoomFromParams(params RoomParams, hotelID primitive.ObjectID) *Room {
+	maxAdults := params.MaxAdults
+	if maxAdults == 0 {
+		maxAdults = params.Type.Capacity()
+	}
+	return &Room{
+		Type:        params.Type,
+		BasePrice:   params.BasePrice,
+		Price:       params.Price,
+		HotelID:     hotelID,
+		MaxAdults:   maxAdults,
+		MaxChildren: params.MaxChildren,
+		Beds:        params.Beds,
+		MinStay:     params.MinStay,
+		MaxStay:     params.MaxStay,
+	}
+}
+
+// ToUpdate returns the fields of a room document the params replace.
+func (params RoomParams) ToUpdate() map[string]any {
+	room := NewRoomFromParams(params, primitive.NilObjectID)
+	return map[string]any{
+		"type":        room.Type,
+		"basePrice":   room.BasePrice,
+		"price":       room.Price,
+		"maxAdults":   room.MaxAdults,
+		"maxChildren": room.MaxChildren,
+		"beds":        room.Beds,
+		"minStay":     room.MinStay,
+		"maxStay":     room.MaxStay,
+	}
 }
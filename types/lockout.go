@@ -0,0 +1,106 @@
+package types
+
+import (
+	"time"
+)
+
+// LoginAttempts counts the failed logins for an email or a client IP. The
+// failures are forgotten once there has been none for the window of the
+// policy.
+type LoginAttempts struct {
+	Key         string    `bson:"_id" json:"key"`
+	Failures    int       `bson:"failures" json:"failures"`
+	LastFailure time.Time `bson:"lastFailure" json:"lastFailure"`
+	LockedUntil time.Time `bson:"lockedUntil,omitempty" json:"lockedUntil,omitempty"`
+	ExpiresAt   time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// LockoutPolicy locks logins out after FreeAttempts failures. The lockout
+// starts at BaseLockout and doubles with every further failure up to
+// MaxLockout.
+type LockoutPolicy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	Window       time.Duration
+}
+
+// DefaultEmailLockoutPolicy is the policy for the failed logins of one
+// account.
+func DefaultEmailLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		FreeAttempts: 5,
+		BaseLockout:  30 * time.Second,
+		MaxLockout:   time.Hour,
+		Window:       24 * time.Hour,
+	}
+}
+
+// DefaultIPLockoutPolicy is the policy for the failed logins of one client
+// IP. It allows more failures, as many users may share an IP.
+func DefaultIPLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		FreeAttempts: 20,
+		BaseLockout:  30 * time.Second,
+		MaxLockout:   time.Hour,
+		Window:       24 * time.Hour,
+	}
+}
+
+// DefaultResetMailPolicy limits the password reset mails asked for one
+// email, which are counted whether or not it is registered, so that nobody
+// can be flooded with them.
+func DefaultResetMailPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		FreeAttempts: 3,
+		BaseLockout:  15 * time.Minute,
+		MaxLockout:   time.Hour,
+		Window:       time.Hour,
+	}
+}
+
+// DefaultResetMailIPPolicy limits the password reset mails asked for from
+// one client IP.
+func DefaultResetMailIPPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		FreeAttempts: 10,
+		BaseLockout:  15 * time.Minute,
+		MaxLockout:   time.Hour,
+		Window:       time.Hour,
+	}
+}
+
+// LockedUntil returns until when logins are locked out after failures, the
+// last of which was at last. It is zero while there are free attempts left.
+func (p LockoutPolicy) LockedUntil(failures int, last time.Time) time.Time {
+	if failures <= p.FreeAttempts {
+		return time.Time{}
+	}
+	// doubling stops at MaxLockout, before the shift could overflow
+	lockout := p.BaseLockout
+	for doublings := failures - p.FreeAttempts - 1; doublings > 0 && lockout < p.MaxLockout; doublings-- {
+		lockout <<= 1
+	}
+	return last.Add(min(lockout, p.MaxLockout))
+}
+
+func EmailLockoutKey(email string) string {
+	return "email:" + NormalizeEmail(email)
+}
+
+// TOTPLockoutKey counts the wrong second factor codes of a user apart from
+// the failed passwords, so that signing in with the password again doesn't
+// clear them.
+func TOTPLockoutKey(userID string) string {
+	return "totp:" + userID
+}
+
+func IPLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+// ResetMailKeys are the keys the password reset mails asked for email from
+// ip are counted under, apart from failed logins.
+func ResetMailKeys(email, ip string) (emailKey, ipKey string) {
+	return "reset:" + EmailLockoutKey(email), "reset:" + IPLockoutKey(ip)
+}
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutPolicyBacksOff(t *testing.T) {
+	var (
+		policy = DefaultEmailLockoutPolicy()
+		last   = time.Now()
+	)
+
+	assert.True(t, policy.LockedUntil(policy.FreeAttempts, last).IsZero())
+	assert.Equal(t, last.Add(30*time.Second), policy.LockedUntil(policy.FreeAttempts+1, last))
+	assert.Equal(t, last.Add(time.Minute), policy.LockedUntil(policy.FreeAttempts+2, last))
+	assert.Equal(t, last.Add(2*time.Minute), policy.LockedUntil(policy.FreeAttempts+3, last))
+	assert.Equal(t, last.Add(time.Hour), policy.LockedUntil(policy.FreeAttempts+10, last))
+	assert.Equal(t, last.Add(time.Hour), policy.LockedUntil(policy.FreeAttempts+100, last))
+}
+
+func TestLockoutPolicyNeverOverflows(t *testing.T) {
+	last := time.Now()
+	tests := []struct {
+		name   string
+		policy LockoutPolicy
+	}{
+		{"email", DefaultEmailLockoutPolicy()},
+		{"ip", DefaultIPLockoutPolicy()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for failures := 30; failures <= 70; failures++ {
+				assert.Equal(t, last.Add(time.Hour), tt.policy.LockedUntil(failures, last), "failures %d", failures)
+			}
+		})
+	}
+}
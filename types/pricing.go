@@ -0,0 +1,124 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Season changes the price of the nights from FromDate up to but not
+// including TillDate by Multiplier.
+type Season struct {
+	Name       string    `bson:"name" json:"name"`
+	FromDate   time.Time `bson:"fromDate" json:"fromDate"`
+	TillDate   time.Time `bson:"tillDate" json:"tillDate"`
+	Multiplier float64   `bson:"multiplier" json:"multiplier"`
+}
+
+func (s Season) contains(night time.Time) bool {
+	return !night.Before(StayDay(s.FromDate)) && night.Before(StayDay(s.TillDate))
+}
+
+// StayDiscount takes Discount (a fraction) off stays of at least MinNights.
+type StayDiscount struct {
+	MinNights int     `bson:"minNights" json:"minNights"`
+	Discount  float64 `bson:"discount" json:"discount"`
+}
+
+// RatePlan prices the nights of a stay in the rooms of a hotel starting from
+// the room's Price:
+//   - the last season containing a night multiplies its price,
+//   - Friday and Saturday nights cost WeekendUplift (a fraction) more,
+//   - every guest beyond IncludedGuests adds GuestSurcharge per night,
+//   - the largest applicable StayDiscount is taken off the whole stay.
+type RatePlan struct {
+	Seasons        []Season       `bson:"seasons,omitempty" json:"seasons"`
+	WeekendUplift  float64        `bson:"weekendUplift" json:"weekendUplift"`
+	StayDiscounts  []StayDiscount `bson:"stayDiscounts,omitempty" json:"stayDiscounts"`
+	IncludedGuests int            `bson:"includedGuests" json:"includedGuests"`
+	GuestSurcharge float64        `bson:"guestSurcharge" json:"guestSurcharge"`
+}
+
+func (p RatePlan) Validate() map[string]string {
+	errors := map[string]string{}
+	for i, season := range p.Seasons {
+		if !StayDay(season.TillDate).After(StayDay(season.FromDate)) {
+			errors[fmt.Sprintf("seasons[%d].tillDate", i)] = "tillDate should be after fromDate"
+		}
+		if season.Multiplier <= 0 {
+			errors[fmt.Sprintf("seasons[%d].multiplier", i)] = "multiplier should be greater than 0"
+		}
+	}
+	if p.WeekendUplift < 0 {
+		errors["weekendUplift"] = "weekendUplift should not be negative"
+	}
+	for i, discount := range p.StayDiscounts {
+		if discount.MinNights < 1 {
+			errors[fmt.Sprintf("stayDiscounts[%d].minNights", i)] = "minNights should be at least 1"
+		}
+		if discount.Discount <= 0 || discount.Discount >= 1 {
+			errors[fmt.Sprintf("stayDiscounts[%d].discount", i)] = "discount should be between 0 and 1"
+		}
+	}
+	if p.IncludedGuests < 0 {
+		errors["includedGuests"] = "includedGuests should not be negative"
+	}
+	if p.GuestSurcharge < 0 {
+		errors["guestSurcharge"] = "guestSurcharge should not be negative"
+	}
+	return errors
+}
+
+type NightlyRate struct {
+	Date  time.Time `bson:"date" json:"date"`
+	Price float64   `bson:"price" json:"price"`
+}
+
+// PriceBreakdown is the price of a stay as quoted when it was booked.
+type PriceBreakdown struct {
+	Nights   []NightlyRate `bson:"nights" json:"nights"`
+	Subtotal float64       `bson:"subtotal" json:"subtotal"`
+	Discount float64       `bson:"discount" json:"discount"`
+	Total    float64       `bson:"total" json:"total"`
+}
+
+// Quote prices the stay from..till of guests in room.
+func (p RatePlan) Quote(room *Room, from, till time.Time, guests int) *PriceBreakdown {
+	var (
+		quote  = &PriceBreakdown{Nights: []NightlyRate{}}
+		extra  = 0
+		nights = Nights(from, till)
+	)
+	if p.IncludedGuests > 0 && guests > p.IncludedGuests {
+		extra = guests - p.IncludedGuests
+	}
+	for night := StayDay(from); night.Before(StayDay(till)); night = night.AddDate(0, 0, 1) {
+		price := room.Price
+		for _, season := range p.Seasons {
+			if season.contains(night) {
+				price = room.Price * season.Multiplier
+			}
+		}
+		if night.Weekday() == time.Friday || night.Weekday() == time.Saturday {
+			price += price * p.WeekendUplift
+		}
+		price += float64(extra) * p.GuestSurcharge
+		price = roundPrice(price)
+		quote.Nights = append(quote.Nights, NightlyRate{Date: night, Price: price})
+		quote.Subtotal += price
+	}
+	var discount float64
+	for _, d := range p.StayDiscounts {
+		if nights >= d.MinNights && d.Discount > discount {
+			discount = d.Discount
+		}
+	}
+	quote.Subtotal = roundPrice(quote.Subtotal)
+	quote.Discount = roundPrice(quote.Subtotal * discount)
+	quote.Total = roundPrice(quote.Subtotal - quote.Discount)
+	return quote
+}
+
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
@@ -0,0 +1,63 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRatePlanQuote(t *testing.T) {
+	var (
+		room = &Room{Price: 100}
+		// Thursday 7th till Monday 11th of March 2030
+		from = time.Date(2030, time.March, 7, 15, 0, 0, 0, time.UTC)
+		till = time.Date(2030, time.March, 11, 11, 0, 0, 0, time.UTC)
+		plan = RatePlan{
+			Seasons: []Season{{
+				Name:       "spring",
+				FromDate:   time.Date(2030, time.March, 10, 0, 0, 0, 0, time.UTC),
+				TillDate:   time.Date(2030, time.June, 1, 0, 0, 0, 0, time.UTC),
+				Multiplier: 1.5,
+			}},
+			WeekendUplift:  0.2,
+			StayDiscounts:  []StayDiscount{{MinNights: 3, Discount: 0.1}, {MinNights: 7, Discount: 0.2}},
+			IncludedGuests: 2,
+			GuestSurcharge: 10,
+		}
+	)
+
+	quote := plan.Quote(room, from, till, 3)
+
+	assert.Len(t, quote.Nights, 4)
+	// Thursday, Friday and Saturday with the weekend uplift, Sunday in season
+	assert.Equal(t, []float64{110, 130, 130, 160}, []float64{
+		quote.Nights[0].Price, quote.Nights[1].Price, quote.Nights[2].Price, quote.Nights[3].Price,
+	})
+	assert.Equal(t, 530.0, quote.Subtotal)
+	assert.Equal(t, 53.0, quote.Discount)
+	assert.Equal(t, 477.0, quote.Total)
+}
+
+func TestQuoteWithoutRatePlan(t *testing.T) {
+	var (
+		hotel = &Hotel{}
+		from  = time.Date(2030, time.March, 7, 15, 0, 0, 0, time.UTC)
+	)
+
+	quote := hotel.Quote(&Room{Price: 99.99}, from, from.AddDate(0, 0, 2), 1)
+
+	assert.Equal(t, 199.98, quote.Total)
+}
+
+func TestRatePlanValidate(t *testing.T) {
+	errors := RatePlan{
+		Seasons:       []Season{{Multiplier: 0}},
+		StayDiscounts: []StayDiscount{{MinNights: 0, Discount: 1.5}},
+	}.Validate()
+
+	assert.Contains(t, errors, "seasons[0].tillDate")
+	assert.Contains(t, errors, "seasons[0].multiplier")
+	assert.Contains(t, errors, "stayDiscounts[0].minNights")
+	assert.Contains(t, errors, "stayDiscounts[0].discount")
+}
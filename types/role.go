@@ -0,0 +1,147 @@
+package types
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Role string
+
+const (
+	GUEST   Role = "guest"
+	STAFF   Role = "staff"
+	MANAGER Role = "manager"
+	ADMIN   Role = "admin"
+)
+
+type Permission string
+
+const (
+	// READ_BOOKINGS lets front-desk staff see the bookings of a hotel
+	READ_BOOKINGS Permission = "bookings:read"
+	// MANAGE_BOOKINGS lets staff change and cancel any booking of a hotel
+	MANAGE_BOOKINGS Permission = "bookings:manage"
+	// MANAGE_ROOMS lets staff change the rooms and rates of a hotel
+	MANAGE_ROOMS Permission = "rooms:manage"
+	// MANAGE_HOTELS lets staff create and delete hotels
+	MANAGE_HOTELS Permission = "hotels:manage"
+	// MANAGE_USERS lets staff list users and assign their roles
+	MANAGE_USERS Permission = "users:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	GUEST:   {},
+	STAFF:   {READ_BOOKINGS},
+	MANAGER: {READ_BOOKINGS, MANAGE_BOOKINGS, MANAGE_ROOMS},
+	ADMIN:   {READ_BOOKINGS, MANAGE_BOOKINGS, MANAGE_ROOMS, MANAGE_HOTELS, MANAGE_USERS},
+}
+
+// Scoped reports whether the role only applies to the hotels of the user.
+func (r Role) Scoped() bool {
+	return r == STAFF || r == MANAGER
+}
+
+func (r Role) Has(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveRole returns the role of the user. Users stored before roles
+// existed are admins when IsAdmin is set and guests otherwise.
+func (u *User) EffectiveRole() Role {
+	if len(u.Role) > 0 {
+		return u.Role
+	}
+	if u.IsAdmin {
+		return ADMIN
+	}
+	return GUEST
+}
+
+// Can reports whether the user has permission for the hotel. A zero hotelID
+// asks for the permission across all hotels, which only unscoped roles have.
+func (u *User) Can(permission Permission, hotelID primitive.ObjectID) bool {
+	role := u.EffectiveRole()
+	if !role.Has(permission) {
+		return false
+	}
+	if !role.Scoped() {
+		return true
+	}
+	for _, id := range u.HotelIDs {
+		if !hotelID.IsZero() && id == hotelID {
+			return true
+		}
+	}
+	return false
+}
+
+type UpdateRoleParams struct {
+	Role     Role     `json:"role"`
+	HotelIDs []string `json:"hotelIds"`
+}
+
+func (params UpdateRoleParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if _, ok := rolePermissions[params.Role]; !ok {
+		errors["role"] = fmt.Sprintf("role %q is not one of %s, %s, %s or %s", params.Role, GUEST, STAFF, MANAGER, ADMIN)
+	} else if params.Role.Scoped() && len(params.HotelIDs) == 0 {
+		errors["hotelIds"] = fmt.Sprintf("a %s needs at least one hotel", params.Role)
+	} else if !params.Role.Scoped() && len(params.HotelIDs) > 0 {
+		errors["hotelIds"] = fmt.Sprintf("a %s is not scoped to hotels", params.Role)
+	}
+	for _, id := range params.HotelIDs {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			errors["hotelIds"] = fmt.Sprintf("invalid hotel id %s", id)
+		}
+	}
+	return errors
+}
+
+// ObjectHotelIDs returns the hotel ids of the params, which must be valid.
+func (params UpdateRoleParams) ObjectHotelIDs() []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	for _, id := range params.HotelIDs {
+		oid, _ := primitive.ObjectIDFromHex(id)
+		ids = append(ids, oid)
+	}
+	return ids
+}
+
+// CreateUserWithRoleParams are the params of users created by an admin, who
+// can give them a role right away. Without a role the user is a guest.
+type CreateUserWithRoleParams struct {
+	CreateUserParams
+	Role     Role     `json:"role"`
+	HotelIDs []string `json:"hotelIds"`
+}
+
+func (params CreateUserWithRoleParams) Validate() map[string]string {
+	errors := params.CreateUserParams.Validate()
+	if len(params.Role) == 0 && len(params.HotelIDs) == 0 {
+		return errors
+	}
+	for field, err := range (UpdateRoleParams{Role: params.Role, HotelIDs: params.HotelIDs}).Validate() {
+		errors[field] = err
+	}
+	return errors
+}
+
+// NewUser returns the user of the params, which must be valid.
+func (params CreateUserWithRoleParams) NewUser() (*User, error) {
+	user, err := NewUserFromParams(params.CreateUserParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Role) > 0 {
+		user.Role = params.Role
+		user.IsAdmin = params.Role == ADMIN
+		user.HotelIDs = UpdateRoleParams{Role: params.Role, HotelIDs: params.HotelIDs}.ObjectHotelIDs()
+	}
+	return user, nil
+}
@@ -0,0 +1,55 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserCan(t *testing.T) {
+	var (
+		hotel   = primitive.NewObjectID()
+		other   = primitive.NewObjectID()
+		staff   = &User{Role: STAFF, HotelIDs: []primitive.ObjectID{hotel}}
+		manager = &User{Role: MANAGER, HotelIDs: []primitive.ObjectID{hotel}}
+		admin   = &User{IsAdmin: true}
+		guest   = &User{}
+	)
+
+	assert.True(t, staff.Can(READ_BOOKINGS, hotel))
+	assert.False(t, staff.Can(READ_BOOKINGS, other))
+	assert.False(t, staff.Can(READ_BOOKINGS, primitive.NilObjectID))
+	assert.False(t, staff.Can(MANAGE_BOOKINGS, hotel))
+	assert.True(t, manager.Can(MANAGE_ROOMS, hotel))
+	assert.False(t, manager.Can(MANAGE_HOTELS, hotel))
+	assert.True(t, admin.Can(MANAGE_USERS, primitive.NilObjectID))
+	assert.True(t, admin.Can(READ_BOOKINGS, other))
+	assert.False(t, guest.Can(READ_BOOKINGS, hotel))
+}
+
+func TestUpdateRoleParamsValidate(t *testing.T) {
+	assert.Contains(t, UpdateRoleParams{Role: "owner"}.Validate(), "role")
+	assert.Contains(t, UpdateRoleParams{Role: STAFF}.Validate(), "hotelIds")
+	assert.Contains(t, UpdateRoleParams{Role: ADMIN, HotelIDs: []string{primitive.NewObjectID().Hex()}}.Validate(), "hotelIds")
+	assert.Contains(t, UpdateRoleParams{Role: MANAGER, HotelIDs: []string{"nope"}}.Validate(), "hotelIds")
+	assert.Empty(t, UpdateRoleParams{Role: MANAGER, HotelIDs: []string{primitive.NewObjectID().Hex()}}.Validate())
+}
+
+func TestCreateUserWithRoleParams(t *testing.T) {
+	hotel := primitive.NewObjectID()
+	params := CreateUserWithRoleParams{
+		CreateUserParams: CreateUserParams{FirstName: "james", LastName: "foo", Email: "james@foo.com", Password: "supersecret"},
+	}
+	assert.Empty(t, params.Validate())
+
+	params.Role = MANAGER
+	assert.Contains(t, params.Validate(), "hotelIds")
+
+	params.HotelIDs = []string{hotel.Hex()}
+	assert.Empty(t, params.Validate())
+	user, err := params.NewUser()
+	assert.Nil(t, err)
+	assert.True(t, user.Can(MANAGE_ROOMS, hotel))
+	assert.False(t, user.IsAdmin)
+}
@@ -0,0 +1,49 @@
+package types
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is the server side record of a refresh token. Only the hash
+// of the token is kept. Every refresh replaces the token with a new one of the
+// same session; presenting a replaced token again revokes the whole session.
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Hash      string             `bson:"hash" json:"-"`
+	UserID    primitive.ObjectID `bson:"userID" json:"userID"`
+	SessionID string             `bson:"sessionID" json:"sessionID"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RotatedAt time.Time          `bson:"rotatedAt,omitempty" json:"rotatedAt,omitempty"`
+	RevokedAt time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	// MFA is set for sessions that were started with a second factor.
+	MFA bool `bson:"mfa,omitempty" json:"mfa,omitempty"`
+}
+
+type TokenPurpose string
+
+const (
+	VERIFY_EMAIL   TokenPurpose = "verify-email"
+	RESET_PASSWORD TokenPurpose = "reset-password"
+	// TOTP_CHALLENGE is handed out when the password of a user with a
+	// second factor was right and is exchanged for a session with the code.
+	TOTP_CHALLENGE TokenPurpose = "totp-challenge"
+)
+
+// OneTimeToken is the server side record of a token mailed to a user to
+// verify their email or reset their password. Only the hash of the token is
+// kept and it can be used once before it expires.
+type OneTimeToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Hash      string             `bson:"hash" json:"-"`
+	UserID    primitive.ObjectID `bson:"userID" json:"userID"`
+	Purpose   TokenPurpose       `bson:"purpose" json:"purpose"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	UsedAt    time.Time          `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+	// Email is the address the token was mailed to. A VERIFY_EMAIL token
+	// only verifies the email of the user while it is still this address.
+	Email string `bson:"email,omitempty" json:"email,omitempty"`
+}
@@ -0,0 +1,141 @@
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	TOTP_DIGITS          = 6
+	TOTP_PERIOD          = 30 * time.Second
+	RECOVERY_CODES       = 10
+	totpSecretBytes      = 20
+	recoveryCodeBytes    = 5
+	totpAllowedSkewSteps = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP is the time-based one-time password (RFC 6238) second factor of a
+// user. It is only asked for once enabled, which needs a first valid code.
+// Only the hashes of the recovery codes are kept and each works once.
+type TOTP struct {
+	Secret        string   `bson:"secret"`
+	Enabled       bool     `bson:"enabled"`
+	RecoveryCodes []string `bson:"recoveryCodes"`
+	// LastStep is the time step of the last code used, codes of that step
+	// or earlier are refused so a code can't be replayed.
+	LastStep int64 `bson:"lastStep"`
+}
+
+// TOTPEnabled reports whether the user signs in with a second factor.
+func (u *User) TOTPEnabled() bool {
+	return u.TOTP != nil && u.TOTP.Enabled
+}
+
+// NewTOTP returns a TOTP with a random secret along with its recovery codes.
+func NewTOTP() (*TOTP, []string, error) {
+	secret := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	totp := &TOTP{Secret: totpEncoding.EncodeToString(secret)}
+	codes := make([]string, RECOVERY_CODES)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(hex.EncodeToString(b))
+		codes[i] = code
+		totp.RecoveryCodes = append(totp.RecoveryCodes, HashRecoveryCode(code))
+	}
+	return totp, codes, nil
+}
+
+// URI returns the otpauth URI authenticator apps enrol the secret with.
+func (t *TOTP) URI(issuer, account string) string {
+	v := url.Values{}
+	v.Set("secret", t.Secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(TOTP_DIGITS))
+	v.Set("period", fmt.Sprint(int(TOTP_PERIOD.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Code returns the code of the time step of now.
+func (t *TOTP) Code(now time.Time) (string, error) {
+	return t.codeAt(totpStep(now))
+}
+
+// Verify returns the time step of code when it is valid at now, allowing
+// for the clock of the device to be a step off. Steps up to LastStep are
+// refused.
+func (t *TOTP) Verify(code string, now time.Time) (int64, bool) {
+	if len(code) != TOTP_DIGITS {
+		return 0, false
+	}
+	step := totpStep(now)
+	for s := step - totpAllowedSkewSteps; s <= step+totpAllowedSkewSteps; s++ {
+		if s <= t.LastStep {
+			continue
+		}
+		expected, err := t.codeAt(s)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func (t *TOTP) codeAt(step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(t.Secret))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTP_DIGITS, value%uint32(math.Pow10(TOTP_DIGITS))), nil
+}
+
+func totpStep(now time.Time) int64 {
+	return now.Unix() / int64(TOTP_PERIOD.Seconds())
+}
+
+// HashRecoveryCode returns the hash a recovery code is kept under. The codes
+// are random, so a fast hash is enough.
+func HashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+type TOTPCodeParams struct {
+	Code string `json:"code"`
+}
+
+type TOTPLoginParams struct {
+	Challenge string `json:"challenge"`
+	// Code is a code of the authenticator app or a recovery code.
+	Code string `json:"code"`
+}
@@ -0,0 +1,52 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// the SHA1 test vectors of RFC 6238, truncated to six digits
+	totp := &TOTP{Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := totp.Code(time.Unix(unix, 0))
+		assert.Nil(t, err)
+		assert.Equal(t, want, code)
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	totp, codes, err := NewTOTP()
+	assert.Nil(t, err)
+	assert.Len(t, codes, RECOVERY_CODES)
+	assert.NotContains(t, totp.RecoveryCodes, codes[0])
+	assert.Contains(t, totp.RecoveryCodes, HashRecoveryCode(strings.ToUpper(codes[0])))
+
+	now := time.Now()
+	code, err := totp.Code(now.Add(-TOTP_PERIOD))
+	assert.Nil(t, err)
+	step, ok := totp.Verify(code, now)
+	assert.True(t, ok)
+
+	// a used code can't be replayed
+	totp.LastStep = step
+	_, ok = totp.Verify(code, now)
+	assert.False(t, ok)
+
+	code, err = totp.Code(now.Add(-3 * TOTP_PERIOD))
+	assert.Nil(t, err)
+	_, ok = totp.Verify(code, now)
+	assert.False(t, ok)
+
+	uri := totp.URI("Hotel Reservation", "james@foo.com")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Hotel%20Reservation:james@foo.com?"))
+	assert.Contains(t, uri, "secret="+totp.Secret)
+}
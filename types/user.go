@@ -2,9 +2,11 @@ package types
 
 import (
 	"fmt"
+	"log/slog"
 	"regexp"
+	"strings"
+	"time"
 
-	"github.com/gofiber/fiber/v2/log"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -24,7 +26,6 @@ type CreateUserParams struct {
 }
 
 func (params CreateUserParams) Validate() map[string]string {
-	log.Info("enter Validate()")
 	errors := map[string]string{}
 
 	if len(params.FirstName) < minLenFirstname {
@@ -36,33 +37,45 @@ func (params CreateUserParams) Validate() map[string]string {
 	if len(params.Password) < minLenPassword {
 		errors["password"] = fmt.Sprintf("password should be atleast %d characters", minLenPassword)
 	}
-	if !isEmailValid(params.Email) {
+	if !isEmailValid(NormalizeEmail(params.Email)) {
 		errors["email"] = fmt.Sprintf("email %s is invalid", params.Email)
 	}
-	log.Info("exit Validate()")
-	log.Info("errors = ", errors)
 	return errors
 }
 
+// NormalizeEmail returns email the way it is stored and looked up: trimmed
+// and in lower case, so an address can't be registered twice by changing
+// its case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 func isEmailValid(e string) bool {
 	emailRegex := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 	return emailRegex.MatchString(e)
 }
 
 func NewUserFromParams(params CreateUserParams) (*User, error) {
-	log.Info("enter NewUserFromParams", params)
-	encpw, err := bcrypt.GenerateFromPassword([]byte(params.Password), BCRYPT_COST)
+	encpw, err := EncryptPassword(params.Password)
 	if err != nil {
 		return nil, err
 	}
 	return &User{
 		FirstName:         params.FirstName,
 		LastName:          params.LastName,
-		Email:             params.Email,
-		EncryptedPassword: string(encpw),
+		Email:             NormalizeEmail(params.Email),
+		EncryptedPassword: encpw,
 	}, nil
 }
 
+func EncryptPassword(pw string) (string, error) {
+	encpw, err := bcrypt.GenerateFromPassword([]byte(pw), BCRYPT_COST)
+	if err != nil {
+		return "", err
+	}
+	return string(encpw), nil
+}
+
 type User struct {
 	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	FirstName         string             `bson:"firstName" json:"firstName"`
@@ -70,11 +83,100 @@ type User struct {
 	Email             string             `bson:"email" json:"email"`
 	EncryptedPassword string             `bson:"encryptedPassword" json:"-"`
 	IsAdmin           bool               `bson:"isAdmin" json:"isAdmin"`
+	EmailVerified     bool               `bson:"emailVerified" json:"emailVerified"`
+	Role              Role               `bson:"role,omitempty" json:"role,omitempty"`
+	// HotelIDs are the hotels a staff member or manager works for.
+	HotelIDs []primitive.ObjectID `bson:"hotelIds,omitempty" json:"hotelIds,omitempty"`
+	// TokensValidAfter is when the password last changed. Access tokens
+	// issued before are no longer accepted.
+	TokensValidAfter time.Time `bson:"tokensValidAfter,omitempty" json:"-"`
+	TOTP             *TOTP     `bson:"totp,omitempty" json:"-"`
 }
 
+// LogValue only logs the id and role of the user, never their name, email
+// or credentials.
+func (u *User) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", u.ID.Hex()),
+		slog.String("role", string(u.EffectiveRole())),
+	)
+}
+
+// UpdateUserParams only change the fields that are set.
 type UpdateUserParams struct {
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
+	FirstName *string `json:"firstName"`
+	LastName  *string `json:"lastName"`
+	Email     *string `json:"email"`
+	// CurrentPassword and Code, the second factor of users who enrolled one,
+	// are those of the user making the change and only needed for the email.
+	CurrentPassword string `json:"currentPassword,omitempty"`
+	Code            string `json:"code,omitempty"`
+}
+
+func (params UpdateUserParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if params.FirstName != nil && len(*params.FirstName) < minLenFirstname {
+		errors["firstName"] = fmt.Sprintf("firstName should be atleast %d characters", minLenFirstname)
+	}
+	if params.LastName != nil && len(*params.LastName) < minLenLastname {
+		errors["lastName"] = fmt.Sprintf("lastName should be atleast %d characters", minLenLastname)
+	}
+	if params.Email != nil && !isEmailValid(NormalizeEmail(*params.Email)) {
+		errors["email"] = fmt.Sprintf("email %s is invalid", *params.Email)
+	}
+	if params.Email != nil && len(params.CurrentPassword) == 0 {
+		errors["currentPassword"] = "currentPassword is required to change the email"
+	}
+	return errors
+}
+
+// ToUpdate returns the user fields the params change. A new email has to be
+// verified again.
+func (params UpdateUserParams) ToUpdate() map[string]any {
+	update := map[string]any{}
+	if params.FirstName != nil {
+		update["firstName"] = *params.FirstName
+	}
+	if params.LastName != nil {
+		update["lastName"] = *params.LastName
+	}
+	if params.Email != nil {
+		update["email"] = NormalizeEmail(*params.Email)
+		update["emailVerified"] = false
+	}
+	return update
+}
+
+type ChangePasswordParams struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+func (params ChangePasswordParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(params.CurrentPassword) == 0 {
+		errors["currentPassword"] = "currentPassword is required"
+	}
+	if len(params.NewPassword) < minLenPassword {
+		errors["newPassword"] = fmt.Sprintf("newPassword should be atleast %d characters", minLenPassword)
+	}
+	return errors
+}
+
+type ResetPasswordParams struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (params ResetPasswordParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(params.Token) == 0 {
+		errors["token"] = "token is required"
+	}
+	if len(params.Password) < minLenPassword {
+		errors["password"] = fmt.Sprintf("password should be atleast %d characters", minLenPassword)
+	}
+	return errors
 }
 
 func IsValisPassword(encpw, pw string) bool {
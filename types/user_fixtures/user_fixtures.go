@@ -2,6 +2,7 @@ package userfixtures
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/go-faker/faker/v4"
 	"github.com/swarajroy/hotel-reservation/types"
@@ -18,6 +19,10 @@ func Next() (*types.User, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error")
 	}
+	// a new user has never changed their password or enrolled a second
+	// factor
+	u.TokensValidAfter = time.Time{}
+	u.TOTP = nil
 	return u, nil
 }
 